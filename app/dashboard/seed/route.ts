@@ -25,11 +25,30 @@ async function seedLinkedIps() {
   `);
 }
 
+async function seedApiKeys() {
+  // Only a SHA-256 hash of each key is stored; the plaintext is shown once at creation.
+  await client.query(`
+    CREATE TABLE IF NOT EXISTS api_keys (
+      id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+      user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+      name VARCHAR(255) NOT NULL,
+      prefix VARCHAR(32) NOT NULL,
+      key_hash CHAR(64) NOT NULL UNIQUE,
+      scopes TEXT[] NOT NULL,
+      created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
+      last_used_at TIMESTAMP WITH TIME ZONE,
+      revoked_at TIMESTAMP WITH TIME ZONE
+    );
+  `);
+  await client.query(`CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id)`);
+}
+
 export async function GET() {
   try {
     await client.query(`BEGIN`);
     await seedUsers();
     await seedLinkedIps();
+    await seedApiKeys();
     await client.query(`COMMIT`);
 
     return Response.json({ message: "Database seeded successfully" });
@@ -0,0 +1,31 @@
+import { createHmac } from "crypto";
+
+// Lifetime of the tokens minted for calls to the Go settings/analytics API.
+const BACKEND_TOKEN_TTL_SECONDS = 60;
+
+function base64url(input: string | Buffer): string {
+    return Buffer.from(input).toString("base64url");
+}
+
+// Sign a short-lived HS256 JWT for the given user with the shared AUTH_SECRET.
+// The Go service verifies it and checks that its subject owns the {userID} in the path.
+export function signBackendToken(userId: string): string {
+    const secret = process.env.AUTH_SECRET;
+    if (!secret) {
+        throw new Error("AUTH_SECRET is not set.");
+    }
+
+    const now = Math.floor(Date.now() / 1000);
+    const header = base64url(JSON.stringify({ alg: "HS256", typ: "JWT" }));
+    const payload = base64url(JSON.stringify({ sub: userId, id: userId, iat: now, exp: now + BACKEND_TOKEN_TTL_SECONDS }));
+    const signature = createHmac("sha256", secret).update(`${header}.${payload}`).digest("base64url");
+
+    return `${header}.${payload}.${signature}`;
+}
+
+// Add the Authorization header expected by the Go backend to a fetch request.
+export function withBackendAuth(options: RequestInit, userId: string): RequestInit {
+    const headers = new Headers(options.headers);
+    headers.set("Authorization", `Bearer ${signBackendToken(userId)}`);
+    return { ...options, headers };
+}
@@ -1,6 +1,7 @@
 "use server"
 
 import { auth } from "@/auth";
+import { withBackendAuth } from "@/app/lib/backend-auth";
 
 // Define the structure for a single point in the chart data from the backend
 export interface AnalyticsChartDataPoint {
@@ -39,7 +40,7 @@ export async function getUserAnalytics(): Promise<BackendAnalyticsResponse | nul
     // Assuming the analytics endpoint is served from the same base URL as settings
     // Adjust if you have a separate API URL for analytics
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/analytics/${userId}`;
+    const url = `${apiUrl}/v1/users/${userId}/analytics`;
 
     const fetchOptions: RequestInit = {
         method: 'GET',
@@ -48,7 +49,7 @@ export async function getUserAnalytics(): Promise<BackendAnalyticsResponse | nul
 
     try {
         console.log(`Fetching user analytics from: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         if (!response.ok) {
             const errorBody = await response.text();
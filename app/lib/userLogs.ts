@@ -1,6 +1,7 @@
 "use server"
 
 import { auth } from "@/auth";
+import { withBackendAuth } from "@/app/lib/backend-auth";
 import { BackendLogEntry } from "@/app/lib/definitions"; // Adjust import path if needed
 
 // Fetch user DNS query logs from the backend
@@ -16,7 +17,7 @@ export async function getUserLogs(): Promise<BackendLogEntry[] | null> {
     // *** IMPORTANT: Define your actual backend endpoint for logs ***
     // This is a placeholder URL. Replace with your actual API endpoint.
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/logs/${userId}`; // Example endpoint
+    const url = `${apiUrl}/v1/users/${userId}/logs`; // Example endpoint
 
     const fetchOptions: RequestInit = {
         method: 'GET',
@@ -25,7 +26,7 @@ export async function getUserLogs(): Promise<BackendLogEntry[] | null> {
 
     try {
         console.log(`Fetching user logs from: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         if (!response.ok) {
             const errorBody = await response.text();
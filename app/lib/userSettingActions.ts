@@ -1,5 +1,6 @@
 "use server"
 import { auth } from "@/auth";
+import { withBackendAuth } from "@/app/lib/backend-auth";
 // Ensure this import points to the updated definitions file with camelCase keys
 // Assuming PrivacySettingsOptions is also defined in definitions.ts
 import { GeneralSettingsOptions, PrivacySettingsOptions, ParentalControlSettings, TimeRange } from "@/app/lib/definitions"; // Add ParentalControlSettings
@@ -56,7 +57,7 @@ export async function getDenyList(): Promise<string[] | null> {
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/denylist/${userId}`;
+    const url = `${apiUrl}/v1/users/${userId}/settings/denylist`;
 
     const fetchOptions: RequestInit = {
         method: 'GET',
@@ -65,7 +66,7 @@ export async function getDenyList(): Promise<string[] | null> {
 
     try {
         console.log(`Fetching deny list from: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         if (!response.ok) {
             const errorBody = await response.text();
@@ -100,7 +101,7 @@ export async function addDenyDomain(domain: string): Promise<boolean> {
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/denylist/${userId}`;
+    const url = `${apiUrl}/v1/users/${userId}/settings/denylist`;
 
     const backendPayload = {
         domain: domain.trim(),
@@ -116,7 +117,7 @@ export async function addDenyDomain(domain: string): Promise<boolean> {
 
     try {
         console.log(`Adding domain '${domain}' to deny list at: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         // Backend returns 204 No Content on success
         if (!response.ok) {
@@ -149,7 +150,7 @@ export async function removeDenyDomain(domain: string): Promise<boolean> {
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/denylist/${userId}`;
+    const url = `${apiUrl}/v1/users/${userId}/settings/denylist`;
 
     const backendPayload = {
         domain: domain.trim(),
@@ -165,7 +166,7 @@ export async function removeDenyDomain(domain: string): Promise<boolean> {
 
     try {
         console.log(`Removing domain '${domain}' from deny list at: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         // Backend returns 204 No Content on success
         if (!response.ok) {
@@ -209,7 +210,7 @@ export async function getAllowList(): Promise<string[] | null> {
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/allowlist/${userId}`;
+    const url = `${apiUrl}/v1/users/${userId}/settings/allowlist`;
 
     const fetchOptions: RequestInit = {
         method: 'GET',
@@ -218,7 +219,7 @@ export async function getAllowList(): Promise<string[] | null> {
 
     try {
         console.log(`Fetching allow list from: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         if (!response.ok) {
             const errorBody = await response.text();
@@ -251,7 +252,7 @@ export async function addAllowDomain(domain: string): Promise<boolean> {
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/allowlist/${userId}`;
+    const url = `${apiUrl}/v1/users/${userId}/settings/allowlist`;
 
     const backendPayload = {
         domain: domain.trim(),
@@ -267,7 +268,7 @@ export async function addAllowDomain(domain: string): Promise<boolean> {
 
     try {
         console.log(`Adding domain '${domain}' to allow list at: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         // Backend returns 204 No Content on success
         if (!response.ok) {
@@ -300,7 +301,7 @@ export async function removeAllowDomain(domain: string): Promise<boolean> {
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/allowlist/${userId}`;
+    const url = `${apiUrl}/v1/users/${userId}/settings/allowlist`;
 
     const backendPayload = {
         domain: domain.trim(),
@@ -316,7 +317,7 @@ export async function removeAllowDomain(domain: string): Promise<boolean> {
 
     try {
         console.log(`Removing domain '${domain}' from allow list at: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         // Backend returns 204 No Content on success
         if (!response.ok) {
@@ -351,7 +352,7 @@ export async function getGeneralSettings(): Promise<GeneralSettingsOptions | nul
       }
 
       const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-      const url = `${apiUrl}/settings/general/${userId}`;
+      const url = `${apiUrl}/v1/users/${userId}/settings/general`;
 
       const fetchOptions: RequestInit = {
           method: 'GET',
@@ -359,7 +360,7 @@ export async function getGeneralSettings(): Promise<GeneralSettingsOptions | nul
 
       try {
         console.log(`Fetching general settings from: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         if (!response.ok) {
             const errorBody = await response.text();
@@ -400,7 +401,7 @@ export async function updateGeneralSettings(newSettings: GeneralSettingsOptions)
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/general/${userId}`;
+    const url = `${apiUrl}/v1/users/${userId}/settings/general`;
 
     // Map frontend GeneralSettingsOptions (PascalCase) to backend expected format (camelCase)
     const backendPayload: Omit<BackendGeneralSettings, 'userId'> = {
@@ -423,7 +424,7 @@ export async function updateGeneralSettings(newSettings: GeneralSettingsOptions)
 
     try {
         console.log(`Updating general settings at: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         if (!response.ok) {
             const errorBody = await response.text();
@@ -452,7 +453,7 @@ export async function getPrivacySettings(): Promise<PrivacySettingsOptions | nul
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/privacy/${userId}`; // Use the privacy endpoint
+    const url = `${apiUrl}/v1/users/${userId}/settings/privacy`; // Use the privacy endpoint
 
     const fetchOptions: RequestInit = {
         method: 'GET',
@@ -460,7 +461,7 @@ export async function getPrivacySettings(): Promise<PrivacySettingsOptions | nul
 
     try {
         console.log(`Fetching privacy settings from: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         if (!response.ok) {
             const errorBody = await response.text();
@@ -500,7 +501,7 @@ export async function updatePrivacySettings(newSettings: PrivacySettingsOptions)
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/privacy/${userId}`; // Use the privacy endpoint
+    const url = `${apiUrl}/v1/users/${userId}/settings/privacy`; // Use the privacy endpoint
 
     // Map frontend PrivacySettingsOptions (PascalCase) to backend expected format (camelCase)
     const backendPayload: Omit<BackendPrivacySettings, 'userId'> = {
@@ -522,7 +523,7 @@ export async function updatePrivacySettings(newSettings: PrivacySettingsOptions)
 
     try {
         console.log(`Updating privacy settings at: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         if (!response.ok) {
             const errorBody = await response.text();
@@ -550,7 +551,7 @@ export async function getParentalControlSettings(): Promise<ParentalControlSetti
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/parental/${userId}`; // Use the parental control endpoint
+    const url = `${apiUrl}/v1/users/${userId}/settings/parental`; // Use the parental control endpoint
 
     const fetchOptions: RequestInit = {
         method: 'GET',
@@ -560,7 +561,7 @@ export async function getParentalControlSettings(): Promise<ParentalControlSetti
 
     try {
         console.log(`Fetching parental control settings from: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         if (!response.ok) {
             const errorBody = await response.text();
@@ -592,7 +593,7 @@ export async function updateParentalControlSettings(newSettings: ParentalControl
     }
 
     const apiUrl = process.env.NEXT_PUBLIC_SETTINGS_API_URL || "http://localhost:8080";
-    const url = `${apiUrl}/settings/parental/${userId}`; // Use the parental control endpoint
+    const url = `${apiUrl}/v1/users/${userId}/settings/parental`; // Use the parental control endpoint
 
     // Prepare the payload. The Go backend expects 'blockedApps' and 'recreationSchedule'.
     // We don't need to send userId in the body as it's in the URL path.
@@ -611,7 +612,7 @@ export async function updateParentalControlSettings(newSettings: ParentalControl
 
     try {
         console.log(`Updating parental control settings at: ${url}`);
-        const response = await fetch(url, fetchOptions);
+        const response = await fetch(url, withBackendAuth(fetchOptions, userId));
 
         if (!response.ok) {
             const errorBody = await response.text();
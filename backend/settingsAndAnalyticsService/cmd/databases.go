@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/database/sqlitestore"
+	"github.com/BrachiGH/firedns-dashboard/internal/iplinks"
+	"go.uber.org/zap"
+)
+
+// databases holds the connections shared by every command: either both
+// MongoDB databases and PostgreSQL, or the embedded database.
+type databases struct {
+	analytics *database.Analytics_DB    // External backend only
+	settings  *database.UserSettings_DB // External backend only
+	embedded  *sqlitestore.Store        // Embedded backend only
+	links     *iplinks.Resolver         // Cached links of PostgreSQL or of the embedded database
+}
+
+// connectDatabases opens the storage backend of cfg: it connects to both
+// MongoDB databases and PostgreSQL, or opens the embedded database. If one
+// connection fails, those already made are closed.
+func connectDatabases(cfg *config.Config) (*databases, error) {
+	if cfg.Storage.Embedded() {
+		store, err := sqlitestore.Open(context.Background(), cfg.Storage.DataDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the embedded database: %w", err)
+		}
+		return &databases{embedded: store, links: iplinks.New(store, cfg.IPLinks)}, nil
+	}
+
+	dbs := &databases{
+		analytics: &database.Analytics_DB{},
+		settings:  &database.UserSettings_DB{},
+		links:     iplinks.New(database.Postgres_DB{}, cfg.IPLinks),
+	}
+
+	// Connect to Analytics MongoDB
+	if err := dbs.analytics.Connect(cfg.Mongo); err != nil {
+		return nil, fmt.Errorf("failed to connect to Analytics MongoDB: %w", err)
+	}
+
+	// Connect to UserSettings MongoDB
+	if err := dbs.settings.Connect(cfg.Mongo); err != nil {
+		dbs.close()
+		return nil, fmt.Errorf("failed to connect to UserSettings MongoDB: %w", err)
+	}
+
+	// Connect to PostgreSQL
+	if _, err := database.ConnectPG(cfg.Postgres); err != nil {
+		dbs.close()
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+
+	return dbs, nil
+}
+
+// stores returns the connections as the stores of the API.
+func (d *databases) stores() database.Stores {
+	if d.embedded != nil {
+		stores := d.embedded.Stores()
+		stores.IPLinks = d.links
+		return stores
+	}
+	return database.Stores{
+		Settings:  d.settings,
+		Lists:     d.settings,
+		Analytics: d.analytics,
+		IPLinks:   d.links,
+		APIKeys:   database.Postgres_DB{},
+		Pings: []database.Ping{
+			{Name: "analytics_mongodb", Check: d.analytics.Ping},
+			{Name: "settings_mongodb", Check: d.settings.Ping},
+			{Name: "postgres", Check: database.PingPG},
+		},
+	}
+}
+
+// close disconnects from every database, logging failures.
+func (d *databases) close() {
+	if d.embedded != nil {
+		if err := d.embedded.Close(); err != nil {
+			zap.L().Warn("Error closing the embedded database", zap.Error(err))
+		}
+		return
+	}
+	if err := d.analytics.Disconnect(); err != nil {
+		zap.L().Warn("Error disconnecting from Analytics MongoDB", zap.Error(err))
+	}
+	if err := d.settings.Disconnect(); err != nil {
+		zap.L().Warn("Error disconnecting from UserSettings MongoDB", zap.Error(err))
+	}
+	database.ClosePG()
+}
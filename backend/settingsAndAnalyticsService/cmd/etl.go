@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/services/user/etl"
+	"go.uber.org/zap"
+)
+
+// etlCommand dispatches the etl subcommands.
+func etlCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 || isHelp(args[0]) {
+		fmt.Fprintf(os.Stderr, "Usage: %s etl <run-once|backfill> [flags]\n", program)
+		if len(args) == 0 {
+			return errUsage
+		}
+		return nil
+	}
+
+	ctx = logging.NewContext(ctx, zap.L().Named("etl"))
+	switch args[0] {
+	case "run-once":
+		return etlRunOnce(ctx, args[1:])
+	case "backfill":
+		return etlBackfill(ctx, args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "%s etl: unknown subcommand %q, expected run-once or backfill\n", program, args[0])
+	return errUsage
+}
+
+// etlRunOnce runs the scheduled ETL a single time, e.g. from a cron job.
+func etlRunOnce(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("etl run-once", "[flags]",
+		"Runs the analytics ETL once over the last etl.window and exits 1 if it fails.")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return badUsage(fs, "etl run-once takes no arguments")
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return err
+	}
+	flushTraces, err := startTracing(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer flushTraces()
+
+	dbs, err := connectDatabases(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbs.close()
+
+	if !etl.RunAnalyticsETL(ctx, cfg.ETL, dbs.stores()) {
+		return errors.New("analytics ETL run did not succeed")
+	}
+	return nil
+}
+
+// etlBackfill rebuilds analytics from an explicit time range.
+func etlBackfill(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("etl backfill", "-from <time> [-to <time>] [-user <id>] [flags]",
+		"Rebuilds analytics from the DNS messages between -from and -to, replacing the\n"+
+			"stored counts. Times are RFC 3339 or YYYY-MM-DD (UTC midnight).")
+	var from, to timeFlag
+	fs.Var(&from, "from", "start of the range (required)")
+	fs.Var(&to, "to", "end of the range (default now)")
+	userID := fs.String("user", "", "only rebuild this user's analytics")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return badUsage(fs, "etl backfill takes no arguments")
+	}
+	if from.IsZero() {
+		return badUsage(fs, "-from is required")
+	}
+
+	opts := etl.Options{From: from.Time, To: to.Time, UserID: *userID}
+	if opts.To.IsZero() {
+		opts.To = time.Now()
+	}
+	if !opts.From.Before(opts.To) {
+		return badUsage(fs, "-from must be before -to")
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return err
+	}
+	flushTraces, err := startTracing(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer flushTraces()
+
+	dbs, err := connectDatabases(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbs.close()
+
+	return etl.Backfill(ctx, cfg.ETL, dbs.stores(), opts)
+}
+
+// timeFlag is a flag.Value accepting RFC 3339 timestamps and dates.
+type timeFlag struct{ time.Time }
+
+func (t *timeFlag) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (t *timeFlag) Set(value string) error {
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is neither an RFC 3339 time nor a YYYY-MM-DD date", value)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"go.uber.org/zap"
+)
+
+// exportUser writes a user's data as JSON, to stdout unless -o is given.
+func exportUser(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("export-user", "[flags] <user-id>",
+		"Writes the settings, analytics, API keys (without their hashes) and linked IPs\n"+
+			"of a user as a JSON document.")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || fs.Arg(0) == "" {
+		return badUsage(fs, "export-user takes exactly one user ID")
+	}
+	userID := fs.Arg(0)
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return err
+	}
+	flushTraces, err := startTracing(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer flushTraces()
+
+	dbs, err := connectDatabases(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbs.close()
+
+	var export *database.UserExport
+	if dbs.embedded != nil {
+		export, err = dbs.embedded.ExportUser(ctx, userID)
+	} else {
+		export, err = database.ExportUser(ctx, dbs.analytics, dbs.settings, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("error creating export file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+
+	zap.L().Info("Exported user", zap.String("user_id", userID), zap.String("output", *output))
+	return nil
+}
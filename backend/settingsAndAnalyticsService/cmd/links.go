@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"go.uber.org/zap"
+)
+
+// linkIP links an address or a network to a user in the embedded database.
+// With the external backend the dashboard links addresses in PostgreSQL.
+func linkIP(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("link-ip", "[flags] <user-id> <address|network>",
+		"Links an address, or every address of a network in CIDR notation, to a user from now on,\n"+
+			"replacing any earlier link of the same network. Only for the embedded storage backend; with\n"+
+			"the external backend the dashboard links addresses. A running service picks the link up\n"+
+			"within ipLinks.cacheTTL.")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 || fs.Arg(0) == "" {
+		return badUsage(fs, "link-ip takes a user ID and an address or network")
+	}
+	userID, ip := fs.Arg(0), fs.Arg(1)
+	if _, err := database.ParseNetwork(ip); err != nil {
+		return badUsage(fs, err.Error())
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return err
+	}
+	if !cfg.Storage.Embedded() {
+		return errors.New("link-ip needs the embedded storage backend, the dashboard links addresses in PostgreSQL")
+	}
+
+	dbs, err := connectDatabases(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbs.close()
+
+	network, err := dbs.embedded.LinkIP(ctx, userID, ip)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("embedded: linked %s to user %s\n", network, userID)
+
+	zap.L().Info("Linked IP", zap.String("user_id", userID), zap.Stringer("network", network))
+	return nil
+}
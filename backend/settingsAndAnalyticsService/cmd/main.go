@@ -1,50 +1,173 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/BrachiGH/firedns-dashboard/internal/database"
-	"github.com/BrachiGH/firedns-dashboard/internal/services/user/etl"
-	"github.com/BrachiGH/firedns-dashboard/transport"
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/lifecycle"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/tracing"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
+// command is a subcommand of the service binary.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"serve", "serve the API, and the analytics ETL with -with-etl", serve},
+	{"etl", "run the analytics ETL once or backfill a time range", etlCommand},
+	{"migrate", "create the database tables, indexes and validators", migrate},
+	{"migrate-dropped", "move the dropped queries of DNS messages out of the misspelled dorped field", migrateDropped},
+	{"export-user", "write everything stored about a user as JSON", exportUser},
+	{"link-ip", "link an address or network to a user in the embedded database", linkIP},
+}
+
+// errUsage is returned by a command whose arguments were wrong, after it has printed its usage.
+var errUsage = errors.New("invalid usage")
+
+var program = filepath.Base(os.Args[0])
+
 func main() {
-	var log *zap.Logger
+	// Load .env file first, it may configure the logger. Handle error if it doesn't exist or can't be read.
+	envErr := godotenv.Load()
 
-	// Load .env file. Handle error if it doesn't exist or can't be read.
-	err := godotenv.Load()
+	log, err := logging.New()
 	if err != nil {
-		log.Info("Warning: Could not load .env file. Using default or existing environment variables.")
+		fmt.Fprintf(os.Stderr, "Failed to configure logging: %v\n", err)
+		os.Exit(1)
+	}
+	zap.ReplaceGlobals(log)
+
+	if envErr != nil {
+		log.Warn("Could not load .env file. Using default or existing environment variables.", zap.Error(envErr))
 	}
 
-	// Connect to Analytics MongoDB
-	analyticsDB := &database.Analytics_DB{}
-	if err := analyticsDB.Connect(); err != nil {
-		log.Fatal("Failed to connect to Analytics MongoDB: %v", zap.Error(err))
+	code := execute(os.Args[1:])
+	log.Sync()
+	os.Exit(code)
+}
+
+// execute runs the command named by args[0] and returns the process exit code:
+// 0 on success, 1 if the command failed and 2 on invalid usage.
+// Without a command the service serves the API and runs the ETL, as it always has.
+func execute(args []string) int {
+	name := "serve"
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && !isHelp(args[0]) {
+		args = append([]string{"-with-etl"}, args...)
+	} else {
+		name, args = args[0], args[1:]
+	}
+
+	if isHelp(name) || name == "help" {
+		usage(os.Stdout)
+		return 0
 	}
-	defer analyticsDB.Disconnect()
 
-	// Connect to UserSettings MongoDB
-	settingsDB := &database.UserSettings_DB{}
-	if err := settingsDB.Connect(); err != nil {
-		log.Fatal("Failed to connect to Analytics MongoDB: %v", zap.Error(err))
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		ctx, stop := lifecycle.SignalContext()
+		defer stop()
+
+		err := cmd.run(ctx, args)
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		default:
+			zap.L().Error("Command failed", zap.String("command", name), zap.Error(err))
+			return 1
+		}
 	}
-	defer settingsDB.Disconnect()
 
-	// Connect to PostgreSQL
-	_, err = database.ConnectPG()
+	fmt.Fprintf(os.Stderr, "%s: unknown command %q\n\n", program, name)
+	usage(os.Stderr)
+	return 2
+}
+
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags] [arguments]\n\nCommands:\n", program)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nWithout a command, %s runs serve -with-etl.\n", program)
+	fmt.Fprintf(w, "Run %s <command> -h for the flags of a command.\n", program)
+}
+
+// newFlagSet returns the flag set of a command, including the configuration flags.
+func newFlagSet(name, arguments, description string) (*flag.FlagSet, *config.Flags) {
+	fs := flag.NewFlagSet(program+" "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n\nFlags:\n", program, name, arguments, description)
+		fs.PrintDefaults()
+	}
+	return fs, config.RegisterFlags(fs)
+}
+
+// parse parses the command line of a command.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage // The flag package has printed the error and the usage
+	}
+	return nil
+}
+
+// loadConfig loads the configuration once the command line has been parsed.
+func loadConfig(flags *config.Flags) (*config.Config, error) {
+	cfg, err := flags.Load()
 	if err != nil {
-		log.Fatal("Failed to connect to PostgreSQL: %v", zap.Error(err))
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
-	defer database.ClosePG() // Ensure disconnection on shutdown
+	return cfg, nil
+}
 
-	// Launch api services
-	go transport.StartApiServer()
+// startTracing installs the tracer provider of cfg. The returned function
+// flushes pending spans and is meant to be deferred by short-lived commands.
+func startTracing(ctx context.Context, cfg *config.Config) (func(), error) {
+	shutdown, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tracingFlushTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			zap.L().Warn("Failed to flush traces", zap.Error(err))
+		}
+	}, nil
+}
 
-	// Start the ETL routine (e.g., run every 5 minutes)
-	go etl.StartETLRoutine(24 * time.Hour)
+// tracingFlushTimeout bounds the export of the last spans of a command.
+const tracingFlushTimeout = 5 * time.Second
 
-	select {}
+// badUsage prints msg and the usage of fs.
+func badUsage(fs *flag.FlagSet, msg string) error {
+	fmt.Fprintf(fs.Output(), "%s\n", msg)
+	fs.Usage()
+	return errUsage
 }
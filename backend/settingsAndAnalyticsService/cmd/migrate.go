@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"go.uber.org/zap"
+)
+
+// migrate brings the PostgreSQL schema to a version, creates the MongoDB
+// collections, validators and indexes, and prints what changed. With the
+// embedded backend it only brings its schema up to date. It is safe to re-run.
+func migrate(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("migrate", "[flags]",
+		"Applies the pending PostgreSQL migrations, or rolls back to -to, then creates any missing\n"+
+			"MongoDB collections, $jsonSchema validators and indexes, updates those that differ, and\n"+
+			"prints every change. With the embedded storage backend, applies its pending migrations instead.\n"+
+			"Safe to run repeatedly.")
+	to := fs.Int("to", -1, "PostgreSQL schema `version` to migrate to, lower than the current one to roll back (not below 1); -1 for the latest")
+	status := fs.Bool("status", false, "only print the PostgreSQL schema version")
+	verbose := fs.Bool("v", false, "also print the MongoDB objects that were already up to date")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return badUsage(fs, "migrate takes no arguments")
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return err
+	}
+	if cfg.Storage.Embedded() && *to != -1 {
+		return badUsage(fs, "-to only applies to the PostgreSQL schema of the external storage backend")
+	}
+	flushTraces, err := startTracing(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer flushTraces()
+
+	dbs, err := connectDatabases(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbs.close()
+
+	if dbs.embedded != nil {
+		fmt.Printf("embedded: schema of %s is up to date\n", cfg.Storage.DataDir) // Pending migrations are applied when it is opened
+		return nil
+	}
+
+	version, latest, err := database.PGSchemaStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if *status {
+		fmt.Printf("postgres: schema at version %d of %d\n", version, latest)
+		return nil
+	}
+	if *to == -1 {
+		*to = latest
+	}
+	if err := database.MigratePG(ctx, *to); err != nil {
+		return err
+	}
+	if *to != version {
+		fmt.Printf("postgres: schema migrated from version %d to %d\n", version, *to)
+	}
+	report, err := database.BootstrapMongo(ctx, cfg.Mongo, dbs.analytics, dbs.settings)
+	if !*verbose {
+		report = report.Changed()
+	}
+	for _, change := range report {
+		fmt.Println(change)
+	}
+	if err != nil {
+		return err
+	}
+
+	zap.L().Info("Migration completed")
+	return nil
+}
+
+// migrateDropped rewrites the DNS messages still holding their dropped queries
+// in the misspelled dorped field, printing its progress. It resumes where an
+// interrupted run stopped.
+func migrateDropped(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("migrate-dropped", "[flags]",
+		"Moves the dropped queries of DNS messages from the misspelled dorped field to dropped, in\n"+
+			"batches. Interrupted runs resume where they stopped. Once it has completed and every resolver\n"+
+			"writes dropped, set ETL_READ_LEGACY_DROPPED=false.")
+	batchSize := fs.Int("batch-size", 500, "number of documents rewritten per update")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return badUsage(fs, "migrate-dropped takes no arguments")
+	}
+	if *batchSize <= 0 {
+		return badUsage(fs, "-batch-size must be positive")
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return err
+	}
+	flushTraces, err := startTracing(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer flushTraces()
+
+	dbs, err := connectDatabases(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbs.close()
+
+	if dbs.embedded != nil {
+		fmt.Println("embedded: DNS messages never held the dorped field, nothing to migrate")
+		return nil
+	}
+
+	status, err := dbs.analytics.MigrateDroppedField(ctx, *batchSize, func(status database.DroppedMigration) {
+		fmt.Printf("mongo: migrated %d of %d DNS messages\n", status.Migrated, status.Total)
+	})
+	if err != nil {
+		return fmt.Errorf("migrated %d of %d DNS messages before failing, run again to resume: %w", status.Migrated, status.Total, err)
+	}
+	if status.Total == 0 {
+		fmt.Println("mongo: no DNS message holds the dorped field")
+	}
+	fmt.Println("mongo: dorped migration complete, ETL_READ_LEGACY_DROPPED can be set to false")
+
+	zap.L().Info("Dropped field migration completed", zap.Int64("migrated", status.Migrated))
+	return nil
+}
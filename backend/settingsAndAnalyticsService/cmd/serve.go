@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/lifecycle"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/services/user/etl"
+	"github.com/BrachiGH/firedns-dashboard/internal/tracing"
+	"github.com/BrachiGH/firedns-dashboard/transport"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// serve runs the API server until ctx is cancelled, then shuts down gracefully.
+func serve(ctx context.Context, args []string) error {
+	fs, flags := newFlagSet("serve", "[flags]",
+		"Serves the API, and the resolver gRPC API when grpc.addr is set. With -with-etl the analytics ETL also runs every etl.interval;\n"+
+			"run it in exactly one process per deployment.")
+	withETL := fs.Bool("with-etl", false, "also run the analytics ETL routine")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return badUsage(fs, "serve takes no arguments")
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return err
+	}
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	dbs, err := connectDatabases(cfg)
+	if err != nil {
+		return err
+	}
+	if !cfg.Storage.Embedded() { // The embedded database is migrated when opened
+		if err := database.CheckPGSchema(ctx); err != nil {
+			dbs.close()
+			return err
+		}
+		if cfg.Mongo.Bootstrap {
+			_, err = database.BootstrapMongo(ctx, cfg.Mongo, dbs.analytics, dbs.settings)
+		} else {
+			err = database.CheckMongoIndexes(ctx, dbs.settings)
+		}
+		if err != nil {
+			dbs.close()
+			return err
+		}
+	}
+
+	// Drop cached links as soon as the dashboard changes them, rather than when they expire
+	if cfg.IPLinks.CacheTTL > 0 && !cfg.Storage.Embedded() {
+		go func() {
+			if err := database.WatchLinkedIPs(ctx, cfg.Postgres, dbs.links.Invalidate); err != nil {
+				zap.L().Warn("Not following link changes, cached links are used until they expire", zap.Error(err))
+			}
+		}()
+	}
+
+	// Launch api services
+	server, err := transport.NewApiServer(cfg, dbs.stores())
+	if err != nil {
+		dbs.close()
+		return fmt.Errorf("failed to configure API server: %w", err)
+	}
+	var grpcServer *grpc.Server
+	if cfg.GRPC.Enabled() {
+		if grpcServer, err = transport.NewGRPCServer(cfg, dbs.stores()); err != nil {
+			dbs.close()
+			return fmt.Errorf("failed to configure gRPC server: %w", err)
+		}
+	}
+	go func() {
+		if err := transport.StartApiServer(server); err != nil {
+			zap.L().Error("API server stopped unexpectedly", zap.Error(err))
+			stop() // Bring the rest of the service down with it
+		}
+	}()
+	metricsServer := transport.NewMetricsServer(cfg)
+	if metricsServer != nil {
+		go func() {
+			if err := transport.StartApiServer(metricsServer); err != nil {
+				zap.L().Error("Metrics server stopped unexpectedly", zap.Error(err))
+				stop()
+			}
+		}()
+	}
+	if grpcServer != nil {
+		go func() {
+			if err := transport.StartGRPCServer(grpcServer, cfg.GRPC.Addr); err != nil {
+				zap.L().Error("gRPC server stopped unexpectedly", zap.Error(err))
+				stop()
+			}
+		}()
+	}
+
+	// Shutdown order: stop accepting requests, let the ETL finish, close the databases, then flush traces
+	manager := lifecycle.New(cfg.Server.ShutdownTimeout)
+	manager.OnShutdown("http server", server.Shutdown)
+	if metricsServer != nil {
+		manager.OnShutdown("metrics server", metricsServer.Shutdown)
+	}
+	if grpcServer != nil {
+		manager.OnShutdown("grpc server", func(ctx context.Context) error {
+			// GracefulStop waits for settings watches, which only end when their callers leave
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				grpcServer.Stop()
+				return ctx.Err()
+			}
+		})
+	}
+
+	if *withETL {
+		etlCtx, cancelETL := context.WithCancel(logging.NewContext(ctx, zap.L().Named("etl")))
+		etlDone := etl.StartETLRoutine(etlCtx, cfg.ETL, dbs.stores())
+		manager.OnShutdown("etl", func(ctx context.Context) error {
+			cancelETL()
+			select {
+			case <-etlDone:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}
+
+	if dbs.embedded != nil {
+		manager.OnShutdown("embedded database", func(context.Context) error { return dbs.embedded.Close() })
+	} else {
+		manager.OnShutdown("analytics mongodb", func(context.Context) error { return dbs.analytics.Disconnect() })
+		manager.OnShutdown("settings mongodb", func(context.Context) error { return dbs.settings.Disconnect() })
+		manager.OnShutdown("postgres", func(context.Context) error {
+			database.ClosePG()
+			return nil
+		})
+	}
+	manager.OnShutdown("tracing", shutdownTracing) // Last, to export the spans of the steps above
+
+	if err := manager.Wait(ctx); err != nil {
+		return fmt.Errorf("shutdown completed with errors: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Scope is a permission that can be granted to an API key.
+type Scope string
+
+const (
+	ScopeSettingsRead  Scope = "settings:read"
+	ScopeSettingsWrite Scope = "settings:write"
+	ScopeListsRead     Scope = "lists:read"
+	ScopeListsWrite    Scope = "lists:write"
+	ScopeAnalyticsRead Scope = "analytics:read"
+)
+
+// AllScopes lists every scope an API key may be granted.
+var AllScopes = []Scope{ScopeSettingsRead, ScopeSettingsWrite, ScopeListsRead, ScopeListsWrite, ScopeAnalyticsRead}
+
+// apiKeyPrefix marks API keys so they can be told apart from session JWTs.
+const apiKeyPrefix = "fdns_"
+
+// ParseScopes validates scope names and removes duplicates.
+func ParseScopes(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+
+	seen := make(map[string]bool)
+	scopes := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !isKnownScope(Scope(name)) {
+			return nil, fmt.Errorf("unknown scope %q", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			scopes = append(scopes, name)
+		}
+	}
+	return scopes, nil
+}
+
+func isKnownScope(scope Scope) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateAPIKey returns a new random key, the hash to store and a short display prefix.
+func GenerateAPIKey() (key, keyHash, prefix string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("error generating api key: %w", err)
+	}
+
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, HashAPIKey(key), key[:len(apiKeyPrefix)+6], nil
+}
+
+// HashAPIKey returns the hex SHA-256 digest stored in place of the key.
+// Keys carry 256 bits of randomness, so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// isAPIKey reports whether a bearer credential is an API key rather than a session token.
+func isAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, apiKeyPrefix)
+}
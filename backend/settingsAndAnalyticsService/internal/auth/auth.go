@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+var (
+	errInvalidAPIKey = errors.New("unknown or revoked api key")
+	errKeyLookup     = errors.New("api key lookup failed")
+)
+
+// Claims is the subset of the dashboard session token that the API relies on.
+// NextAuth stores the user ID both in "sub" and in the custom "id" claim,
+// which is unrelated to the token ID ("jti") of RegisteredClaims.ID.
+type Claims struct {
+	UserID string `json:"id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type contextKey struct{}
+
+// Identity describes the caller of a request once its credentials have been verified.
+type Identity struct {
+	UserID   string
+	APIKeyID string   // Empty for session tokens
+	Scopes   []string // Only set for API keys; session tokens may do anything their user can
+}
+
+// HasScope reports whether the caller may perform an action requiring scope.
+func (i Identity) HasScope(scope Scope) bool {
+	if i.APIKeyID == "" {
+		return true
+	}
+	if scope == "" {
+		return false // Session-only route
+	}
+	for _, s := range i.Scopes {
+		if Scope(s) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NewContext returns a copy of ctx carrying the authenticated identity.
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// IdentityFromContext returns the identity stored by the middleware.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok && identity.UserID != ""
+}
+
+// UserIDFromContext returns the authenticated user ID stored by the middleware.
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	identity, ok := IdentityFromContext(ctx)
+	return identity.UserID, ok
+}
+
+// Authenticator verifies the session tokens sent by the Next.js dashboard.
+type Authenticator struct {
+	secret []byte
+	keys   database.APIKeyStore
+}
+
+// NewAuthenticator creates an Authenticator using the AUTH_SECRET shared with
+// NextAuth, which looks API keys up in keys.
+func NewAuthenticator(secret string, keys database.APIKeyStore) (*Authenticator, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("auth secret not set (AUTH_SECRET)")
+	}
+	return &Authenticator{secret: []byte(secret), keys: keys}, nil
+}
+
+// Verify checks the token signature and expiry and returns the user ID it was issued for.
+func (a *Authenticator) Verify(tokenString string) (string, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return a.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", fmt.Errorf("invalid session token: %w", err)
+	}
+
+	userID := claims.Subject
+	if userID == "" {
+		userID = claims.UserID
+	}
+	if userID == "" {
+		return "", errors.New("invalid session token: missing subject")
+	}
+	return userID, nil
+}
+
+// authenticate resolves the bearer credential of a request, which is either
+// a dashboard session token or an API key.
+func (a *Authenticator) authenticate(ctx context.Context, credential string) (Identity, error) {
+	if !isAPIKey(credential) {
+		userID, err := a.Verify(credential)
+		if err != nil {
+			return Identity{}, err
+		}
+		return Identity{UserID: userID}, nil
+	}
+
+	key, err := a.keys.UseAPIKey(ctx, HashAPIKey(credential))
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", errKeyLookup, err)
+	}
+	if key == nil {
+		return Identity{}, errInvalidAPIKey
+	}
+	return Identity{UserID: key.UserID, APIKeyID: key.ID, Scopes: key.Scopes}, nil
+}
+
+// RequireUser wraps a handler whose route pattern contains {userID} so that it only
+// runs when the bearer credential belongs to that user. API keys must additionally
+// hold scope; an empty scope restricts the route to dashboard session tokens.
+// The verified identity is available to the handler through IdentityFromContext.
+func (a *Authenticator) RequireUser(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathUserID := r.PathValue("userID")
+		if pathUserID == "" {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidPath, "User ID cannot be empty")
+			return
+		}
+
+		credential, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="firedns"`)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Missing bearer token")
+			return
+		}
+
+		logger := logging.FromContext(r.Context())
+		identity, err := a.authenticate(r.Context(), credential)
+		if errors.Is(err, errKeyLookup) {
+			logger.Error("Error authenticating request", zap.Error(err))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseUnavailable, "Server configuration error (database)")
+			return
+		}
+		if err != nil {
+			logger.Warn("Rejected request: invalid credentials", zap.Error(err))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="firedns", error="invalid_token"`)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Invalid credentials")
+			return
+		}
+
+		if identity.UserID != pathUserID {
+			logger.Warn("Rejected request: user does not own this resource", zap.String("user_id", identity.UserID))
+			problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "Credentials do not grant access to this user")
+			return
+		}
+
+		if !identity.HasScope(scope) {
+			insufficientScope(w, r, identity, scope)
+			return
+		}
+
+		fields := []zap.Field{zap.String("user_id", identity.UserID)}
+		if identity.APIKeyID != "" {
+			fields = append(fields, zap.String("api_key_id", identity.APIKeyID))
+		}
+		ctx := logging.With(NewContext(r.Context(), identity), fields...)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// RequireScope checks a scope beyond the one of the route, for handlers that
+// act on more than one kind of data. It must run behind RequireUser. If the
+// caller lacks the scope it writes a 403 and returns false.
+func RequireScope(w http.ResponseWriter, r *http.Request, scope Scope) bool {
+	identity, ok := IdentityFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+		return false
+	}
+	if !identity.HasScope(scope) {
+		insufficientScope(w, r, identity, scope)
+		return false
+	}
+	return true
+}
+
+func insufficientScope(w http.ResponseWriter, r *http.Request, identity Identity, scope Scope) {
+	logging.FromContext(r.Context()).Warn("Rejected request: api key lacks scope",
+		zap.String("api_key_id", identity.APIKeyID), zap.String("scope", string(scope)))
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="firedns", error="insufficient_scope", scope="%s"`, scope))
+	problem.Write(w, r, http.StatusForbidden, problem.CodeInsufficientScope, "API key does not have the required scope")
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifyReadsUserIDClaims(t *testing.T) {
+	a, err := NewAuthenticator("test-secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := jwt.NewNumericDate(time.Now().Add(time.Hour))
+
+	for name, tc := range map[string]struct {
+		claims Claims
+		want   string
+	}{
+		"subject":            {Claims{UserID: "bob", RegisteredClaims: jwt.RegisteredClaims{Subject: "alice", ID: "token-1", ExpiresAt: expires}}, "alice"},
+		"id without subject": {Claims{UserID: "bob", RegisteredClaims: jwt.RegisteredClaims{ID: "token-1", ExpiresAt: expires}}, "bob"},
+		"token ID only":      {Claims{RegisteredClaims: jwt.RegisteredClaims{ID: "token-1", ExpiresAt: expires}}, ""},
+	} {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tc.claims).SignedString([]byte("test-secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		userID, err := a.Verify(token)
+		if userID != tc.want || (err == nil) != (tc.want != "") {
+			t.Errorf("%s: Verify = %q, %v, want %q", name, userID, err, tc.want)
+		}
+	}
+}
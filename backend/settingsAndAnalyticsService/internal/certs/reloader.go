@@ -0,0 +1,219 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// checkInterval bounds how often the key material is checked for changes on disk.
+const checkInterval = 10 * time.Second
+
+// Reloader serves TLS key material from files and picks up replaced files
+// without a restart. Changes are detected by modification time and size,
+// checked at most once per checkInterval during handshakes.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string // Optional; when set, clients must present a certificate signed by this CA
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamps    map[string]fileStamp
+	lastCheck time.Time
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader loads the key pair (and the client CA bundle if clientCAFile is not empty).
+func NewReloader(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns a server configuration backed by the reloader. It offers
+// h2 and http/1.1, the protocols of the HTTP and gRPC servers, itself: with a
+// client CA bundle, handshakes use a copy of it made by GetConfigForClient,
+// which ignores changes the caller makes to its own copies.
+func (r *Reloader) TLSConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: r.getCertificate,
+	}
+	if r.clientCAFile != "" {
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.configForClient(config), nil
+		}
+	}
+	return config
+}
+
+// getCertificate is called for every handshake, so a reloaded certificate
+// applies to new connections immediately.
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// configForClient returns the configuration of one handshake: base requiring
+// a client certificate signed by the current CA bundle, which is also
+// advertised to the client, so that a reloaded bundle applies without
+// rebuilding the server's tls.Config.
+func (r *Reloader) configForClient(base *tls.Config) *tls.Config {
+	r.maybeReload()
+
+	config := base.Clone()
+	config.GetConfigForClient = nil
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	config.VerifyConnection = r.verifyClientCert
+	r.mu.RLock()
+	config.ClientCAs = r.clientCAs
+	r.mu.RUnlock()
+	return config
+}
+
+// verifyClientCert checks the client certificate chain against the current
+// client CA bundle. Unlike VerifyPeerCertificate, VerifyConnection also runs
+// on resumed sessions, so that a session established with a certificate of a
+// replaced CA cannot be resumed.
+func (r *Reloader) verifyClientCert(state tls.ConnectionState) error {
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		return fmt.Errorf("client certificate required")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	r.mu.RLock()
+	roots := r.clientCAs
+	r.mu.RUnlock()
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("client certificate rejected: %w", err)
+	}
+	return nil
+}
+
+// maybeReload reloads the files if they changed since they were last read.
+// A failed reload is logged and the previous material is kept.
+func (r *Reloader) maybeReload() {
+	r.mu.RLock()
+	due := time.Since(r.lastCheck) >= checkInterval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	changed, err := r.filesChanged()
+	if err != nil {
+		zap.L().Warn("Could not check TLS files for changes", zap.Error(err))
+	}
+	if !changed {
+		r.mu.Lock()
+		r.lastCheck = time.Now()
+		r.mu.Unlock()
+		return
+	}
+
+	if err := r.reload(); err != nil {
+		zap.L().Warn("Failed to reload TLS files, keeping the previous certificate", zap.Error(err))
+		r.mu.Lock()
+		r.lastCheck = time.Now()
+		r.mu.Unlock()
+		return
+	}
+	zap.L().Info("Reloaded TLS certificate", zap.String("file", r.certFile))
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) filesChanged() (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, file := range r.files() {
+		stamp, err := statFile(file)
+		if err != nil {
+			return false, err
+		}
+		if stamp != r.stamps[file] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reload reads every file and swaps the material in only if all of it is valid.
+func (r *Reloader) reload() error {
+	stamps := make(map[string]fileStamp)
+	for _, file := range r.files() {
+		stamp, err := statFile(file)
+		if err != nil {
+			return err
+		}
+		stamps[file] = stamp
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS key pair: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("error reading client CA file: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %s", r.clientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.stamps = stamps
+	r.lastCheck = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+func statFile(file string) (fileStamp, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("error reading TLS file: %w", err)
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
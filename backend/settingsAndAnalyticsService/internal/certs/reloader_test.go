@@ -0,0 +1,334 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authority issues certificates for the tests.
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T, name string) *authority {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	cert, key, certPEM := issue(t, template, nil, nil)
+	return &authority{cert: cert, key: key, pem: certPEM}
+}
+
+// leaf issues a certificate for name with the given usage and returns it and
+// its key in PEM.
+func (a *authority) leaf(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	_, key, certPEM := issue(t, template, a.cert, a.key)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// issue signs template with parent, or self-signs it when parent is nil.
+func issue(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// writeFile replaces a file and moves its modification time forward, so that
+// the change is seen even within the file system's timestamp resolution.
+func writeFile(t *testing.T, file string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(file); err == nil {
+		at := info.ModTime().Add(time.Second)
+		if err := os.Chtimes(file, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// files holds the key material of a reloader in a temporary directory.
+type files struct {
+	cert, key, clientCA string
+}
+
+func newFiles(t *testing.T, ca *authority, clientCA []byte) files {
+	t.Helper()
+	dir := t.TempDir()
+	f := files{cert: filepath.Join(dir, "server.crt"), key: filepath.Join(dir, "server.key")}
+	certPEM, keyPEM := ca.leaf(t, "localhost", x509.ExtKeyUsageServerAuth)
+	writeFile(t, f.cert, certPEM)
+	writeFile(t, f.key, keyPEM)
+	if clientCA != nil {
+		f.clientCA = filepath.Join(dir, "client-ca.crt")
+		writeFile(t, f.clientCA, clientCA)
+	}
+	return f
+}
+
+// expireCheck lets the next handshake look for changed files without waiting checkInterval.
+func expireCheck(r *Reloader) {
+	r.mu.Lock()
+	r.lastCheck = time.Time{}
+	r.mu.Unlock()
+}
+
+func servedCommonName(t *testing.T, r *Reloader) string {
+	t.Helper()
+	cert, err := r.getCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestReloadAfterFilesChange(t *testing.T) {
+	ca := newAuthority(t, "server CA")
+	f := newFiles(t, ca, nil)
+	r, err := NewReloader(f.cert, f.key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := servedCommonName(t, r); name != "localhost" {
+		t.Fatalf("serving %q, want localhost", name)
+	}
+
+	certPEM, keyPEM := ca.leaf(t, "renewed.example", x509.ExtKeyUsageServerAuth)
+	writeFile(t, f.cert, certPEM)
+	writeFile(t, f.key, keyPEM)
+	if name := servedCommonName(t, r); name != "localhost" {
+		t.Fatalf("serving %q before the check interval elapsed, want the previous certificate", name)
+	}
+	expireCheck(r)
+	if name := servedCommonName(t, r); name != "renewed.example" {
+		t.Fatalf("serving %q after the files changed, want renewed.example", name)
+	}
+
+	// A key that does not match the certificate keeps the previous material
+	_, otherKey := ca.leaf(t, "other.example", x509.ExtKeyUsageServerAuth)
+	writeFile(t, f.key, otherKey)
+	expireCheck(r)
+	if name := servedCommonName(t, r); name != "renewed.example" {
+		t.Fatalf("serving %q after an invalid reload, want renewed.example", name)
+	}
+}
+
+// handshake connects a client presenting clientCert (if any) to a server
+// configured by r and returns the server's handshake error.
+func handshake(t *testing.T, r *Reloader, serverCA *authority, clientCert []tls.Certificate) error {
+	t.Helper()
+	_, err := connect(t, r.TLSConfig(), clientConfig(serverCA, clientCert))
+	return err
+}
+
+func clientConfig(serverCA *authority, clientCert []tls.Certificate) *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.cert)
+	return &tls.Config{ServerName: "localhost", RootCAs: roots, Certificates: clientCert}
+}
+
+// connect runs a handshake between a client and a server configured by
+// server and client, and returns the server's connection state and error.
+func connect(t *testing.T, server, client *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+	// Not net.Pipe: both sides write at once when a session is resumed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+	serverConn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn := tls.Client(clientConn, client)
+		if conn.Handshake() == nil {
+			conn.Read(make([]byte, 1)) // Let the server finish reading the client's flight, and receive its tickets
+		}
+	}()
+	conn := tls.Server(serverConn, server)
+	err = conn.Handshake()
+	conn.Close()
+	<-done
+	return conn.ConnectionState(), err
+}
+
+func clientCertificate(t *testing.T, ca *authority) []tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.leaf(t, "dashboard", x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []tls.Certificate{cert}
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverCA := newAuthority(t, "server CA")
+	clientCA := newAuthority(t, "client CA")
+	otherCA := newAuthority(t, "other CA")
+	f := newFiles(t, serverCA, clientCA.pem)
+	r, err := NewReloader(f.cert, f.key, f.clientCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trusted := clientCertificate(t, clientCA)
+	untrusted := clientCertificate(t, otherCA)
+	if err := handshake(t, r, serverCA, trusted); err != nil {
+		t.Errorf("trusted client rejected: %v", err)
+	}
+	if err := handshake(t, r, serverCA, untrusted); err == nil {
+		t.Error("client signed by another CA accepted")
+	}
+	if err := handshake(t, r, serverCA, nil); err == nil {
+		t.Error("client without a certificate accepted")
+	}
+
+	// A replaced CA bundle applies to the next handshakes
+	writeFile(t, f.clientCA, otherCA.pem)
+	expireCheck(r)
+	if err := handshake(t, r, serverCA, untrusted); err != nil {
+		t.Errorf("client of the reloaded CA rejected: %v", err)
+	}
+	if err := handshake(t, r, serverCA, trusted); err == nil {
+		t.Error("client of the replaced CA accepted")
+	}
+}
+
+func TestMutualTLSAdvertisesClientCAs(t *testing.T) {
+	serverCA := newAuthority(t, "server CA")
+	clientCA := newAuthority(t, "client CA")
+	otherCA := newAuthority(t, "other CA")
+	f := newFiles(t, serverCA, clientCA.pem)
+	r, err := NewReloader(f.cert, f.key, f.clientCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	advertised := func() string {
+		var names []string
+		client := clientConfig(serverCA, nil)
+		client.GetClientCertificate = func(req *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			for _, raw := range req.AcceptableCAs {
+				var name pkix.RDNSequence
+				if _, err := asn1.Unmarshal(raw, &name); err == nil {
+					var subject pkix.Name
+					subject.FillFromRDNSequence(&name)
+					names = append(names, subject.CommonName)
+				}
+			}
+			return &tls.Certificate{}, nil
+		}
+		connect(t, r.TLSConfig(), client)
+		return strings.Join(names, ", ")
+	}
+	if names := advertised(); names != "client CA" {
+		t.Errorf("advertised CAs %q, want client CA", names)
+	}
+	writeFile(t, f.clientCA, otherCA.pem)
+	expireCheck(r)
+	if names := advertised(); names != "other CA" {
+		t.Errorf("advertised CAs %q after the reload, want other CA", names)
+	}
+}
+
+func TestResumedSessionsAreVerified(t *testing.T) {
+	serverCA := newAuthority(t, "server CA")
+	clientCA := newAuthority(t, "client CA")
+	otherCA := newAuthority(t, "other CA")
+	f := newFiles(t, serverCA, clientCA.pem)
+	r, err := NewReloader(f.cert, f.key, f.clientCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sessions are resumed with the ticket keys of the server's configuration
+	server := r.TLSConfig()
+	client := clientConfig(serverCA, clientCertificate(t, clientCA))
+	client.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	for _, resumed := range []bool{false, true} {
+		state, err := connect(t, server, client)
+		if err != nil {
+			t.Fatalf("trusted client rejected: %v", err)
+		}
+		if state.DidResume != resumed {
+			t.Fatalf("DidResume = %v, want %v", state.DidResume, resumed)
+		}
+	}
+
+	// Once the CA is replaced, the session of its client is no longer accepted
+	writeFile(t, f.clientCA, otherCA.pem)
+	expireCheck(r)
+	if _, err := connect(t, server, client); err == nil {
+		t.Error("session of a client of the replaced CA resumed")
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Budget is a token bucket: Rate requests per second on average, with bursts
+// of up to Burst. It is written as "rate:burst" (e.g. "2:10"); "0" disables the limit.
+type Budget struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the budget limits anything.
+func (b Budget) Enabled() bool { return b.Rate > 0 }
+
+func (b Budget) String() string {
+	if !b.Enabled() {
+		return "0"
+	}
+	return strconv.FormatFloat(b.Rate, 'g', -1, 64) + ":" + strconv.Itoa(b.Burst)
+}
+
+// UnmarshalYAML reads a budget from its "rate:burst" form.
+func (b *Budget) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := ParseBudget(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*b = parsed
+	return nil
+}
+
+// ParseBudget parses "rate:burst", or "0" for no limit.
+func ParseBudget(value string) (Budget, error) {
+	if strings.TrimSpace(value) == "0" {
+		return Budget{}, nil
+	}
+
+	rateStr, burstStr, found := strings.Cut(value, ":")
+	if !found {
+		return Budget{}, fmt.Errorf("%q is not in the form rate:burst", value)
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rateStr), 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return Budget{}, fmt.Errorf("rate %q must be a positive number", rateStr)
+	}
+	burst, err := strconv.Atoi(strings.TrimSpace(burstStr))
+	if err != nil || burst < 1 {
+		return Budget{}, fmt.Errorf("burst %q must be a positive integer", burstStr)
+	}
+	return Budget{Rate: rate, Burst: burst}, nil
+}
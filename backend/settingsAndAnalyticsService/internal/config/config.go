@@ -0,0 +1,307 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Config is the complete configuration of the service. Values are layered:
+// Default, then the optional YAML file, then environment variables, then flags.
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Auth      Auth      `yaml:"auth"`
+	Storage   Storage   `yaml:"storage"`
+	Mongo     Mongo     `yaml:"mongo"`
+	Postgres  Postgres  `yaml:"postgres"`
+	API       API       `yaml:"api"`
+	ETL       ETL       `yaml:"etl"`
+	RateLimit RateLimit `yaml:"rateLimit"`
+	Tracing   Tracing   `yaml:"tracing"`
+	GRPC      GRPC      `yaml:"grpc"`
+	IPLinks   IPLinks   `yaml:"ipLinks"`
+}
+
+// Server configures the HTTP listeners.
+type Server struct {
+	Addr              string        `yaml:"addr"`
+	MetricsAddr       string        `yaml:"metricsAddr"` // Admin listener of /metrics, kept off the public API; empty disables it
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout"`
+	TLS               TLS           `yaml:"tls"`
+}
+
+// TLS enables HTTPS when CertFile and KeyFile are set. Setting ClientCAFile
+// as well requires callers to present a client certificate signed by that CA.
+type TLS struct {
+	CertFile     string `yaml:"certFile"`
+	KeyFile      string `yaml:"keyFile"`
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+// Enabled reports whether HTTPS is configured.
+func (t TLS) Enabled() bool { return t.CertFile != "" }
+
+// Auth configures request authentication.
+type Auth struct {
+	Secret string `yaml:"secret"` // Shared with NextAuth (AUTH_SECRET)
+}
+
+// Storage backends.
+const (
+	StorageExternal = "external" // MongoDB for settings and analytics, PostgreSQL for links and keys
+	StorageEmbedded = "embedded" // A SQLite database in DataDir, for single-binary deployments
+)
+
+// Storage selects where the service keeps its data. The Mongo and Postgres
+// sections only apply to the external backend.
+type Storage struct {
+	Backend string `yaml:"backend"`
+	DataDir string `yaml:"dataDir"` // Directory of the embedded database, created if needed
+}
+
+// Embedded reports whether the embedded backend is selected.
+func (s Storage) Embedded() bool { return s.Backend == StorageEmbedded }
+
+// Mongo configures the MongoDB deployment holding both the analytics and the
+// settings databases. Replacing all the settings of a user at once is atomic
+// only on a replica set or sharded cluster; a standalone server is written
+// one collection at a time.
+type Mongo struct {
+	URI               string        `yaml:"uri"`
+	AnalyticsDatabase string        `yaml:"analyticsDatabase"`
+	SettingsDatabase  string        `yaml:"settingsDatabase"`
+	ConnectTimeout    time.Duration `yaml:"connectTimeout"`
+
+	// Bootstrap creates the collections, validators and indexes at startup,
+	// as the migrate command does. Without it, startup fails unless the
+	// settings collections have their unique userId index.
+	Bootstrap    bool          `yaml:"bootstrap"`
+	AnalyticsTTL time.Duration `yaml:"analyticsTTL"` // Analytics not refreshed by the ETL for this long expire, 0 keeps them
+}
+
+// Postgres configures the dashboard's PostgreSQL database.
+type Postgres struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+	SSLMode  string `yaml:"sslMode"`
+}
+
+// DSN returns the lib/pq connection string.
+func (p Postgres) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		p.Host, p.Port, p.User, p.Password, p.Database, p.SSLMode)
+}
+
+// API configures the request handlers.
+type API struct {
+	RequestTimeout   time.Duration `yaml:"requestTimeout"`   // Database work of settings and key requests
+	AnalyticsTimeout time.Duration `yaml:"analyticsTimeout"` // Database work of analytics and log requests
+	TopDomains       int           `yaml:"topDomains"`       // Domains listed in the analytics top charts
+	MaxBodyBytes     int           `yaml:"maxBodyBytes"`     // Largest request body accepted
+}
+
+// ETL configures the analytics ETL routine.
+type ETL struct {
+	Interval       time.Duration `yaml:"interval"`
+	Window         time.Duration `yaml:"window"` // How far back DNS messages are counted
+	ExtractTimeout time.Duration `yaml:"extractTimeout"`
+	LoadTimeout    time.Duration `yaml:"loadTimeout"` // Per user upsert
+	// Also count the dropped queries of the misspelled dorped field; turn off
+	// once the migrate-dropped command has rewritten every DNS message.
+	ReadLegacyDropped bool `yaml:"readLegacyDropped"`
+}
+
+// RateLimit holds the token bucket budgets of the rate limiter.
+type RateLimit struct {
+	UserRead  Budget `yaml:"userRead"`
+	UserWrite Budget `yaml:"userWrite"`
+	IPRead    Budget `yaml:"ipRead"`
+	IPWrite   Budget `yaml:"ipWrite"`
+
+	// TrustForwardedFor keys IP budgets on the last X-Forwarded-For entry
+	// instead of the peer address. Only enable it behind a proxy that sets the header.
+	TrustForwardedFor bool `yaml:"trustForwardedFor"`
+}
+
+// Tracing exporters.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"   // OTLP over HTTP to Endpoint
+	ExporterStdout = "stdout" // Pretty-printed spans on stderr, for local debugging
+)
+
+// Tracing configures OpenTelemetry tracing.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`    // host:port of the OTLP/HTTP collector
+	Insecure    bool    `yaml:"insecure"`    // Send to Endpoint over plain HTTP
+	SampleRatio float64 `yaml:"sampleRatio"` // Fraction of new traces recorded; sampled callers are always followed
+	ServiceName string  `yaml:"serviceName"`
+}
+
+// GRPC configures the listener of the resolver API. It is served with the
+// TLS settings of Server; resolver nodes authenticate with Token, or with a
+// client certificate when Server.TLS.ClientCAFile is set.
+type GRPC struct {
+	Addr     string `yaml:"addr"`     // Empty disables the gRPC API
+	Token    string `yaml:"token"`    // Sent by resolver nodes as "authorization: Bearer <token>"
+	Insecure bool   `yaml:"insecure"` // Accept Token without TLS, e.g. behind a TLS-terminating proxy
+}
+
+// Enabled reports whether the gRPC API is served.
+func (g GRPC) Enabled() bool { return g.Addr != "" }
+
+// IPLinks configures the resolution of client addresses to the users they are linked to.
+type IPLinks struct {
+	CacheTTL  time.Duration `yaml:"cacheTTL"`  // How long a resolved address is reused; 0 disables the cache
+	BatchSize int           `yaml:"batchSize"` // Addresses looked up per PostgreSQL query
+}
+
+// Default returns the configuration used for every value that is not set elsewhere.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			MetricsAddr:       ":9091",
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Storage: Storage{
+			Backend: StorageExternal,
+			DataDir: "data",
+		},
+		Mongo: Mongo{
+			AnalyticsDatabase: "FireDNSanalytics",
+			SettingsDatabase:  "FireDNSUserSettings",
+			ConnectTimeout:    10 * time.Second,
+			Bootstrap:         true,
+			AnalyticsTTL:      30 * 24 * time.Hour,
+		},
+		Postgres: Postgres{
+			Port:    5432,
+			SSLMode: "disable",
+		},
+		API: API{
+			RequestTimeout:   5 * time.Second,
+			AnalyticsTimeout: 10 * time.Second,
+			TopDomains:       6,
+			MaxBodyBytes:     1 << 20,
+		},
+		ETL: ETL{
+			Interval:       24 * time.Hour,
+			Window:         24 * time.Hour,
+			ExtractTimeout: 2 * time.Minute,
+			LoadTimeout:    10 * time.Second,
+
+			ReadLegacyDropped: true,
+		},
+		RateLimit: RateLimit{
+			UserRead:  Budget{Rate: 10, Burst: 30},
+			UserWrite: Budget{Rate: 2, Burst: 10},
+			IPRead:    Budget{Rate: 50, Burst: 100}, // Larger because the dashboard proxies all of its users through one address
+			IPWrite:   Budget{Rate: 10, Burst: 40},
+		},
+		Tracing: Tracing{
+			Exporter:    ExporterNone,
+			Endpoint:    "localhost:4318",
+			SampleRatio: 1,
+			ServiceName: "firedns-settings-analytics",
+		},
+		IPLinks: IPLinks{
+			CacheTTL:  5 * time.Minute,
+			BatchSize: 1000,
+		},
+	}
+}
+
+// Validate checks every value and reports all problems at once. The auth
+// secret is left to the API server, the only command that needs it.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	positive := func(name string, d time.Duration) {
+		check(d > 0, "%s: must be a positive duration, got %s", name, d)
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("server.addr: %q is not a host:port address", c.Server.Addr))
+	}
+	if c.Server.MetricsAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Server.MetricsAddr); err != nil {
+			errs = append(errs, fmt.Errorf("server.metricsAddr: %q is not a host:port address", c.Server.MetricsAddr))
+		}
+		check(c.Server.MetricsAddr != c.Server.Addr, "server.metricsAddr: must differ from server.addr, metrics are not served on the API listener")
+	}
+	positive("server.readHeaderTimeout", c.Server.ReadHeaderTimeout)
+	positive("server.shutdownTimeout", c.Server.ShutdownTimeout)
+	check((c.Server.TLS.CertFile == "") == (c.Server.TLS.KeyFile == ""),
+		"server.tls: certFile and keyFile must be set together")
+	check(c.Server.TLS.ClientCAFile == "" || c.Server.TLS.Enabled(),
+		"server.tls.clientCAFile: requires certFile and keyFile")
+
+	switch c.Storage.Backend {
+	case StorageExternal:
+		check(c.Mongo.URI != "", "mongo.uri: must be set (MONGO_DB_URI)")
+		check(c.Mongo.AnalyticsDatabase != "", "mongo.analyticsDatabase: must not be empty")
+		check(c.Mongo.SettingsDatabase != "", "mongo.settingsDatabase: must not be empty")
+		positive("mongo.connectTimeout", c.Mongo.ConnectTimeout)
+		check(c.Mongo.AnalyticsTTL == 0 || c.Mongo.AnalyticsTTL >= time.Second,
+			"mongo.analyticsTTL: must be 0 or at least 1s, got %s", c.Mongo.AnalyticsTTL)
+
+		check(c.Postgres.Host != "", "postgres.host: must be set (POSTGRES_HOST)")
+		check(c.Postgres.Port > 0 && c.Postgres.Port < 65536, "postgres.port: %d is not a valid port", c.Postgres.Port)
+		check(c.Postgres.User != "", "postgres.user: must be set (POSTGRES_USER)")
+		check(c.Postgres.Database != "", "postgres.database: must be set (POSTGRES_DATABASE)")
+	case StorageEmbedded:
+		check(c.Storage.DataDir != "", "storage.dataDir: must be set for the embedded backend (STORAGE_DATA_DIR)")
+	default:
+		errs = append(errs, fmt.Errorf("storage.backend: must be external or embedded, got %q", c.Storage.Backend))
+	}
+
+	positive("api.requestTimeout", c.API.RequestTimeout)
+	positive("api.analyticsTimeout", c.API.AnalyticsTimeout)
+	check(c.API.MaxBodyBytes > 0, "api.maxBodyBytes: must be positive, got %d", c.API.MaxBodyBytes)
+	check(c.API.TopDomains >= 1 && c.API.TopDomains <= 100, "api.topDomains: must be between 1 and 100, got %d", c.API.TopDomains)
+
+	positive("etl.interval", c.ETL.Interval)
+	positive("etl.window", c.ETL.Window)
+	positive("etl.extractTimeout", c.ETL.ExtractTimeout)
+	positive("etl.loadTimeout", c.ETL.LoadTimeout)
+
+	switch c.Tracing.Exporter {
+	case ExporterNone, ExporterStdout:
+	case ExporterOTLP:
+		check(c.Tracing.Endpoint != "", "tracing.endpoint: must be set for the otlp exporter")
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter: must be none, otlp or stdout, got %q", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio: must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	check(c.Tracing.ServiceName != "", "tracing.serviceName: must not be empty")
+
+	if c.GRPC.Enabled() {
+		if _, _, err := net.SplitHostPort(c.GRPC.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("grpc.addr: %q is not a host:port address", c.GRPC.Addr))
+		}
+		check(c.GRPC.Token != "" || c.Server.TLS.ClientCAFile != "",
+			"grpc.token: must be set (GRPC_TOKEN) unless server.tls.clientCAFile is")
+		check(c.GRPC.Token == "" || c.Server.TLS.Enabled() || c.GRPC.Insecure,
+			"grpc.insecure: grpc.token would be sent in plaintext without server.tls, set it to true to allow that")
+	}
+
+	check(c.IPLinks.CacheTTL >= 0, "ipLinks.cacheTTL: must not be negative, got %s", c.IPLinks.CacheTTL)
+	check(c.IPLinks.BatchSize >= 1 && c.IPLinks.BatchSize <= 10000, "ipLinks.batchSize: must be between 1 and 10000, got %d", c.IPLinks.BatchSize)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
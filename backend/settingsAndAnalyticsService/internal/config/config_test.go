@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// valid returns the defaults completed with the settings Validate requires.
+func valid() Config {
+	cfg := Default()
+	cfg.Auth.Secret = "secret"
+	cfg.Mongo.URI = "mongodb://localhost:27017"
+	cfg.Postgres.Host = "localhost"
+	cfg.Postgres.User = "firedns"
+	cfg.Postgres.Database = "firedns"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	if cfg := valid(); cfg.Validate() != nil {
+		t.Fatalf("Validate of a complete configuration = %v", cfg.Validate())
+	}
+
+	for name, tc := range map[string]struct {
+		change func(c *Config)
+		errs   []string // Every reported problem, in order
+	}{
+		"bad address":                 {func(c *Config) { c.Server.Addr = "8080" }, []string{"server.addr"}},
+		"metrics on the API listener": {func(c *Config) { c.Server.MetricsAddr = c.Server.Addr }, []string{"server.metricsAddr: must differ"}},
+		"bad metrics address":         {func(c *Config) { c.Server.MetricsAddr = "metrics" }, []string{"server.metricsAddr"}},
+		"negative timeout":            {func(c *Config) { c.Server.ShutdownTimeout = -time.Second }, []string{"server.shutdownTimeout: must be a positive duration"}},
+		"certificate without key":     {func(c *Config) { c.Server.TLS.CertFile = "server.crt" }, []string{"server.tls: certFile and keyFile"}},
+		"client CA without TLS":       {func(c *Config) { c.Server.TLS.ClientCAFile = "ca.crt" }, []string{"server.tls.clientCAFile"}},
+		"unknown backend":             {func(c *Config) { c.Storage.Backend = "bolt" }, []string{"storage.backend"}},
+		"external without databases":  {func(c *Config) { c.Mongo.URI, c.Postgres.Host, c.Postgres.Port = "", "", 0 }, []string{"mongo.uri", "postgres.host", "postgres.port"}},
+		"embedded without data dir":   {func(c *Config) { c.Storage = Storage{Backend: StorageEmbedded} }, []string{"storage.dataDir"}},
+		"short analytics TTL":         {func(c *Config) { c.Mongo.AnalyticsTTL = time.Millisecond }, []string{"mongo.analyticsTTL"}},
+		"too many top domains":        {func(c *Config) { c.API.TopDomains = 101 }, []string{"api.topDomains"}},
+		"negative body limit":         {func(c *Config) { c.API.MaxBodyBytes = -1 }, []string{"api.maxBodyBytes"}},
+		"zero ETL interval":           {func(c *Config) { c.ETL.Interval = 0 }, []string{"etl.interval"}},
+		"unknown exporter":            {func(c *Config) { c.Tracing.Exporter = "jaeger" }, []string{"tracing.exporter"}},
+		"otlp without endpoint":       {func(c *Config) { c.Tracing.Exporter, c.Tracing.Endpoint = ExporterOTLP, "" }, []string{"tracing.endpoint"}},
+		"sample ratio above 1":        {func(c *Config) { c.Tracing.SampleRatio = 1.5 }, []string{"tracing.sampleRatio"}},
+		"gRPC without authentication": {func(c *Config) { c.GRPC.Addr = ":9090" }, []string{"grpc.token"}},
+		"bad gRPC address":            {func(c *Config) { c.GRPC = GRPC{Addr: "grpc", Token: "secret", Insecure: true} }, []string{"grpc.addr"}},
+		"gRPC token in plaintext":     {func(c *Config) { c.GRPC = GRPC{Addr: ":9090", Token: "secret"} }, []string{"grpc.insecure"}},
+		"negative cache TTL":          {func(c *Config) { c.IPLinks.CacheTTL = -time.Second }, []string{"ipLinks.cacheTTL"}},
+		"huge link batches":           {func(c *Config) { c.IPLinks.BatchSize = 10001 }, []string{"ipLinks.batchSize"}},
+		"every problem at once":       {func(c *Config) { c.Server.Addr, c.API.TopDomains, c.ETL.Window = "", 0, 0 }, []string{"server.addr", "api.topDomains", "etl.window"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := valid()
+			tc.change(&cfg)
+			err := cfg.Validate()
+			if err == nil {
+				t.Fatal("Validate succeeded")
+			}
+			problems := strings.Split(err.Error(), "\n")[1:] // After "invalid configuration:"
+			if len(problems) != len(tc.errs) {
+				t.Fatalf("Validate reported %q, want %d problems", problems, len(tc.errs))
+			}
+			for i, want := range tc.errs {
+				if !strings.HasPrefix(problems[i], want) {
+					t.Errorf("problem %d = %q, want it to start with %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// field is a configuration value that can be set from the environment and,
+// if flag is not empty, from the command line.
+type field struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var fields = []field{
+	{"HTTP_ADDR", "addr", "listen address (host:port)", str(func(c *Config) *string { return &c.Server.Addr })},
+	{"METRICS_ADDR", "metrics-addr", "admin listen address of /metrics (host:port), empty to disable", str(func(c *Config) *string { return &c.Server.MetricsAddr })},
+	{"HTTP_READ_HEADER_TIMEOUT", "", "", dur(func(c *Config) *time.Duration { return &c.Server.ReadHeaderTimeout })},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "time allowed for a graceful shutdown", dur(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+	{"TLS_CERT_FILE", "", "", str(func(c *Config) *string { return &c.Server.TLS.CertFile })},
+	{"TLS_KEY_FILE", "", "", str(func(c *Config) *string { return &c.Server.TLS.KeyFile })},
+	{"TLS_CLIENT_CA_FILE", "", "", str(func(c *Config) *string { return &c.Server.TLS.ClientCAFile })},
+
+	{"AUTH_SECRET", "", "", str(func(c *Config) *string { return &c.Auth.Secret })},
+
+	{"STORAGE_BACKEND", "storage", "storage backend: external (MongoDB and PostgreSQL) or embedded", str(func(c *Config) *string { return &c.Storage.Backend })},
+	{"STORAGE_DATA_DIR", "data-dir", "directory of the embedded storage backend", str(func(c *Config) *string { return &c.Storage.DataDir })},
+
+	{"MONGO_DB_URI", "", "", str(func(c *Config) *string { return &c.Mongo.URI })},
+	{"MONGO_ANALYTICS_DB", "analytics-db", "analytics MongoDB database name", str(func(c *Config) *string { return &c.Mongo.AnalyticsDatabase })},
+	{"MONGO_SETTINGS_DB", "settings-db", "settings MongoDB database name", str(func(c *Config) *string { return &c.Mongo.SettingsDatabase })},
+	{"MONGO_CONNECT_TIMEOUT", "", "", dur(func(c *Config) *time.Duration { return &c.Mongo.ConnectTimeout })},
+	{"MONGO_BOOTSTRAP", "", "", boolean(func(c *Config) *bool { return &c.Mongo.Bootstrap })},
+	{"MONGO_ANALYTICS_TTL", "analytics-ttl", "expiry of analytics the ETL no longer refreshes, 0 to keep them", dur(func(c *Config) *time.Duration { return &c.Mongo.AnalyticsTTL })},
+
+	{"POSTGRES_HOST", "", "", str(func(c *Config) *string { return &c.Postgres.Host })},
+	{"POSTGRES_PORT", "", "", num(func(c *Config) *int { return &c.Postgres.Port })},
+	{"POSTGRES_USER", "", "", str(func(c *Config) *string { return &c.Postgres.User })},
+	{"POSTGRES_PASSWORD", "", "", str(func(c *Config) *string { return &c.Postgres.Password })},
+	{"POSTGRES_DATABASE", "", "", str(func(c *Config) *string { return &c.Postgres.Database })},
+	{"POSTGRES_SSLMODE", "", "", str(func(c *Config) *string { return &c.Postgres.SSLMode })},
+
+	{"API_REQUEST_TIMEOUT", "request-timeout", "database timeout of settings and key requests", dur(func(c *Config) *time.Duration { return &c.API.RequestTimeout })},
+	{"API_ANALYTICS_TIMEOUT", "analytics-timeout", "database timeout of analytics and log requests", dur(func(c *Config) *time.Duration { return &c.API.AnalyticsTimeout })},
+	{"API_TOP_DOMAINS", "top-domains", "domains listed in the analytics top charts", num(func(c *Config) *int { return &c.API.TopDomains })},
+	{"API_MAX_BODY_BYTES", "", "", num(func(c *Config) *int { return &c.API.MaxBodyBytes })},
+
+	{"ETL_INTERVAL", "etl-interval", "time between analytics ETL runs", dur(func(c *Config) *time.Duration { return &c.ETL.Interval })},
+	{"ETL_WINDOW", "etl-window", "how far back the ETL counts DNS messages", dur(func(c *Config) *time.Duration { return &c.ETL.Window })},
+	{"ETL_EXTRACT_TIMEOUT", "", "", dur(func(c *Config) *time.Duration { return &c.ETL.ExtractTimeout })},
+	{"ETL_LOAD_TIMEOUT", "", "", dur(func(c *Config) *time.Duration { return &c.ETL.LoadTimeout })},
+	{"ETL_READ_LEGACY_DROPPED", "", "", boolean(func(c *Config) *bool { return &c.ETL.ReadLegacyDropped })},
+
+	{"RATE_LIMIT_USER_READ", "", "", budget(func(c *Config) *Budget { return &c.RateLimit.UserRead })},
+	{"RATE_LIMIT_USER_WRITE", "", "", budget(func(c *Config) *Budget { return &c.RateLimit.UserWrite })},
+	{"RATE_LIMIT_IP_READ", "", "", budget(func(c *Config) *Budget { return &c.RateLimit.IPRead })},
+	{"RATE_LIMIT_IP_WRITE", "", "", budget(func(c *Config) *Budget { return &c.RateLimit.IPWrite })},
+	{"RATE_LIMIT_TRUST_FORWARDED_FOR", "", "", boolean(func(c *Config) *bool { return &c.RateLimit.TrustForwardedFor })},
+
+	{"TRACING_EXPORTER", "tracing-exporter", "trace exporter: none, otlp or stdout", str(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{"TRACING_ENDPOINT", "", "", str(func(c *Config) *string { return &c.Tracing.Endpoint })},
+	{"TRACING_INSECURE", "", "", boolean(func(c *Config) *bool { return &c.Tracing.Insecure })},
+	{"TRACING_SAMPLE_RATIO", "", "", float(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+	{"TRACING_SERVICE_NAME", "", "", str(func(c *Config) *string { return &c.Tracing.ServiceName })},
+
+	{"GRPC_ADDR", "grpc-addr", "resolver gRPC listen address (host:port), empty to disable", str(func(c *Config) *string { return &c.GRPC.Addr })},
+	{"GRPC_TOKEN", "", "", str(func(c *Config) *string { return &c.GRPC.Token })},
+	{"GRPC_INSECURE", "", "", boolean(func(c *Config) *bool { return &c.GRPC.Insecure })},
+
+	{"IP_LINKS_CACHE_TTL", "", "", dur(func(c *Config) *time.Duration { return &c.IPLinks.CacheTTL })},
+	{"IP_LINKS_BATCH_SIZE", "", "", num(func(c *Config) *int { return &c.IPLinks.BatchSize })},
+}
+
+// Flags holds the configuration flags of a command line.
+type Flags struct {
+	file   string
+	values map[string]string
+}
+
+// RegisterFlags adds -config and the configuration override flags to fs.
+// Call Load once fs has been parsed.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{values: make(map[string]string)}
+	fs.StringVar(&f.file, "config", "", "path of a YAML configuration file (default $CONFIG_FILE)")
+	for _, fd := range fields {
+		if fd.flag == "" {
+			continue
+		}
+		name := fd.flag
+		fs.Func(name, fd.usage+" (env "+fd.env+")", func(value string) error {
+			// Validate now so that a bad flag is reported with usage, apply in Load
+			if err := fd.set(&Config{}, value); err != nil {
+				return err
+			}
+			f.values[name] = value
+			return nil
+		})
+	}
+	return f
+}
+
+// Load builds the configuration from the defaults, the configuration file,
+// the environment and the flags, in increasing order of precedence, and validates it.
+// A nil Flags loads without command-line overrides.
+func (f *Flags) Load() (*Config, error) {
+	cfg := Default()
+
+	file := os.Getenv("CONFIG_FILE")
+	if f != nil && f.file != "" {
+		file = f.file
+	}
+	if file != "" {
+		if err := loadFile(&cfg, file); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, fd := range fields {
+		if value, ok := os.LookupEnv(fd.env); ok && value != "" {
+			if err := fd.set(&cfg, value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", fd.env, err)
+			}
+		}
+	}
+
+	if f != nil {
+		for _, fd := range fields {
+			if value, ok := f.values[fd.flag]; ok && fd.flag != "" {
+				if err := fd.set(&cfg, value); err != nil {
+					return nil, fmt.Errorf("invalid -%s: %w", fd.flag, err)
+				}
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// loadFile overlays the values of a YAML file. Unknown keys are rejected so
+// that a misspelt key does not silently leave the default in place.
+func loadFile(cfg *Config, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error parsing config file %s: %w", file, err)
+	}
+	return nil
+}
+
+func str(get func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*get(c) = value
+		return nil
+	}
+}
+
+func dur(get func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*get(c) = d
+		return nil
+	}
+}
+
+func num(get func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*get(c) = n
+		return nil
+	}
+}
+
+func float(get func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*get(c) = f
+		return nil
+	}
+}
+
+func boolean(get func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*get(c) = b
+		return nil
+	}
+}
+
+func budget(get func(*Config) *Budget) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		b, err := ParseBudget(value)
+		if err != nil {
+			return err
+		}
+		*get(c) = b
+		return nil
+	}
+}
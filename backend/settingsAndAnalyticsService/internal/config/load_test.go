@@ -0,0 +1,159 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolate clears every variable Load reads, so that the environment of the
+// test process cannot leak into the configuration, then sets the required
+// settings and env.
+func isolate(t *testing.T, env map[string]string) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	for _, fd := range fields {
+		t.Setenv(fd.env, "") // Empty values are ignored by Load
+	}
+	// The settings Validate requires without a default
+	required := map[string]string{
+		"AUTH_SECRET":       "secret",
+		"MONGO_DB_URI":      "mongodb://localhost:27017",
+		"POSTGRES_HOST":     "localhost",
+		"POSTGRES_USER":     "firedns",
+		"POSTGRES_DATABASE": "firedns",
+	}
+	for name, value := range required {
+		t.Setenv(name, value)
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+}
+
+// load runs Load as a command would, with a configuration file holding yaml
+// (if not empty) and the given command-line arguments.
+func load(t *testing.T, yaml string, args ...string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+	if yaml != "" {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(file, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", file}, args...)
+	}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flags.Load()
+}
+
+func TestLoadLayering(t *testing.T) {
+	const file = `
+server:
+  addr: ":8081"
+etl:
+  interval: 1h
+rateLimit:
+  userRead: "5:15"
+`
+	for name, tc := range map[string]struct {
+		yaml     string
+		env      map[string]string
+		args     []string
+		addr     string
+		interval time.Duration
+		userRead Budget
+	}{
+		"defaults": {
+			addr: ":8080", interval: 24 * time.Hour, userRead: Budget{Rate: 10, Burst: 30},
+		},
+		"file over defaults": {
+			yaml: file,
+			addr: ":8081", interval: time.Hour, userRead: Budget{Rate: 5, Burst: 15},
+		},
+		"environment over file": {
+			yaml: file, env: map[string]string{"HTTP_ADDR": ":8082", "RATE_LIMIT_USER_READ": "0"},
+			addr: ":8082", interval: time.Hour,
+		},
+		"flags over environment": {
+			yaml: file, env: map[string]string{"HTTP_ADDR": ":8082", "ETL_INTERVAL": "2h"}, args: []string{"-addr", ":8083"},
+			addr: ":8083", interval: 2 * time.Hour, userRead: Budget{Rate: 5, Burst: 15},
+		},
+		"flags over defaults": {
+			args: []string{"-addr", ":8083", "-etl-interval", "30m"},
+			addr: ":8083", interval: 30 * time.Minute, userRead: Budget{Rate: 10, Burst: 30},
+		},
+		"file named by the environment": {
+			env:  map[string]string{"CONFIG_FILE": "from-env"},
+			yaml: file, // Named by -config, which takes precedence
+			addr: ":8081", interval: time.Hour, userRead: Budget{Rate: 5, Burst: 15},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			isolate(t, tc.env)
+
+			cfg, err := load(t, tc.yaml, tc.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Addr != tc.addr || cfg.ETL.Interval != tc.interval || cfg.RateLimit.UserRead != tc.userRead {
+				t.Errorf("addr %q, interval %s, userRead %+v; want %q, %s, %+v",
+					cfg.Server.Addr, cfg.ETL.Interval, cfg.RateLimit.UserRead, tc.addr, tc.interval, tc.userRead)
+			}
+			if want := Default().API; cfg.API != want {
+				t.Errorf("api = %+v, want the defaults %+v", cfg.API, want)
+			}
+		})
+	}
+}
+
+func TestExampleFileHoldsTheDefaults(t *testing.T) {
+	cfg := Default()
+	if err := loadFile(&cfg, "../../config.example.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if want := Default(); !reflect.DeepEqual(cfg, want) {
+		t.Errorf("config.example.yaml loads as\n%+v\nwant the defaults\n%+v", cfg, want)
+	}
+}
+
+func TestLoadRejectsInvalidSources(t *testing.T) {
+	for name, tc := range map[string]struct {
+		yaml string
+		env  map[string]string
+		args []string
+		err  string
+	}{
+		"unknown key":         {yaml: "server:\n  adress: \":8081\"\n", err: "field adress not found"},
+		"unknown section":     {yaml: "metrics:\n  addr: \":9091\"\n", err: "field metrics not found"},
+		"mistyped value":      {yaml: "etl:\n  interval: daily\n", err: "error parsing config file"},
+		"invalid budget":      {yaml: "rateLimit:\n  ipRead: \"50\"\n", err: "rate:burst"},
+		"invalid environment": {env: map[string]string{"ETL_WINDOW": "a day"}, err: "invalid ETL_WINDOW"},
+		"invalid value":       {env: map[string]string{"API_TOP_DOMAINS": "0"}, err: "api.topDomains"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			isolate(t, tc.env)
+
+			_, err := load(t, tc.yaml, tc.args...)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Load = %v, want an error containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestInvalidFlagsAreUsageErrors(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{})
+	RegisterFlags(fs)
+	if err := fs.Parse([]string{"-etl-interval", "daily"}); err == nil || !strings.Contains(err.Error(), "-etl-interval") {
+		t.Errorf("Parse = %v, want an error naming -etl-interval", err)
+	}
+}
@@ -2,39 +2,54 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"net/netip"
 	"time"
 
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
 )
 
 // DNSMessage represents the structure of documents in the DNSmessages collection.
 // Use appropriate types (e.g., int64 for Long, time.Time for ISODate).
+// Documents written by older resolvers hold their dropped queries in
+// LegacyDropped instead of Dropped, or in both; a query may then be in both.
 type DNSMessage struct {
 	ID            interface{}     `bson:"_id,omitempty"`
-	IP            int64           `bson:"ip"`
+	IP            IP              `bson:"ip"`
 	Passed        [][]interface{} `bson:"passed,omitempty"` // [ [domain, timestamp], ... ]
-	Dropped       [][]interface{} `bson:"dorped,omitempty"` // Typo in original data? Assuming "dropped" -> "dorped"
+	Dropped       [][]interface{} `bson:"dropped,omitempty"`
+	LegacyDropped [][]interface{} `bson:"dorped,omitempty"` // Misspelled field of older resolvers, see MigrateDroppedField
 	QuestionCount int64           `bson:"QuestionCount,omitempty"`
 }
 
+// QueryEvent is a DNS query answered by a resolver node.
+type QueryEvent struct {
+	IP      netip.Addr
+	Domain  string
+	Dropped bool
+	Time    time.Time
+}
+
 // DomainEntry holds a domain and its timestamp for ordered lists.
 type DomainEntry struct {
-	Domain    string    `bson:"domain"`
-	Timestamp time.Time `bson:"timestamp"`
+	Domain    string    `bson:"domain" json:"domain"`
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
 }
 
 // UserAnalytics represents the structure for the userAnalytics collection.
 type UserAnalytics struct {
-	UserID         string         `bson:"userId"`
-	LastUpdated    time.Time      `bson:"lastUpdated"`
-	PassedCounts   map[string]int `bson:"passedCounts"`
-	DroppedCounts  map[string]int `bson:"droppedCounts"`
-	PassedDomains  []DomainEntry  `bson:"passedDomains,omitempty"`  // Added: List of passed domains with timestamps
-	DroppedDomains []DomainEntry  `bson:"droppedDomains,omitempty"` // Added: List of dropped domains with timestamps
+	UserID         string         `bson:"userId" json:"userId"`
+	LastUpdated    time.Time      `bson:"lastUpdated" json:"lastUpdated"`
+	PassedCounts   map[string]int `bson:"passedCounts" json:"passedCounts"`
+	DroppedCounts  map[string]int `bson:"droppedCounts" json:"droppedCounts"`
+	PassedDomains  []DomainEntry  `bson:"passedDomains,omitempty" json:"passedDomains,omitempty"`   // Added: List of passed domains with timestamps
+	DroppedDomains []DomainEntry  `bson:"droppedDomains,omitempty" json:"droppedDomains,omitempty"` // Added: List of dropped domains with timestamps
 }
 
 type Analytics_DB struct {
@@ -51,32 +66,19 @@ func GetAnalyticsDB() (*Analytics_DB, error) {
 		return global_analytics_db, nil
 	}
 
-	// Initialize if not connected (consider moving Connect call elsewhere, e.g., main)
-	// For now, let's assume Connect is called externally before GetAnalyticsDB
-	db := &Analytics_DB{}
-	if err := db.Connect(); err != nil {
-		return nil, err
-	}
-	return db, nil
+	return nil, fmt.Errorf("not connected to db")
 }
 
-func (a *Analytics_DB) Connect() error {
-	// Interface on your machine.
-	// MongoDB URI and database name
-	uri := os.Getenv("MONGO_DB_URI")
-	if uri == "" {
-		return fmt.Errorf("MONGO_DB_URI environment variable not set")
-	}
-	const dbName = "FireDNSanalytics"
+func (a *Analytics_DB) Connect(cfg config.Mongo) error {
 	const dnsMessagesCollectionName = "DNSmessages"
 	const userAnalyticsCollectionName = "userAnalytics" // Added collection name
 
 	// Set client options
-	clientOptions := options.Client().ApplyURI(uri)
+	clientOptions := options.Client().ApplyURI(cfg.URI).SetMonitor(commandMonitor())
 
 	var err error
 	// Connect to MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // Added timeout
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancel()
 	a.client, err = mongo.Connect(ctx, clientOptions)
 	if err != nil {
@@ -92,10 +94,10 @@ func (a *Analytics_DB) Connect() error {
 		return fmt.Errorf("error connecting to analytics db: connection check failed: %w", err)
 	}
 
-	fmt.Println("Connected to Analytics MongoDB!")
+	zap.L().Info("Connected to analytics MongoDB")
 
 	// Get handles for the collections
-	database := a.client.Database(dbName)
+	database := a.client.Database(cfg.AnalyticsDatabase)
 	a.dnsMessagesCollection = database.Collection(dnsMessagesCollectionName)
 	a.UserAnalyticsCollection = database.Collection(userAnalyticsCollectionName) // Get handle for new collection
 
@@ -116,10 +118,40 @@ func (a *Analytics_DB) Disconnect() error {
 	}
 	a.client = nil            // Indicate disconnection
 	global_analytics_db = nil // Clear global reference
-	fmt.Println("Disconnected from Analytics MongoDB.")
+	zap.L().Info("Disconnected from analytics MongoDB")
+	return nil
+}
+
+// Ping checks that the analytics MongoDB deployment is reachable.
+func (a *Analytics_DB) Ping(ctx context.Context) error {
+	if a.client == nil {
+		return fmt.Errorf("not connected to db")
+	}
+	if err := a.client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("error pinging analytics db: %w", err)
+	}
 	return nil
 }
 
+var _ AnalyticsStore = (*Analytics_DB)(nil)
+
+// FindUserAnalytics implements AnalyticsStore.
+func (a *Analytics_DB) FindUserAnalytics(ctx context.Context, userID string) (UserAnalytics, error) {
+	if a.UserAnalyticsCollection == nil {
+		return UserAnalytics{}, fmt.Errorf("userAnalyticsCollection is not initialized")
+	}
+
+	var analytics UserAnalytics
+	err := a.UserAnalyticsCollection.FindOne(ctx, bson.M{"userId": userID}).Decode(&analytics)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return UserAnalytics{}, ErrNotFound
+	}
+	if err != nil {
+		return UserAnalytics{}, fmt.Errorf("error fetching analytics of user %s: %w", userID, err)
+	}
+	return analytics, nil
+}
+
 // FetchAllDNSMessages retrieves all documents from the DNSmessages collection.
 // Consider adding filtering or pagination for very large collections.
 func (a *Analytics_DB) FetchAllDNSMessages(ctx context.Context) ([]DNSMessage, error) {
@@ -147,19 +179,10 @@ func (a *Analytics_DB) UpsertUserAnalytics(ctx context.Context, analytics UserAn
 		return fmt.Errorf("userAnalyticsCollection is not initialized")
 	}
 
-	fmt.Println(analytics)
+	logger := logging.FromContext(ctx).With(zap.String("user_id", analytics.UserID))
+	logger.Debug("Upserting user analytics", zap.Any("analytics", analytics))
 
-	filter := bson.M{"userId": analytics.UserID}
-	update := bson.M{
-		"$set": bson.M{
-			"lastUpdated":    analytics.LastUpdated,
-			"passedCounts":   analytics.PassedCounts,
-			"droppedCounts":  analytics.DroppedCounts,
-			"passedDomains":  analytics.PassedDomains,  // Store the ordered list of passed domains
-			"droppedDomains": analytics.DroppedDomains, // Store the ordered list of dropped domains
-			// Optionally update other fields if needed
-		},
-	}
+	filter, update := userAnalyticsUpsert(analytics)
 	opts := options.Update().SetUpsert(true)
 
 	result, err := a.UserAnalyticsCollection.UpdateOne(ctx, filter, update, opts)
@@ -168,16 +191,33 @@ func (a *Analytics_DB) UpsertUserAnalytics(ctx context.Context, analytics UserAn
 	}
 
 	if result.UpsertedCount > 0 {
-		fmt.Printf("Inserted analytics for user %s\n", analytics.UserID)
+		logger.Debug("Inserted user analytics")
 	} else if result.ModifiedCount > 0 {
-		fmt.Printf("Updated analytics for user %s\n", analytics.UserID)
+		logger.Debug("Updated user analytics")
 	} else {
-		fmt.Printf("Analytics for user %s already up-to-date.\n", analytics.UserID) // This might happen if data hasn't changed
+		logger.Debug("User analytics already up-to-date") // This might happen if data hasn't changed
 	}
 
 	return nil
 }
 
+// userAnalyticsUpsert returns the filter and update of UpsertUserAnalytics.
+// Domain lists the ETL left unset are not written, rather than stored as null.
+func userAnalyticsUpsert(analytics UserAnalytics) (filter, update bson.M) {
+	set := bson.M{
+		"lastUpdated":   analytics.LastUpdated,
+		"passedCounts":  analytics.PassedCounts,
+		"droppedCounts": analytics.DroppedCounts,
+	}
+	if analytics.PassedDomains != nil {
+		set["passedDomains"] = analytics.PassedDomains // Store the ordered list of passed domains
+	}
+	if analytics.DroppedDomains != nil {
+		set["droppedDomains"] = analytics.DroppedDomains // Store the ordered list of dropped domains
+	}
+	return bson.M{"userId": analytics.UserID}, bson.M{"$set": set}
+}
+
 // Example: Renaming Update to be specific if it's for DNSMessages
 func (a *Analytics_DB) UpdateDNSMessage(ip bson.M, doc bson.M) (ID interface{}, err error) {
 	if a.dnsMessagesCollection == nil {
@@ -206,3 +246,36 @@ func (a *Analytics_DB) UpdateManyDNSMessages(updates []mongo.WriteModel) error {
 
 	return nil
 }
+
+// RecordQueryEvents appends events to the DNSmessages document of their client
+// address, creating it if needed, in the same shape the resolvers write.
+func (a *Analytics_DB) RecordQueryEvents(ctx context.Context, events []QueryEvent) error {
+	if a.dnsMessagesCollection == nil {
+		return fmt.Errorf("dnsMessagesCollection is not initialized")
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	updates := make([]mongo.WriteModel, 0, len(events))
+	for _, event := range events {
+		list := "passed"
+		if event.Dropped {
+			list = "dropped"
+		}
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"ip": IP{event.IP}}).
+			SetUpdate(bson.M{
+				"$push": bson.M{list: bson.A{event.Domain, event.Time}},
+				"$inc":  bson.M{"QuestionCount": 1},
+			}).
+			SetUpsert(true))
+	}
+
+	// Unordered, so that one failed write does not hold back the rest
+	_, err := a.dnsMessagesCollection.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return fmt.Errorf("error recording %d query events: %w", len(events), err)
+	}
+	return nil
+}
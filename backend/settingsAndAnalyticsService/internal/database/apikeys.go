@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey represents a row of the api_keys table. The plaintext key is never stored.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"userId"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // First characters of the key, used to recognise it in listings
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// APIKeyUseResolution is how old a key's last use may get before using the key
+// records it again, so that requests made with a busy key do not all write.
+const APIKeyUseResolution = time.Minute
+
+// UseIsStale reports whether a use of the key at now should be recorded.
+func (k APIKey) UseIsStale(now time.Time) bool {
+	return k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= APIKeyUseResolution
+}
+
+// CreateAPIKey stores the hash of a newly generated key for a user.
+func CreateAPIKey(ctx context.Context, userID, name, prefix, keyHash string, scopes []string) (APIKey, error) {
+	db, err := getPG()
+	if err != nil {
+		return APIKey{}, fmt.Errorf("failed to get postgres connection: %w", err)
+	}
+
+	key := APIKey{UserID: userID, Name: name, Prefix: prefix, Scopes: scopes}
+	query := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	ctx, done := observePG(ctx, "create_api_key")
+	err = db.QueryRowContext(ctx, query, userID, name, prefix, keyHash, pq.Array(scopes)).Scan(&key.ID, &key.CreatedAt)
+	done(err)
+	if err != nil {
+		return APIKey{}, fmt.Errorf("error inserting api key for user %s: %w", userID, err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns every key of a user, including revoked ones, newest first.
+func ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	db, err := getPG()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get postgres connection: %w", err)
+	}
+
+	query := `SELECT id, user_id, name, prefix, scopes, created_at, last_used_at, revoked_at
+		FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`
+
+	ctx, done := observePG(ctx, "list_api_keys")
+	rows, err := db.QueryContext(ctx, query, userID)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("error listing api keys for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var lastUsedAt, revokedAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("error scanning api key for user %s: %w", userID, err)
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Time
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing api keys for user %s: %w", userID, err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey marks a key as revoked. It returns false if the user has no active key with that ID.
+func RevokeAPIKey(ctx context.Context, userID, keyID string) (bool, error) {
+	db, err := getPG()
+	if err != nil {
+		return false, fmt.Errorf("failed to get postgres connection: %w", err)
+	}
+
+	query := "UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id::text = $1 AND user_id = $2 AND revoked_at IS NULL"
+	ctx, done := observePG(ctx, "revoke_api_key")
+	result, err := db.ExecContext(ctx, query, keyID, userID)
+	done(err)
+	if err != nil {
+		return false, fmt.Errorf("error revoking api key %s for user %s: %w", keyID, userID, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error revoking api key %s for user %s: %w", keyID, userID, err)
+	}
+	return affected > 0, nil
+}
+
+// UseAPIKey looks up an active key by its hash and records that it was used,
+// unless its last use was recorded less than APIKeyUseResolution ago.
+// It returns nil, nil when no active key matches.
+func UseAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	db, err := getPG()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get postgres connection: %w", err)
+	}
+
+	// Only a stale key is updated, so most lookups of a busy key are reads
+	query := `WITH key AS (
+			SELECT id, user_id, name, prefix, scopes, created_at, last_used_at
+			FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL
+		), used AS (
+			UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+			FROM key
+			WHERE api_keys.id = key.id
+				AND (key.last_used_at IS NULL OR key.last_used_at <= CURRENT_TIMESTAMP - make_interval(secs => $2))
+			RETURNING api_keys.last_used_at
+		)
+		SELECT id, user_id, name, prefix, scopes, created_at, COALESCE((SELECT last_used_at FROM used), last_used_at)
+		FROM key`
+
+	var key APIKey
+	var lastUsedAt time.Time
+	ctx, done := observePG(ctx, "use_api_key")
+	err = db.QueryRowContext(ctx, query, keyHash, APIKeyUseResolution.Seconds()).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedAt, &lastUsedAt)
+	done(err)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Unknown or revoked key
+		}
+		return nil, fmt.Errorf("error looking up api key: %w", err)
+	}
+	key.LastUsedAt = &lastUsedAt
+
+	return &key, nil
+}
+
+// CreateAPIKey implements APIKeyStore.
+func (Postgres_DB) CreateAPIKey(ctx context.Context, userID, name, prefix, keyHash string, scopes []string) (APIKey, error) {
+	return CreateAPIKey(ctx, userID, name, prefix, keyHash, scopes)
+}
+
+// ListAPIKeys implements APIKeyStore.
+func (Postgres_DB) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	return ListAPIKeys(ctx, userID)
+}
+
+// RevokeAPIKey implements APIKeyStore.
+func (Postgres_DB) RevokeAPIKey(ctx context.Context, userID, keyID string) (bool, error) {
+	return RevokeAPIKey(ctx, userID, keyID)
+}
+
+// UseAPIKey implements APIKeyStore.
+func (Postgres_DB) UseAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	return UseAPIKey(ctx, keyHash)
+}
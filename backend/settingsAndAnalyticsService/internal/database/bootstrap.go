@@ -0,0 +1,357 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// validationLevel applies the validators to inserts and to updates of valid
+// documents, so that documents written before a validator existed can still be updated.
+const validationLevel = "moderate"
+
+// Bootstrap actions, in BootstrapChange.Action.
+const (
+	BootstrapCreated   = "created"
+	BootstrapUpdated   = "updated"
+	BootstrapDropped   = "dropped"
+	BootstrapUnchanged = "unchanged"
+)
+
+// BootstrapChange is what BootstrapMongo did to a collection, its validator or one of its indexes.
+type BootstrapChange struct {
+	Collection string // database.collection
+	Object     string // "collection", "validator" or "index <name>"
+	Action     string
+}
+
+func (c BootstrapChange) String() string {
+	return fmt.Sprintf("%s: %s %s", c.Collection, c.Object, c.Action)
+}
+
+// BootstrapReport lists every object checked by BootstrapMongo.
+type BootstrapReport []BootstrapChange
+
+// Changed returns the changes that are not BootstrapUnchanged.
+func (r BootstrapReport) Changed() BootstrapReport {
+	var changed BootstrapReport
+	for _, change := range r {
+		if change.Action != BootstrapUnchanged {
+			changed = append(changed, change)
+		}
+	}
+	return changed
+}
+
+// mongoIndex is an index BootstrapMongo maintains. A TTL index with a zero
+// ttl is dropped rather than created.
+type mongoIndex struct {
+	keys   bson.D
+	unique bool
+	ttl    bool
+}
+
+// name returns the default name MongoDB gives to the index, e.g. "userId_1".
+func (i mongoIndex) name() string {
+	var name string
+	for n, key := range i.keys {
+		if n > 0 {
+			name += "_"
+		}
+		name += fmt.Sprintf("%s_%v", key.Key, key.Value)
+	}
+	return name
+}
+
+// mongoCollection is a collection BootstrapMongo maintains.
+type mongoCollection struct {
+	collection *mongo.Collection
+	validator  bson.D
+	indexes    []mongoIndex
+}
+
+// byUser is the index of the collections holding one document per user.
+var byUser = mongoIndex{keys: bson.D{{Key: "userId", Value: 1}}, unique: true}
+
+// BootstrapMongo creates the collections, $jsonSchema validators and indexes
+// the handlers and the ETL rely on, and brings those that differ up to date.
+// Analytics documents not refreshed by the ETL for cfg.AnalyticsTTL expire, if
+// it is not zero. It is safe to re-run: objects already in place are left
+// alone and reported as unchanged.
+//
+// A unique userId index cannot be built while a user has several documents in
+// its collection; remove the duplicates and run it again.
+func BootstrapMongo(ctx context.Context, cfg config.Mongo, analytics *Analytics_DB, settings *UserSettings_DB) (BootstrapReport, error) {
+	if analytics == nil || analytics.UserAnalyticsCollection == nil || settings == nil || settings.General == nil {
+		return nil, fmt.Errorf("not connected to db")
+	}
+
+	collections := []mongoCollection{
+		{settings.General, flagsSchema(), []mongoIndex{byUser}},
+		{settings.Privacy, flagsSchema(), []mongoIndex{byUser}},
+		{settings.Parental, parentalSchema(), []mongoIndex{byUser}},
+		{settings.DenyAllowList, listsSchema(), []mongoIndex{byUser}},
+		{analytics.UserAnalyticsCollection, userAnalyticsSchema(), []mongoIndex{
+			byUser,
+			{keys: bson.D{{Key: "lastUpdated", Value: 1}}, ttl: true},
+		}},
+		// DNS messages hold the queries of an address over time, in one document: there is no date to expire them by
+		{analytics.dnsMessagesCollection, dnsMessagesSchema(), []mongoIndex{{keys: bson.D{{Key: "ip", Value: 1}}}}},
+	}
+
+	var report BootstrapReport
+	for _, c := range collections {
+		name := c.collection.Database().Name() + "." + c.collection.Name()
+		record := func(object, action string) {
+			change := BootstrapChange{Collection: name, Object: object, Action: action}
+			report = append(report, change)
+			if action != BootstrapUnchanged {
+				zap.L().Info("Bootstrapped MongoDB", zap.String("collection", name), zap.String("object", object), zap.String("action", action))
+			}
+		}
+
+		if err := ensureValidator(ctx, c, record); err != nil {
+			return report, fmt.Errorf("error bootstrapping %s: %w", name, err)
+		}
+		for _, index := range c.indexes {
+			if err := ensureIndex(ctx, c.collection, index, cfg.AnalyticsTTL, record); err != nil {
+				return report, fmt.Errorf("error bootstrapping %s: %w", name, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// ErrMongoIndexMissing is returned by CheckMongoIndexes when a settings
+// collection lacks the unique userId index.
+var ErrMongoIndexMissing = errors.New("mongo index is missing")
+
+// CheckMongoIndexes returns an error wrapping ErrMongoIndexMissing unless every
+// settings collection has the unique userId index BootstrapMongo creates.
+// Conditional updates that may create a document rely on it to reject a
+// concurrent insert, see UpdateSettings, so it is checked at startup when
+// BootstrapMongo does not run.
+func CheckMongoIndexes(ctx context.Context, settings *UserSettings_DB) error {
+	if settings == nil || settings.General == nil {
+		return fmt.Errorf("not connected to db")
+	}
+	want, err := bson.Marshal(byUser.keys)
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range []*mongo.Collection{settings.General, settings.Privacy, settings.Parental, settings.DenyAllowList} {
+		name := collection.Database().Name() + "." + collection.Name()
+		specs, err := collection.Indexes().ListSpecifications(ctx)
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Code == namespaceNotFound {
+			specs, err = nil, nil // No collection, so no index either
+		}
+		if err != nil {
+			return fmt.Errorf("error listing indexes of %s: %w", name, err)
+		}
+		if !slices.ContainsFunc(specs, func(spec *mongo.IndexSpecification) bool {
+			return spec.Unique != nil && *spec.Unique && bytes.Equal(spec.KeysDocument, want)
+		}) {
+			return fmt.Errorf("%w: %s has no unique userId index; run the migrate command or set mongo.bootstrap", ErrMongoIndexMissing, name)
+		}
+	}
+	return nil
+}
+
+// namespaceNotFound is the code of the error of commands on a missing collection.
+const namespaceNotFound = 26
+
+// ensureValidator creates the collection with its validator, or replaces the
+// validator of an existing collection if it differs.
+func ensureValidator(ctx context.Context, c mongoCollection, record func(object, action string)) error {
+	db := c.collection.Database()
+	specs, err := db.ListCollectionSpecifications(ctx, bson.D{{Key: "name", Value: c.collection.Name()}})
+	if err != nil {
+		return fmt.Errorf("error listing collections: %w", err)
+	}
+
+	if len(specs) == 0 {
+		opts := options.CreateCollection().SetValidator(c.validator).SetValidationLevel(validationLevel)
+		if err := db.CreateCollection(ctx, c.collection.Name(), opts); err != nil {
+			return fmt.Errorf("error creating collection: %w", err)
+		}
+		record("collection", BootstrapCreated)
+		return nil
+	}
+
+	want, err := bson.Marshal(c.validator)
+	if err != nil {
+		return err
+	}
+	current, _ := specs[0].Options.Lookup("validator").DocumentOK()
+	level, _ := specs[0].Options.Lookup("validationLevel").StringValueOK()
+	if bytes.Equal(current, want) && level == validationLevel {
+		record("validator", BootstrapUnchanged)
+		return nil
+	}
+
+	command := bson.D{
+		{Key: "collMod", Value: c.collection.Name()},
+		{Key: "validator", Value: c.validator},
+		{Key: "validationLevel", Value: validationLevel},
+	}
+	if err := db.RunCommand(ctx, command).Err(); err != nil {
+		return fmt.Errorf("error updating validator: %w", err)
+	}
+	if len(current) == 0 {
+		record("validator", BootstrapCreated)
+	} else {
+		record("validator", BootstrapUpdated)
+	}
+	return nil
+}
+
+// ensureIndex creates a missing index, updates the expiry of a TTL index to
+// ttl, or drops it if ttl is zero.
+func ensureIndex(ctx context.Context, collection *mongo.Collection, index mongoIndex, ttl time.Duration, record func(object, action string)) error {
+	name := index.name()
+	object := "index " + name
+
+	specs, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing indexes: %w", err)
+	}
+	var existing *mongo.IndexSpecification
+	for _, spec := range specs {
+		if spec.Name == name {
+			existing = spec
+		}
+	}
+	expireAfter := int32(ttl / time.Second)
+
+	switch {
+	case existing == nil && index.ttl && expireAfter == 0:
+		return nil // Disabled and absent
+	case existing == nil:
+		opts := options.Index().SetName(name)
+		if index.unique {
+			opts.SetUnique(true)
+		}
+		if index.ttl {
+			opts.SetExpireAfterSeconds(expireAfter)
+		}
+		if _, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: index.keys, Options: opts}); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return fmt.Errorf("cannot create unique index %s, some users have several documents: %w", name, err)
+			}
+			return fmt.Errorf("error creating index %s: %w", name, err)
+		}
+		record(object, BootstrapCreated)
+	case (existing.Unique != nil && *existing.Unique) != index.unique:
+		return fmt.Errorf("index %s exists with unique=%t, drop it to let it be recreated", name, !index.unique)
+	case index.ttl && expireAfter == 0:
+		if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+			return fmt.Errorf("error dropping index %s: %w", name, err)
+		}
+		record(object, BootstrapDropped)
+	case index.ttl && (existing.ExpireAfterSeconds == nil || *existing.ExpireAfterSeconds != expireAfter):
+		if existing.ExpireAfterSeconds == nil {
+			return fmt.Errorf("index %s exists without an expiry, drop it to let it be recreated", name)
+		}
+		command := bson.D{
+			{Key: "collMod", Value: collection.Name()},
+			{Key: "index", Value: bson.D{{Key: "name", Value: name}, {Key: "expireAfterSeconds", Value: expireAfter}}},
+		}
+		if err := collection.Database().RunCommand(ctx, command).Err(); err != nil {
+			return fmt.Errorf("error updating expiry of index %s: %w", name, err)
+		}
+		record(object, BootstrapUpdated)
+	default:
+		record(object, BootstrapUnchanged)
+	}
+	return nil
+}
+
+// The validators check the fields the service reads and let others through,
+// so that documents written by other tools or older versions remain valid.
+
+// jsonSchema returns a validator for documents with the required fields and
+// the given properties, each a bsonType or a list of them.
+func jsonSchema(required []string, properties bson.D, extra ...bson.E) bson.D {
+	schema := bson.D{
+		{Key: "bsonType", Value: "object"},
+		{Key: "required", Value: required},
+		{Key: "properties", Value: properties},
+	}
+	return bson.D{{Key: "$jsonSchema", Value: append(schema, extra...)}}
+}
+
+// ofType is the schema of a property of one of the given bsonTypes.
+func ofType(types ...string) bson.D {
+	if len(types) == 1 {
+		return bson.D{{Key: "bsonType", Value: types[0]}}
+	}
+	return bson.D{{Key: "bsonType", Value: types}}
+}
+
+// settingsProperties are the properties of every settings document.
+func settingsProperties(properties ...bson.E) bson.D {
+	return append(bson.D{
+		{Key: "_id", Value: ofType("objectId")},
+		{Key: "userId", Value: ofType("string")},
+		{Key: revisionField, Value: ofType("int", "long")},
+	}, properties...)
+}
+
+// flagsSchema validates the general and privacy settings, whose fields are all toggles.
+func flagsSchema() bson.D {
+	return jsonSchema([]string{"userId"}, settingsProperties(),
+		bson.E{Key: "additionalProperties", Value: ofType("bool")})
+}
+
+func parentalSchema() bson.D {
+	return jsonSchema([]string{"userId"}, settingsProperties(
+		bson.E{Key: "blockedApps", Value: bson.D{
+			{Key: "bsonType", Value: []string{"object", "null"}},
+			{Key: "additionalProperties", Value: ofType("bool")},
+		}},
+		bson.E{Key: "recreationSchedule", Value: ofType("object", "null")},
+	))
+}
+
+func listsSchema() bson.D {
+	domains := bson.D{
+		{Key: "bsonType", Value: []string{"array", "null"}},
+		{Key: "items", Value: ofType("string")},
+	}
+	return jsonSchema([]string{"userId"}, settingsProperties(
+		bson.E{Key: string(DenyList), Value: domains},
+		bson.E{Key: string(AllowList), Value: domains},
+	))
+}
+
+func userAnalyticsSchema() bson.D {
+	return jsonSchema([]string{"userId", "lastUpdated"}, bson.D{
+		{Key: "userId", Value: ofType("string")},
+		{Key: "lastUpdated", Value: ofType("date")},
+		{Key: "passedCounts", Value: ofType("object", "null")},
+		{Key: "droppedCounts", Value: ofType("object", "null")},
+		{Key: "passedDomains", Value: ofType("array", "null")},
+		{Key: "droppedDomains", Value: ofType("array", "null")},
+	})
+}
+
+func dnsMessagesSchema() bson.D {
+	return jsonSchema([]string{"ip"}, bson.D{
+		{Key: "ip", Value: ofType("int", "long", "string")}, // See IP
+		{Key: "passed", Value: ofType("array")},
+		{Key: "dropped", Value: ofType("array")},
+		{Key: "dorped", Value: ofType("array")}, // Until MigrateDroppedField has run
+		{Key: "QuestionCount", Value: ofType("int", "long")},
+	})
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DroppedMigration is the progress of MigrateDroppedField.
+type DroppedMigration struct {
+	Total    int64 // Documents holding the legacy field when the run started
+	Migrated int64 // Documents rewritten so far by this run
+}
+
+// legacyDropped selects the documents still holding the misspelled field.
+var legacyDropped = bson.M{"dorped": bson.M{"$exists": true}}
+
+// MigrateDroppedField moves the dropped queries of the misspelled dorped field
+// of DNS messages to dropped, batchSize documents at a time, calling progress
+// after each batch. A rewritten document no longer holds dorped, so an
+// interrupted run is resumed by running it again. Queries the resolvers
+// record meanwhile are kept, the legacy entries not already among them are
+// appended to them.
+func (a *Analytics_DB) MigrateDroppedField(ctx context.Context, batchSize int, progress func(DroppedMigration)) (DroppedMigration, error) {
+	var status DroppedMigration
+	if a.dnsMessagesCollection == nil {
+		return status, fmt.Errorf("dnsMessagesCollection is not initialized")
+	}
+	if batchSize <= 0 {
+		return status, fmt.Errorf("batch size must be positive, got %d", batchSize)
+	}
+
+	total, err := a.dnsMessagesCollection.CountDocuments(ctx, legacyDropped)
+	if err != nil {
+		return status, fmt.Errorf("error counting DNS messages to migrate: %w", err)
+	}
+	status.Total = total
+
+	dropped := bson.M{"$ifNull": bson.A{"$dropped", bson.A{}}}
+	rewrite := bson.A{
+		bson.M{"$set": bson.M{"dropped": bson.M{"$concatArrays": bson.A{
+			dropped,
+			bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$dorped", bson.A{}}},
+				"cond":  bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this", dropped}}}},
+			}},
+		}}}},
+		bson.M{"$unset": "dorped"},
+	}
+	find := options.Find().
+		SetProjection(bson.M{"_id": 1}).
+		SetSort(bson.M{"_id": 1}).
+		SetLimit(int64(batchSize))
+
+	var last interface{}
+	for {
+		filter := legacyDropped
+		if last != nil {
+			filter = bson.M{"dorped": bson.M{"$exists": true}, "_id": bson.M{"$gt": last}}
+		}
+		cursor, err := a.dnsMessagesCollection.Find(ctx, filter, find)
+		if err != nil {
+			return status, fmt.Errorf("error finding DNS messages to migrate: %w", err)
+		}
+		var batch []struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &batch); err != nil {
+			return status, fmt.Errorf("error decoding DNS messages to migrate: %w", err)
+		}
+		if len(batch) == 0 {
+			return status, nil
+		}
+
+		ids := make(bson.A, len(batch))
+		for i, doc := range batch {
+			ids[i] = doc.ID
+		}
+		// The filter keeps a document rewritten by a concurrent run from being appended twice
+		result, err := a.dnsMessagesCollection.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": ids}, "dorped": bson.M{"$exists": true}}, rewrite)
+		if err != nil {
+			return status, fmt.Errorf("error migrating %d DNS messages: %w", len(ids), err)
+		}
+		status.Migrated += result.ModifiedCount
+		last = ids[len(ids)-1]
+		if progress != nil {
+			progress(status)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LinkedIP is a row of the linked_ips table.
+type LinkedIP struct {
+	IP   string    `json:"ip"`
+	Time time.Time `json:"time"`
+}
+
+// UserExport is everything the service stores about one user.
+// Settings documents are kept as stored so that the export survives schema changes.
+type UserExport struct {
+	UserID     string            `json:"userId"`
+	ExportedAt time.Time         `json:"exportedAt"`
+	Settings   map[string]bson.M `json:"settings"` // Keyed by collection name, missing collections are omitted
+	Analytics  *UserAnalytics    `json:"analytics,omitempty"`
+	APIKeys    []APIKey          `json:"apiKeys"`
+	LinkedIPs  []LinkedIP        `json:"linkedIps"`
+}
+
+// ListLinkedIPs returns the addresses linked to a user, oldest first.
+func ListLinkedIPs(ctx context.Context, userID string) ([]LinkedIP, error) {
+	db, err := getPG()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get postgres connection: %w", err)
+	}
+
+	query := "SELECT ip, time FROM linked_ips WHERE user_id = $1 ORDER BY time"
+	ctx, done := observePG(ctx, "list_linked_ips")
+	rows, err := db.QueryContext(ctx, query, userID)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("error listing linked ips for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	ips := []LinkedIP{}
+	for rows.Next() {
+		var ip LinkedIP
+		if err := rows.Scan(&ip.IP, &ip.Time); err != nil {
+			return nil, fmt.Errorf("error scanning linked ip for user %s: %w", userID, err)
+		}
+		ips = append(ips, ip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing linked ips for user %s: %w", userID, err)
+	}
+	return ips, nil
+}
+
+// ExportUser collects a user's settings, analytics, API keys (without their hashes) and linked IPs.
+func ExportUser(ctx context.Context, analytics *Analytics_DB, settings *UserSettings_DB, userID string) (*UserExport, error) {
+	export := &UserExport{
+		UserID:     userID,
+		ExportedAt: time.Now().UTC(),
+		Settings:   make(map[string]bson.M),
+	}
+
+	filter := bson.M{"userId": userID}
+	for _, collection := range []*mongo.Collection{settings.General, settings.Privacy, settings.Parental, settings.DenyAllowList} {
+		var doc bson.M
+		err := collection.FindOne(ctx, filter).Decode(&doc)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s settings of user %s: %w", collection.Name(), userID, err)
+		}
+		delete(doc, "_id")
+		export.Settings[collection.Name()] = doc
+	}
+
+	var userAnalytics UserAnalytics
+	err := analytics.UserAnalyticsCollection.FindOne(ctx, filter).Decode(&userAnalytics)
+	switch {
+	case err == nil:
+		export.Analytics = &userAnalytics
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return nil, fmt.Errorf("error reading analytics of user %s: %w", userID, err)
+	}
+
+	if export.APIKeys, err = ListAPIKeys(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.LinkedIPs, err = ListLinkedIPs(ctx, userID); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
@@ -0,0 +1,7 @@
+package database
+
+// Exported for the tests of package database_test, which run the ETL.
+var (
+	UserAnalyticsSchema = userAnalyticsSchema
+	UserAnalyticsUpsert = userAnalyticsUpsert
+)
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// ParseIP parses a client address, IPv4 or IPv6. IPv4-mapped IPv6 addresses
+// are returned as IPv4 and zones are dropped, so that a client has one form.
+func ParseIP(s string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%q is not an IP address", s)
+	}
+	return addr.Unmap().WithZone(""), nil
+}
+
+// ParseNetwork parses the ip of a linked_ips row: an address, linked as the
+// network of its full length, or a network in CIDR notation. Host bits are
+// cleared, as the network function of PostgreSQL does.
+func ParseNetwork(s string) (netip.Prefix, error) {
+	if addr, err := ParseIP(s); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%q is neither an IP address nor a network", s)
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// IP is a client address as stored in the ip field of DNS messages: IPv4
+// addresses in the integer form the resolvers have always written, IPv6
+// addresses as text.
+type IP struct {
+	netip.Addr
+}
+
+// MarshalBSONValue implements bson.ValueMarshaler.
+func (ip IP) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	addr := ip.Unmap()
+	switch {
+	case addr.Is4():
+		b := addr.As4()
+		return bson.MarshalValue(int64(binary.BigEndian.Uint32(b[:])))
+	case addr.Is6():
+		return bson.MarshalValue(addr.WithZone("").String())
+	}
+	return 0, nil, fmt.Errorf("cannot store an invalid IP address")
+}
+
+// UnmarshalBSONValue implements bson.ValueUnmarshaler.
+func (ip *IP) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bson.TypeInt32, bson.TypeInt64:
+		n, _ := value.AsInt64OK()
+		if n < 0 || n > math.MaxUint32 {
+			return fmt.Errorf("%d is not an integer IPv4 address", n)
+		}
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n))
+		ip.Addr = netip.AddrFrom4(b)
+	case bson.TypeString:
+		addr, err := ParseIP(value.StringValue())
+		if err != nil {
+			return err
+		}
+		ip.Addr = addr
+	default:
+		return fmt.Errorf("cannot decode an IP address from BSON %s", t)
+	}
+	return nil
+}
+
+// LinkInterval is a period during which a network was linked to a user. A
+// link holds its network until the network is linked again, to anyone.
+type LinkInterval struct {
+	UserID  string
+	Network netip.Prefix
+	From    time.Time
+	Until   time.Time // Zero while the link is current
+}
+
+// Contains reports whether the link held its network at t.
+func (l LinkInterval) Contains(t time.Time) bool {
+	return !t.Before(l.From) && (l.Until.IsZero() || t.Before(l.Until))
+}
+
+// Overlaps reports whether the link held its network at some time between
+// from and to, as IPLinkStore.LinkHistories selects links. A zero to has no
+// upper bound.
+func (l LinkInterval) Overlaps(from, to time.Time) bool {
+	return (l.Until.IsZero() || l.Until.After(from)) && (to.IsZero() || !l.From.After(to))
+}
+
+// LinkHistory holds the intervals of the networks containing an address.
+type LinkHistory []LinkInterval
+
+// UserAt returns the user the address was linked to at t, through the most
+// specific network linked at that time, or "" if it was not linked.
+func (h LinkHistory) UserAt(t time.Time) string {
+	var userID string
+	bits := -1
+	for _, link := range h {
+		if link.Network.Bits() > bits && link.Contains(t) {
+			userID, bits = link.UserID, link.Network.Bits()
+		}
+	}
+	return userID
+}
+
+// Link is a row of linked_ips: a network linked to a user at a time.
+type Link struct {
+	UserID  string
+	Network netip.Prefix
+	Time    time.Time
+}
+
+// LinkIntervals returns the validity intervals of links, as the
+// linked_ip_intervals view does for the linked_ips table.
+func LinkIntervals(links []Link) []LinkInterval {
+	sorted := slices.Clone(links)
+	slices.SortStableFunc(sorted, func(a, b Link) int { return a.Time.Compare(b.Time) })
+
+	intervals := make([]LinkInterval, len(sorted))
+	latest := make(map[netip.Prefix]int) // Interval of the last link of each network so far
+	for i, link := range sorted {
+		network := link.Network.Masked()
+		if previous, ok := latest[network]; ok {
+			intervals[previous].Until = link.Time
+		}
+		latest[network] = i
+		intervals[i] = LinkInterval{UserID: link.UserID, Network: network, From: link.Time}
+	}
+	return intervals
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIPBSON(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		stored  any // The ip field as written to MongoDB
+	}{
+		{"192.0.2.1", int64(0xc0000201)},
+		{"::ffff:192.0.2.1", int64(0xc0000201)},
+		{"2001:db8::1", "2001:db8::1"},
+		{"2001:0db8:0000::0001", "2001:db8::1"},
+	} {
+		t.Run(tc.address, func(t *testing.T) {
+			data, err := bson.Marshal(DNSMessage{IP: IP{netip.MustParseAddr(tc.address)}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc bson.M
+			if err := bson.Unmarshal(data, &doc); err != nil {
+				t.Fatal(err)
+			}
+			if doc["ip"] != tc.stored {
+				t.Fatalf("stored ip = %#v, want %#v", doc["ip"], tc.stored)
+			}
+
+			var msg DNSMessage
+			if err := bson.Unmarshal(data, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if want := netip.MustParseAddr(tc.address).Unmap(); msg.IP.Addr != want {
+				t.Fatalf("decoded ip = %s, want %s", msg.IP, want)
+			}
+		})
+	}
+}
+
+func TestIPBSONLegacyDocuments(t *testing.T) {
+	for _, ip := range []any{int32(0x0a000001), int64(0x0a000001)} {
+		data, err := bson.Marshal(bson.M{"ip": ip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg DNSMessage
+		if err := bson.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.IP.String() != "10.0.0.1" {
+			t.Errorf("ip %T decoded as %s, want 10.0.0.1", ip, msg.IP)
+		}
+	}
+
+	for _, ip := range []any{int64(-1), int64(1 << 32), "not an address", true} {
+		data, err := bson.Marshal(bson.M{"ip": ip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg DNSMessage
+		if err := bson.Unmarshal(data, &msg); err == nil {
+			t.Errorf("ip %#v decoded as %s, want an error", ip, msg.IP)
+		}
+	}
+}
+
+func TestLinkHistory(t *testing.T) {
+	day := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) time.Time { return day.Add(time.Duration(hour) * time.Hour) }
+	home := netip.MustParsePrefix("2001:db8::/56")
+
+	// The dynamic address moves from alice to bob at 12:00; carol linked the whole prefix before
+	history := LinkHistory(LinkIntervals([]Link{
+		{UserID: "bob", Network: netip.MustParsePrefix("2001:db8::1/128"), Time: at(12)},
+		{UserID: "alice", Network: netip.MustParsePrefix("2001:db8::1/128"), Time: at(6)},
+		{UserID: "carol", Network: netip.MustParsePrefix("2001:db8::ff/56"), Time: at(0)},
+	}))
+	if history[0].Network != home || !history[0].Until.IsZero() {
+		t.Fatalf("carol's interval = %+v, want the current link of %s", history[0], home)
+	}
+	if !history[1].Until.Equal(at(12)) || !history[2].Until.IsZero() {
+		t.Fatalf("intervals = %+v, want alice's link to end at 12:00 and bob's to be current", history)
+	}
+
+	for hour, want := range map[int]string{-1: "", 0: "carol", 5: "carol", 6: "alice", 11: "alice", 12: "bob", 23: "bob"} {
+		if got := history.UserAt(at(hour)); got != want {
+			t.Errorf("UserAt(%02d:00) = %q, want %q", hour, got, want)
+		}
+	}
+}
+
+func TestParseNetwork(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"192.0.2.1", "192.0.2.1/32"},
+		{"::ffff:192.0.2.1", "192.0.2.1/32"},
+		{"192.0.2.77/24", "192.0.2.0/24"},
+		{"::ffff:192.0.2.0/120", "192.0.2.0/24"},
+		{"2001:db8::1/56", "2001:db8::/56"},
+	} {
+		got, err := ParseNetwork(tc.in)
+		if err != nil || got.String() != tc.want {
+			t.Errorf("ParseNetwork(%q) = %s, %v, want %s", tc.in, got, err, tc.want)
+		}
+	}
+	for _, in := range []string{"", "192.0.2.0/33", "example.com"} {
+		if _, err := ParseNetwork(in); err == nil {
+			t.Errorf("ParseNetwork(%q) succeeded", in)
+		}
+	}
+}
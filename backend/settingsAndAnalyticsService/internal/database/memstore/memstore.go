@@ -0,0 +1,486 @@
+// Package memstore implements the database stores in memory, for tests and
+// for running the service without MongoDB or PostgreSQL. Documents go through
+// BSON as they would in MongoDB, so that handlers see the same field names,
+// defaults and types.
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Store implements every store of database.Stores. The zero value is not
+// usable; create stores with New.
+type Store struct {
+	mu        sync.Mutex
+	err       error
+	settings  map[settingsKey]bson.Raw
+	lists     map[string]database.DomainLists
+	analytics map[string]database.UserAnalytics
+	messages  map[netip.Addr]*database.DNSMessage
+	links     []database.Link
+	keys      []apiKey
+	nextKeyID int
+}
+
+type settingsKey struct {
+	category database.SettingsCategory
+	userID   string
+}
+
+type apiKey struct {
+	database.APIKey
+	hash string
+}
+
+var (
+	_ database.SettingsStore  = (*Store)(nil)
+	_ database.ListStore      = (*Store)(nil)
+	_ database.AnalyticsStore = (*Store)(nil)
+	_ database.IPLinkStore    = (*Store)(nil)
+	_ database.APIKeyStore    = (*Store)(nil)
+)
+
+// New returns an empty store.
+func New() *Store {
+	return &Store{
+		settings:  make(map[settingsKey]bson.Raw),
+		lists:     make(map[string]database.DomainLists),
+		analytics: make(map[string]database.UserAnalytics),
+		messages:  make(map[netip.Addr]*database.DNSMessage),
+	}
+}
+
+// Stores returns s as every store of the API.
+func (s *Store) Stores() database.Stores {
+	return database.Stores{Settings: s, Lists: s, Analytics: s, IPLinks: s, APIKeys: s}
+}
+
+// Fail makes every later call return err, as an unreachable database would.
+// Fail(nil) restores the store.
+func (s *Store) Fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// LinkIP links the addresses of network to a user at a time, as a new row of
+// linked_ips would. Link a single address with a prefix of its full length,
+// e.g. netip.MustParsePrefix("192.0.2.1/32").
+func (s *Store) LinkIP(network netip.Prefix, userID string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links = append(s.links, database.Link{UserID: userID, Network: network.Masked(), Time: at})
+}
+
+// lock acquires the store and returns the error set by Fail, if any. The
+// caller unlocks it in both cases.
+func (s *Store) lock() error {
+	s.mu.Lock()
+	return s.err
+}
+
+// FindSettings implements database.SettingsStore.
+func (s *Store) FindSettings(ctx context.Context, category database.SettingsCategory, userID string, result any) error {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	raw, ok := s.settings[settingsKey{category, userID}]
+	if !ok {
+		return database.ErrNotFound
+	}
+	return bson.Unmarshal(raw, result)
+}
+
+// UpdateSettings implements database.SettingsStore.
+func (s *Store) UpdateSettings(ctx context.Context, category database.SettingsCategory, userID string, fields map[string]any, revisions []int64, result any) error {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	key := settingsKey{category, userID}
+	doc, err := s.document(key)
+	if err != nil {
+		return err
+	}
+	if len(revisions) > 0 && !slices.Contains(revisions, revision(doc)) {
+		return database.ErrRevisionMismatch
+	}
+
+	raw, err := s.write(key, doc, fields)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, result)
+}
+
+// ReplaceSettings implements database.SettingsStore. The store is locked for
+// the whole replacement, so it is as atomic as the MongoDB transaction.
+func (s *Store) ReplaceSettings(ctx context.Context, userID string, categories map[database.SettingsCategory]map[string]any, lists database.DomainLists) error {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Encode everything first, so that a failure leaves the store unchanged
+	updated := make(map[settingsKey]bson.Raw, len(categories))
+	for category, fields := range categories {
+		key := settingsKey{category, userID}
+		doc, err := s.document(key)
+		if err != nil {
+			return err
+		}
+		if updated[key], err = encode(key, doc, fields); err != nil {
+			return err
+		}
+	}
+	for key, raw := range updated {
+		s.settings[key] = raw
+	}
+	s.lists[userID] = database.DomainLists{Denied: slices.Clone(lists.Denied), Allowed: slices.Clone(lists.Allowed)}
+	return nil
+}
+
+// document decodes the stored settings of key, or returns nil if there are none.
+func (s *Store) document(key settingsKey) (bson.M, error) {
+	raw, ok := s.settings[key]
+	if !ok {
+		return nil, nil
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("error decoding %s settings: %w", key.category, err)
+	}
+	return doc, nil
+}
+
+// write sets fields on doc, increments its revision and stores it under key.
+func (s *Store) write(key settingsKey, doc bson.M, fields map[string]any) (bson.Raw, error) {
+	raw, err := encode(key, doc, fields)
+	if err != nil {
+		return nil, err
+	}
+	s.settings[key] = raw
+	return raw, nil
+}
+
+// encode returns doc, created if nil, with fields set and its revision incremented.
+func encode(key settingsKey, doc bson.M, fields map[string]any) (bson.Raw, error) {
+	if doc == nil {
+		doc = bson.M{"userId": key.userID}
+	}
+	for name, value := range fields {
+		doc[name] = value
+	}
+	doc["revision"] = revision(doc) + 1
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s settings: %w", key.category, err)
+	}
+	return raw, nil
+}
+
+// revision returns the revision of a settings document, 0 if it has none.
+func revision(doc bson.M) int64 {
+	switch value := doc["revision"].(type) {
+	case int64:
+		return value
+	case int32:
+		return int64(value)
+	default:
+		return 0
+	}
+}
+
+// FindLists implements database.ListStore.
+func (s *Store) FindLists(ctx context.Context, userID string) (database.DomainLists, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return database.DomainLists{}, err
+	}
+	lists := s.lists[userID]
+	return database.DomainLists{Denied: slices.Clone(lists.Denied), Allowed: slices.Clone(lists.Allowed)}, nil
+}
+
+// AddDomain implements database.ListStore.
+func (s *Store) AddDomain(ctx context.Context, userID string, list database.DomainList, domain string) (bool, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+	lists := s.lists[userID]
+	domains, err := listOf(&lists, list)
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(*domains, domain) {
+		s.lists[userID] = lists
+		return false, nil
+	}
+	*domains = append(*domains, domain)
+	s.lists[userID] = lists
+	return true, nil
+}
+
+// RemoveDomain implements database.ListStore.
+func (s *Store) RemoveDomain(ctx context.Context, userID string, list database.DomainList, domain string) (bool, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+	lists, ok := s.lists[userID]
+	if !ok {
+		return false, database.ErrNotFound
+	}
+	domains, err := listOf(&lists, list)
+	if err != nil {
+		return false, err
+	}
+	i := slices.Index(*domains, domain)
+	if i < 0 {
+		return false, nil
+	}
+	*domains = slices.Delete(slices.Clone(*domains), i, i+1)
+	s.lists[userID] = lists
+	return true, nil
+}
+
+func listOf(lists *database.DomainLists, list database.DomainList) (*[]string, error) {
+	switch list {
+	case database.DenyList:
+		return &lists.Denied, nil
+	case database.AllowList:
+		return &lists.Allowed, nil
+	default:
+		return nil, fmt.Errorf("unknown domain list %q", list)
+	}
+}
+
+// FindUserAnalytics implements database.AnalyticsStore.
+func (s *Store) FindUserAnalytics(ctx context.Context, userID string) (database.UserAnalytics, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return database.UserAnalytics{}, err
+	}
+	analytics, ok := s.analytics[userID]
+	if !ok {
+		return database.UserAnalytics{}, database.ErrNotFound
+	}
+	return analytics, nil
+}
+
+// UpsertUserAnalytics implements database.AnalyticsStore.
+func (s *Store) UpsertUserAnalytics(ctx context.Context, analytics database.UserAnalytics) error {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.analytics[analytics.UserID] = analytics
+	return nil
+}
+
+// FetchAllDNSMessages implements database.AnalyticsStore. Messages are
+// returned by address, with their timestamps as MongoDB returns them.
+func (s *Store) FetchAllDNSMessages(ctx context.Context) ([]database.DNSMessage, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]database.DNSMessage, 0, len(s.messages))
+	for _, msg := range s.messages {
+		messages = append(messages, database.DNSMessage{
+			IP:            database.IP{Addr: msg.IP.Addr},
+			Passed:        slices.Clone(msg.Passed),
+			Dropped:       slices.Clone(msg.Dropped),
+			LegacyDropped: slices.Clone(msg.LegacyDropped),
+			QuestionCount: msg.QuestionCount,
+		})
+	}
+	slices.SortFunc(messages, func(a, b database.DNSMessage) int { return a.IP.Compare(b.IP.Addr) })
+	return messages, nil
+}
+
+// RecordQueryEvents implements database.AnalyticsStore.
+func (s *Store) RecordQueryEvents(ctx context.Context, events []database.QueryEvent) error {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		msg, ok := s.messages[event.IP]
+		if !ok {
+			msg = &database.DNSMessage{IP: database.IP{Addr: event.IP}}
+			s.messages[event.IP] = msg
+		}
+		entry := []interface{}{event.Domain, primitive.NewDateTimeFromTime(event.Time)}
+		if event.Dropped {
+			msg.Dropped = append(msg.Dropped, entry)
+		} else {
+			msg.Passed = append(msg.Passed, entry)
+		}
+		msg.QuestionCount++
+	}
+	return nil
+}
+
+// UserIDByIP implements database.IPLinkStore.
+func (s *Store) UserIDByIP(ctx context.Context, ip netip.Addr) (string, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	return s.userIDByIP(ip), nil
+}
+
+// UserIDsByIP implements database.IPLinkStore.
+func (s *Store) UserIDsByIP(ctx context.Context, ips []netip.Addr) (map[netip.Addr]string, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[netip.Addr]string)
+	for _, ip := range ips {
+		if userID := s.userIDByIP(ip); userID != "" {
+			users[ip] = userID
+		}
+	}
+	return users, nil
+}
+
+// LinkHistories implements database.IPLinkStore.
+func (s *Store) LinkHistories(ctx context.Context, ips []netip.Addr, from, to time.Time) (map[netip.Addr]database.LinkHistory, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	histories := make(map[netip.Addr]database.LinkHistory)
+	for _, ip := range ips {
+		for _, link := range s.history(ip) {
+			if link.Overlaps(from, to) {
+				histories[ip] = append(histories[ip], link)
+			}
+		}
+	}
+	return histories, nil
+}
+
+// userIDByIP returns the user of the current link of the most specific network containing ip.
+func (s *Store) userIDByIP(ip netip.Addr) string {
+	var userID string
+	bits := -1
+	for _, link := range s.history(ip) {
+		if link.Until.IsZero() && link.Network.Bits() > bits {
+			userID, bits = link.UserID, link.Network.Bits()
+		}
+	}
+	return userID
+}
+
+// history returns the intervals of the networks containing ip, oldest first.
+func (s *Store) history(ip netip.Addr) database.LinkHistory {
+	var history database.LinkHistory
+	for _, link := range database.LinkIntervals(s.links) {
+		if link.Network.Contains(ip.Unmap()) {
+			history = append(history, link)
+		}
+	}
+	return history
+}
+
+// CreateAPIKey implements database.APIKeyStore.
+func (s *Store) CreateAPIKey(ctx context.Context, userID, name, prefix, keyHash string, scopes []string) (database.APIKey, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return database.APIKey{}, err
+	}
+	s.nextKeyID++
+	key := database.APIKey{
+		ID:        strconv.Itoa(s.nextKeyID),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    slices.Clone(scopes),
+		CreatedAt: time.Now().UTC(),
+	}
+	s.keys = append(s.keys, apiKey{APIKey: key, hash: keyHash})
+	return key, nil
+}
+
+// ListAPIKeys implements database.APIKeyStore.
+func (s *Store) ListAPIKeys(ctx context.Context, userID string) ([]database.APIKey, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	keys := []database.APIKey{}
+	for i := len(s.keys) - 1; i >= 0; i-- { // Newest first
+		if s.keys[i].UserID == userID {
+			keys = append(keys, s.keys[i].APIKey)
+		}
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey implements database.APIKeyStore.
+func (s *Store) RevokeAPIKey(ctx context.Context, userID, keyID string) (bool, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+	for i := range s.keys {
+		key := &s.keys[i]
+		if key.ID == keyID && key.UserID == userID && key.RevokedAt == nil {
+			now := time.Now().UTC()
+			key.RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UseAPIKey implements database.APIKeyStore.
+func (s *Store) UseAPIKey(ctx context.Context, keyHash string) (*database.APIKey, error) {
+	err := s.lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	for i := range s.keys {
+		key := &s.keys[i]
+		if key.hash == keyHash && key.RevokedAt == nil {
+			if now := time.Now().UTC(); key.UseIsStale(now) {
+				key.LastUsedAt = &now
+			}
+			used := key.APIKey
+			return &used, nil
+		}
+	}
+	return nil, nil
+}
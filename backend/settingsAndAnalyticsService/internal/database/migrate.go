@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// migrationFiles holds the PostgreSQL schema as numbered pairs of scripts,
+// NNNN_name.up.sql and NNNN_name.down.sql. Version 1 has no down script: it
+// adopts the tables the dashboard creates, which are not ours to drop. Never
+// edit a released migration; add the next version instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the key of the advisory lock held while migrating, so that
+// concurrent runs apply each version once.
+const migrationLock = 0x66646e73 // "fdns"
+
+// ErrPGSchemaBehind is returned by CheckPGSchema when migrations are pending.
+var ErrPGSchemaBehind = errors.New("postgres schema is behind")
+
+// pgMigration is one version of the PostgreSQL schema.
+type pgMigration struct {
+	version  int
+	name     string
+	up, down string
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// loadPGMigrations reads the migrations of dir in fsys, ordered by version. It
+// fails unless versions start at 1 without gaps and each has both scripts,
+// except version 1, which may be irreversible.
+func loadPGMigrations(fsys fs.FS, dir string) ([]pgMigration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*pgMigration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: name is not NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		script, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &pgMigration{version: version, name: match[2]}
+			byVersion[version] = m
+		} else if m.name != match[2] {
+			return nil, fmt.Errorf("migration %d: named both %s and %s", version, m.name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(script)
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	migrations := make([]pgMigration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i, m := range migrations {
+		switch {
+		case m.version != i+1:
+			return nil, fmt.Errorf("migration %d: expected version %d, versions must be consecutive from 1", m.version, i+1)
+		case m.up == "" || m.down == "" && m.version > 1:
+			return nil, fmt.Errorf("migration %d: needs both an up and a down script", m.version)
+		}
+	}
+	return migrations, nil
+}
+
+func pgMigrations() ([]pgMigration, error) {
+	return loadPGMigrations(migrationFiles, "migrations")
+}
+
+// PGSchemaStatus returns the version of the PostgreSQL schema, 0 if it was
+// never migrated, and the latest version, which this build expects.
+func PGSchemaStatus(ctx context.Context) (version, latest int, err error) {
+	migrations, err := pgMigrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	db, err := getPG()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get postgres connection: %w", err)
+	}
+
+	ctx, done := observePG(ctx, "schema_version")
+	var exists bool
+	err = db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err == nil && exists {
+		err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	}
+	done(err)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading postgres schema version: %w", err)
+	}
+	return version, len(migrations), nil
+}
+
+// CheckPGSchema returns an error wrapping ErrPGSchemaBehind if migrations are
+// pending. A schema ahead of this build is only logged, so that an older
+// build can still run during a rollout.
+func CheckPGSchema(ctx context.Context) error {
+	version, latest, err := PGSchemaStatus(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version < latest:
+		return fmt.Errorf("%w: at version %d, this build needs %d; run the migrate command", ErrPGSchemaBehind, version, latest)
+	case version > latest:
+		zap.L().Warn("PostgreSQL schema is ahead of this build", zap.Int("version", version), zap.Int("expected", latest))
+	}
+	return nil
+}
+
+// MigratePG applies or rolls back migrations until the PostgreSQL schema is at
+// version target. Each migration runs in its own transaction, under an
+// advisory lock, and is recorded in the schema_migrations table.
+func MigratePG(ctx context.Context, target int) error {
+	migrations, err := pgMigrations()
+	if err != nil {
+		return err
+	}
+	if target < 0 || target > len(migrations) {
+		return fmt.Errorf("no postgres schema version %d, the latest is %d", target, len(migrations))
+	}
+	if lowest := lowestPGTarget(migrations); target < lowest {
+		return fmt.Errorf("postgres schema cannot be rolled back below version %d, which has no down script", lowest)
+	}
+	db, err := getPG()
+	if err != nil {
+		return fmt.Errorf("failed to get postgres connection: %w", err)
+	}
+
+	for {
+		stepCtx, done := observePG(ctx, "migrate")
+		applied, err := migrateStep(stepCtx, db, migrations, target)
+		done(err)
+		if err != nil {
+			return err
+		}
+		if applied == nil {
+			break
+		}
+	}
+
+	zap.L().Info("PostgreSQL schema is up to date", zap.Int("version", target))
+	return nil
+}
+
+// migrateStep applies the next migration towards target, if any, and returns it.
+func migrateStep(ctx context.Context, db *sql.DB, migrations []pgMigration, target int) (*pgMigration, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // No-op once committed
+
+	// The version is read under the lock, another process may have migrated meanwhile
+	statements := []string{
+		`SELECT pg_advisory_xact_lock(` + strconv.Itoa(migrationLock) + `)`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL
+		)`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return nil, fmt.Errorf("error preparing postgres migration: %w", err)
+		}
+	}
+	var version int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return nil, fmt.Errorf("error reading postgres schema version: %w", err)
+	}
+	if version > len(migrations) {
+		return nil, fmt.Errorf("postgres schema is at version %d, ahead of this build (%d)", version, len(migrations))
+	}
+
+	m, direction := nextPGMigration(migrations, version, target)
+	switch direction {
+	case "up":
+		_, err = tx.ExecContext(ctx, m.up)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name)
+		}
+	case "down":
+		_, err = tx.ExecContext(ctx, m.down)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.version)
+		}
+	default:
+		return nil, nil
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error migrating postgres schema %s to version %d (%s): %w", direction, m.version, m.name, err)
+	}
+
+	zap.L().Info("Applied PostgreSQL migration", zap.Int("version", m.version), zap.String("name", m.name), zap.String("direction", direction))
+	return &m, nil
+}
+
+// lowestPGTarget returns the lowest version the schema can be rolled back to:
+// the last version without a down script, or 0 if every version has one.
+func lowestPGTarget(migrations []pgMigration) int {
+	lowest := 0
+	for _, m := range migrations {
+		if m.down == "" {
+			lowest = m.version
+		}
+	}
+	return lowest
+}
+
+// nextPGMigration returns the migration that moves a schema at version towards
+// target and its direction, "up" or "down", or an empty direction at target.
+// Rolling back version n runs its down script and leaves the schema at n-1.
+func nextPGMigration(migrations []pgMigration, version, target int) (pgMigration, string) {
+	switch {
+	case version < target:
+		return migrations[version], "up"
+	case version > target && migrations[version-1].down != "":
+		return migrations[version-1], "down"
+	default:
+		return pgMigration{}, ""
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedPGMigrations(t *testing.T) {
+	migrations, err := pgMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+}
+
+func TestLoadPGMigrations(t *testing.T) {
+	file := func(script string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(script)} }
+
+	migrations, err := loadPGMigrations(fstest.MapFS{
+		"m/0002_second.up.sql":   file("CREATE TABLE b ()"),
+		"m/0002_second.down.sql": file("DROP TABLE b"),
+		"m/0001_first.up.sql":    file("CREATE TABLE a ()"),
+		"m/0001_first.down.sql":  file("DROP TABLE a"),
+	}, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].name != "first" || migrations[1].up != "CREATE TABLE b ()" || migrations[1].down != "DROP TABLE b" {
+		t.Fatalf("migrations = %+v", migrations)
+	}
+
+	for name, tc := range map[string]struct {
+		files fstest.MapFS
+		err   string
+	}{
+		"gap": {fstest.MapFS{
+			"m/0001_first.up.sql": file("x"), "m/0001_first.down.sql": file("x"),
+			"m/0003_third.up.sql": file("x"), "m/0003_third.down.sql": file("x"),
+		}, "consecutive"},
+		"no down": {fstest.MapFS{
+			"m/0001_first.up.sql": file("x"), "m/0002_second.up.sql": file("x"),
+		}, "both"},
+		"renamed":  {fstest.MapFS{"m/0001_first.up.sql": file("x"), "m/0001_other.down.sql": file("x")}, "named both"},
+		"bad name": {fstest.MapFS{"m/first.sql": file("x")}, "name is not"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadPGMigrations(tc.files, "m")
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("error = %v, want one containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestPGMigrationsDown(t *testing.T) {
+	migrations, err := pgMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrations[0].down != "" {
+		t.Error("version 1 has a down script, it would drop the dashboard's tables")
+	}
+	for _, m := range migrations {
+		for _, table := range []string{"users", "linked_ips", "api_keys"} {
+			if strings.Contains(m.down, "DROP TABLE IF EXISTS "+table) || strings.Contains(m.down, "DROP TABLE "+table) {
+				t.Errorf("migration %d drops %s, which the dashboard owns", m.version, table)
+			}
+		}
+	}
+
+	// Rolling back from the latest version runs each down script once, newest first
+	var rolledBack []int
+	for version := len(migrations); ; version-- {
+		m, direction := nextPGMigration(migrations, version, 1)
+		if direction == "" {
+			break
+		}
+		if direction != "down" || m.version != version {
+			t.Fatalf("at version %d, next migration is %d %s, want %d down", version, m.version, direction, version)
+		}
+		rolledBack = append(rolledBack, m.version)
+	}
+	if len(rolledBack) != len(migrations)-1 || rolledBack[len(rolledBack)-1] != 2 {
+		t.Errorf("rolled back %v, want every version from %d to 2", rolledBack, len(migrations))
+	}
+	if m, direction := nextPGMigration(migrations, 1, 0); direction != "" {
+		t.Errorf("at version 1, next migration to 0 is %d %s, want none", m.version, direction)
+	}
+
+	if lowest := lowestPGTarget(migrations); lowest != 1 {
+		t.Errorf("lowest target = %d, want 1", lowest)
+	}
+	if err := MigratePG(context.Background(), 0); err == nil || !strings.Contains(err.Error(), "below version 1") {
+		t.Errorf("MigratePG to 0 = %v, want it refused before connecting", err)
+	}
+}
@@ -0,0 +1,34 @@
+-- The tables of the dashboard's seed route. IF NOT EXISTS lets databases set
+-- up by the seed route, or before migrations were versioned, adopt this version.
+-- It has no down script: these tables belong to the dashboard, not to this service.
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS users (
+	id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS linked_ips (
+	id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+	time TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	ip VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS linked_ips_ip_time_idx ON linked_ips (ip, time DESC);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+	id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	prefix VARCHAR(32) NOT NULL,
+	key_hash CHAR(64) NOT NULL UNIQUE,
+	scopes TEXT[] NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	last_used_at TIMESTAMP WITH TIME ZONE,
+	revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE linked_ips DROP CONSTRAINT IF EXISTS linked_ips_ip_not_empty;
+DROP INDEX IF EXISTS linked_ips_time_idx;
+DROP INDEX IF EXISTS linked_ips_user_id_time_idx;
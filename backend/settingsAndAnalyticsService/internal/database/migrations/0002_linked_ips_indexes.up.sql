@@ -0,0 +1,8 @@
+-- The dashboard and export-user look up the IPs of a user, newest first.
+CREATE INDEX IF NOT EXISTS linked_ips_user_id_time_idx ON linked_ips (user_id, time DESC);
+
+-- Lets links be listed or pruned by age without scanning the table.
+CREATE INDEX IF NOT EXISTS linked_ips_time_idx ON linked_ips (time);
+
+-- NOT VALID enforces the check on new rows without failing on existing ones.
+ALTER TABLE linked_ips ADD CONSTRAINT linked_ips_ip_not_empty CHECK (btrim(ip) <> '') NOT VALID;
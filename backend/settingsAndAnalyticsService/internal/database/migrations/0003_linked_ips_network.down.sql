@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS linked_ips_network_idx;
+DROP TRIGGER IF EXISTS linked_ips_set_network ON linked_ips;
+DROP FUNCTION IF EXISTS linked_ips_set_network();
+ALTER TABLE linked_ips DROP COLUMN IF EXISTS network;
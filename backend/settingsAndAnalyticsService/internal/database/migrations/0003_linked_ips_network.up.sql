@@ -0,0 +1,22 @@
+-- Links hold an address or a prefix, e.g. the /56 delegated to a home, of
+-- either family. network is ip parsed as inet, or NULL when ip is not an
+-- address, so that lookups can match addresses within linked prefixes.
+ALTER TABLE linked_ips ADD COLUMN network INET;
+
+CREATE FUNCTION linked_ips_set_network() RETURNS trigger AS $$
+BEGIN
+	BEGIN
+		NEW.network := btrim(NEW.ip)::inet;
+	EXCEPTION WHEN invalid_text_representation THEN
+		NEW.network := NULL;
+	END;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER linked_ips_set_network BEFORE INSERT OR UPDATE OF ip ON linked_ips
+	FOR EACH ROW EXECUTE FUNCTION linked_ips_set_network();
+
+UPDATE linked_ips SET ip = ip; -- Fills network through the trigger
+
+CREATE INDEX linked_ips_network_idx ON linked_ips USING gist (network inet_ops);
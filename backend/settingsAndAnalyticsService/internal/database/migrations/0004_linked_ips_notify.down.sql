@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS linked_ips_notify_truncate ON linked_ips;
+DROP TRIGGER IF EXISTS linked_ips_notify ON linked_ips;
+DROP FUNCTION IF EXISTS linked_ips_notify();
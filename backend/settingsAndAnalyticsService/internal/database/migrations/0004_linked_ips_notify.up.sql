@@ -0,0 +1,23 @@
+-- Notifies the linked_ips channel of the network of every changed link, so
+-- that cached lookups can be dropped; an empty payload means any link.
+CREATE FUNCTION linked_ips_notify() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'TRUNCATE' THEN
+		PERFORM pg_notify('linked_ips', '');
+		RETURN NULL;
+	END IF;
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		PERFORM pg_notify('linked_ips', COALESCE(OLD.network::text, ''));
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		PERFORM pg_notify('linked_ips', COALESCE(NEW.network::text, ''));
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER linked_ips_notify AFTER INSERT OR UPDATE OR DELETE ON linked_ips
+	FOR EACH ROW EXECUTE FUNCTION linked_ips_notify();
+
+CREATE TRIGGER linked_ips_notify_truncate AFTER TRUNCATE ON linked_ips
+	FOR EACH STATEMENT EXECUTE FUNCTION linked_ips_notify();
@@ -0,0 +1 @@
+DROP VIEW IF EXISTS linked_ip_intervals;
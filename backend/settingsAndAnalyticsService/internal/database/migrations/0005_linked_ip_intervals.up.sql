@@ -0,0 +1,11 @@
+-- A link holds its network from its time until the same network is linked
+-- again, to anyone; valid_until is NULL for the current link. Addresses belong
+-- to the most specific network linked at the time, see LinkHistory.UserAt.
+CREATE VIEW linked_ip_intervals AS
+SELECT
+	user_id,
+	network(network) AS network,
+	time AS valid_from,
+	LEAD(time) OVER (PARTITION BY network(network) ORDER BY time, id) AS valid_until
+FROM linked_ips
+WHERE network IS NOT NULL;
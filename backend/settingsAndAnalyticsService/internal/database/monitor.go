@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/metrics"
+	"github.com/BrachiGH/firedns-dashboard/internal/tracing"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// commandMonitor reports every MongoDB command to both the metrics and the
+// tracing monitors, since a client accepts a single monitor.
+func commandMonitor() *event.CommandMonitor {
+	monitors := []*event.CommandMonitor{metrics.MongoMonitor(), tracing.MongoMonitor()}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
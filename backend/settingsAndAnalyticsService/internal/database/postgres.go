@@ -1,14 +1,21 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
-	"net"
-	"os"
+	"net/netip"
 	"sync"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/metrics"
+	"github.com/BrachiGH/firedns-dashboard/internal/tracing"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 var (
@@ -17,19 +24,10 @@ var (
 	pgErr  error
 )
 
-// ConnectPG establishes a connection to the PostgreSQL database using environment variables.
-func ConnectPG() (*sql.DB, error) {
+// ConnectPG establishes the pooled connection to the PostgreSQL database.
+func ConnectPG(cfg config.Postgres) (*sql.DB, error) {
 	pgOnce.Do(func() {
-		pgUser := os.Getenv("POSTGRES_USER")
-		pgPassword := os.Getenv("POSTGRES_PASSWORD")
-		pgHost := os.Getenv("POSTGRES_HOST")
-		pgPort := os.Getenv("POSTGRES_PORT")
-		pgDatabase := os.Getenv("POSTGRES_DATABASE")
-
-		connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-			pgHost, pgPort, pgUser, pgPassword, pgDatabase)
-
-		pgDB, pgErr = sql.Open("postgres", connStr)
+		pgDB, pgErr = sql.Open("postgres", cfg.DSN())
 		if pgErr != nil {
 			pgErr = fmt.Errorf("failed to open postgres connection: %w", pgErr)
 			return
@@ -42,57 +40,257 @@ func ConnectPG() (*sql.DB, error) {
 			pgDB = nil   // Reset pgDB so Do doesn't think it succeeded
 			return
 		}
-		log.Println("Successfully connected to PostgreSQL database.")
+		zap.L().Info("Successfully connected to PostgreSQL database")
 	})
 	return pgDB, pgErr
 }
 
-// GetUserIDByIP queries the linked_ips table for a user ID associated with an IP address.
-// Note: Assumes the ipInt is the integer representation of an IPv4 address.
-func GetUserIDByIP(ipInt int64) (string, error) {
-	db, err := ConnectPG()
+// getPG returns the pooled connection opened by ConnectPG.
+func getPG() (*sql.DB, error) {
+	if pgDB == nil {
+		return nil, fmt.Errorf("not connected to postgres")
+	}
+	return pgDB, nil
+}
+
+// observePG starts a client span for a PostgreSQL query. The returned function
+// ends it and records the query metrics; call it with the query's error.
+func observePG(ctx context.Context, query string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "postgres "+query,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system.name", "postgresql"), attribute.String("db.operation.name", query)))
+	return ctx, func(err error) {
+		metrics.ObservePostgres(query, start, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil // An empty result is not a failure
+		}
+		tracing.End(span, err)
+	}
+}
+
+// PingPG checks that the pooled PostgreSQL connection is still usable.
+func PingPG(ctx context.Context) error {
+	if pgDB == nil {
+		return fmt.Errorf("not connected to postgres")
+	}
+	if err := pgDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("error pinging postgres database: %w", err)
+	}
+	return nil
+}
+
+// Postgres_DB is the IPLinkStore and APIKeyStore backed by the connection opened by ConnectPG.
+type Postgres_DB struct{}
+
+var (
+	_ IPLinkStore = Postgres_DB{}
+	_ APIKeyStore = Postgres_DB{}
+)
+
+// UserIDByIP implements IPLinkStore.
+func (Postgres_DB) UserIDByIP(ctx context.Context, ip netip.Addr) (string, error) {
+	return GetUserIDByIP(ctx, ip)
+}
+
+// UserIDsByIP implements IPLinkStore.
+func (Postgres_DB) UserIDsByIP(ctx context.Context, ips []netip.Addr) (map[netip.Addr]string, error) {
+	return GetUserIDsByIP(ctx, ips)
+}
+
+// LinkHistories implements IPLinkStore.
+func (Postgres_DB) LinkHistories(ctx context.Context, ips []netip.Addr, from, to time.Time) (map[netip.Addr]LinkHistory, error) {
+	return GetLinkHistories(ctx, ips, from, to)
+}
+
+// GetUserIDByIP returns the user linked to an address, IPv4 or IPv6, either
+// directly or through a linked prefix. The most specific link wins, then the
+// latest. It returns "" if the address is not linked.
+func GetUserIDByIP(ctx context.Context, ip netip.Addr) (string, error) {
+	db, err := getPG()
 	if err != nil {
 		return "", fmt.Errorf("failed to get postgres connection: %w", err)
 	}
-
-	// Convert integer IP back to string format for querying
-	ipStr := intToIP(ipInt).String()
-	if ipStr == "" {
-		return "", fmt.Errorf("invalid integer IP address: %d", ipInt)
+	if !ip.IsValid() {
+		return "", fmt.Errorf("invalid IP address")
 	}
 
 	var userID string
-	query := "SELECT user_id FROM linked_ips WHERE ip = $1 ORDER BY time DESC LIMIT 1" // Get the latest user for this IP
+	query := `SELECT user_id FROM linked_ips WHERE network >>= $1::inet
+		ORDER BY masklen(network) DESC, time DESC LIMIT 1`
 
-	err = db.QueryRow(query, ipStr).Scan(&userID)
+	ctx, done := observePG(ctx, "get_user_id_by_ip")
+	err = db.QueryRowContext(ctx, query, ip.Unmap().String()).Scan(&userID)
+	done(err)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return "", nil // No user found for this IP, not necessarily an error
 		}
-		return "", fmt.Errorf("error querying user_id for ip %s: %w", ipStr, err)
+		return "", fmt.Errorf("error querying user_id for ip %s: %w", ip, err)
 	}
 
 	return userID, nil
 }
 
-// Helper function to convert IPv4 integer to net.IP
-func intToIP(ipInt int64) net.IP {
-	// Ensure it's within IPv4 range if needed, though net.IPv4 takes uint32
-	if ipInt < 0 || ipInt > 0xFFFFFFFF {
-		return nil // Or handle error appropriately
-	}
-	ip := make(net.IP, 4)
-	ip[0] = byte(ipInt >> 24)
-	ip[1] = byte(ipInt >> 16)
-	ip[2] = byte(ipInt >> 8)
-	ip[3] = byte(ipInt)
-	return ip
+// GetUserIDsByIP resolves every valid address of ips in a single query, as
+// GetUserIDByIP does. Addresses that are not linked are left out of the result.
+func GetUserIDsByIP(ctx context.Context, ips []netip.Addr) (map[netip.Addr]string, error) {
+	users := make(map[netip.Addr]string)
+	addresses := make([]string, 0, len(ips))
+	valid := make([]netip.Addr, 0, len(ips))
+	for _, ip := range ips {
+		if ip.IsValid() {
+			addresses = append(addresses, ip.Unmap().String())
+			valid = append(valid, ip)
+		}
+	}
+	if len(addresses) == 0 {
+		return users, nil
+	}
+	db, err := getPG()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get postgres connection: %w", err)
+	}
+
+	// n is the position of the address in the array, from 1
+	query := `SELECT DISTINCT ON (q.n) q.n, l.user_id
+		FROM unnest($1::inet[]) WITH ORDINALITY AS q(ip, n)
+		JOIN linked_ips l ON l.network >>= q.ip
+		ORDER BY q.n, masklen(l.network) DESC, l.time DESC`
+
+	ctx, done := observePG(ctx, "get_user_ids_by_ip")
+	err = func() error {
+		rows, err := db.QueryContext(ctx, query, pq.Array(addresses))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var n int
+			var userID string
+			if err := rows.Scan(&n, &userID); err != nil {
+				return err
+			}
+			users[valid[n-1]] = userID
+		}
+		return rows.Err()
+	}()
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("error querying user_ids of %d ips: %w", len(addresses), err)
+	}
+	return users, nil
+}
+
+// GetLinkHistories returns the link histories of every valid address of ips
+// between from and to in a single query. It computes the intervals as the
+// linked_ip_intervals view does, but only over the links containing each
+// address, so that the gist index on network is used: all the links of a
+// network contain the address when one does, so none is missed.
+func GetLinkHistories(ctx context.Context, ips []netip.Addr, from, to time.Time) (map[netip.Addr]LinkHistory, error) {
+	histories := make(map[netip.Addr]LinkHistory)
+	addresses := make([]string, 0, len(ips))
+	valid := make([]netip.Addr, 0, len(ips))
+	for _, ip := range ips {
+		if ip.IsValid() {
+			addresses = append(addresses, ip.Unmap().String())
+			valid = append(valid, ip)
+		}
+	}
+	if len(addresses) == 0 {
+		return histories, nil
+	}
+	db, err := getPG()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get postgres connection: %w", err)
+	}
+	var until any // NULL for no upper bound
+	if !to.IsZero() {
+		until = to
+	}
+
+	query := `SELECT q.n, i.user_id, i.network::text, i.valid_from, i.valid_until
+		FROM unnest($1::inet[]) WITH ORDINALITY AS q(ip, n)
+		CROSS JOIN LATERAL (
+			SELECT user_id, network(network) AS network, time AS valid_from,
+				LEAD(time) OVER (PARTITION BY network(network) ORDER BY time, id) AS valid_until
+			FROM linked_ips
+			WHERE network >>= q.ip
+		) i
+		WHERE (i.valid_until IS NULL OR i.valid_until > $2) AND ($3::timestamptz IS NULL OR i.valid_from <= $3)
+		ORDER BY q.n, i.valid_from`
+
+	ctx, done := observePG(ctx, "get_link_histories")
+	err = func() error {
+		rows, err := db.QueryContext(ctx, query, pq.Array(addresses), from, until)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var n int
+			var network string
+			var link LinkInterval
+			var validUntil sql.NullTime
+			if err := rows.Scan(&n, &link.UserID, &network, &link.From, &validUntil); err != nil {
+				return err
+			}
+			if link.Network, err = netip.ParsePrefix(network); err != nil {
+				return err
+			}
+			link.Until = validUntil.Time
+			ip := valid[n-1]
+			histories[ip] = append(histories[ip], link)
+		}
+		return rows.Err()
+	}()
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("error querying link histories of %d ips: %w", len(addresses), err)
+	}
+	return histories, nil
+}
+
+// linkChannel is notified of every change to linked_ips, see migration 0004.
+const linkChannel = "linked_ips"
+
+// WatchLinkedIPs calls changed with the network of every linked_ips row
+// inserted, updated or deleted, until ctx is cancelled. changed receives an
+// invalid prefix when any link may have changed, e.g. after reconnecting,
+// since notifications sent meanwhile are lost.
+func WatchLinkedIPs(ctx context.Context, cfg config.Postgres, changed func(netip.Prefix)) error {
+	listener := pq.NewListener(cfg.DSN(), time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			zap.L().Warn("PostgreSQL link notifications interrupted", zap.Error(err))
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(linkChannel); err != nil {
+		return fmt.Errorf("error listening to %s notifications: %w", linkChannel, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.Notify:
+			if notification == nil {
+				changed(netip.Prefix{}) // Reconnected
+				continue
+			}
+			network, err := netip.ParsePrefix(notification.Extra)
+			if err != nil {
+				network = netip.Prefix{} // Not an address, forget every link to be safe
+			}
+			changed(network)
+		}
+	}
 }
 
 // Optional: Add a function to close the PG connection when the application shuts down
 func ClosePG() {
 	if pgDB != nil {
 		pgDB.Close()
-		log.Println("PostgreSQL connection closed.")
+		zap.L().Info("PostgreSQL connection closed")
 	}
 }
@@ -0,0 +1,107 @@
+package database_test
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/database/memstore"
+	"github.com/BrachiGH/firedns-dashboard/internal/services/user/etl"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// bsonTypes are the $jsonSchema names of the BSON types the validators use.
+var bsonTypes = map[string]bsontype.Type{
+	"string":   bsontype.String,
+	"date":     bsontype.DateTime,
+	"object":   bsontype.EmbeddedDocument,
+	"array":    bsontype.Array,
+	"null":     bsontype.Null,
+	"int":      bsontype.Int32,
+	"long":     bsontype.Int64,
+	"bool":     bsontype.Boolean,
+	"objectId": bsontype.ObjectID,
+}
+
+// validate reports the fields of doc that a $jsonSchema validator of the
+// form built by jsonSchema would reject.
+func validate(t *testing.T, validator bson.D, doc bson.M) {
+	t.Helper()
+	var schema struct {
+		Schema struct {
+			Required   []string `bson:"required"`
+			Properties bson.M   `bson:"properties"`
+		} `bson:"$jsonSchema"`
+	}
+	raw, err := bson.Marshal(validator)
+	if err == nil {
+		err = bson.Unmarshal(raw, &schema)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := bson.Raw(encoded)
+
+	for _, name := range schema.Schema.Required {
+		if _, err := fields.LookupErr(name); err != nil {
+			t.Errorf("required field %s is missing", name)
+		}
+	}
+	for name, property := range schema.Schema.Properties {
+		value, err := fields.LookupErr(name)
+		if err != nil {
+			continue
+		}
+		var allowed []string
+		switch types := property.(bson.M)["bsonType"].(type) {
+		case string:
+			allowed = []string{types}
+		case bson.A:
+			for _, name := range types {
+				allowed = append(allowed, name.(string))
+			}
+		}
+		if !slices.ContainsFunc(allowed, func(name string) bool { return bsonTypes[name] == value.Type }) {
+			t.Errorf("field %s is a %s, want one of %v", name, value.Type, allowed)
+		}
+	}
+}
+
+func TestETLAnalyticsMatchSchema(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	ip := netip.MustParseAddr("192.0.2.1")
+	store.LinkIP(netip.PrefixFrom(ip, 32), "alice", time.Now().Add(-time.Hour))
+	if err := store.RecordQueryEvents(ctx, []database.QueryEvent{
+		{IP: ip, Domain: "example.org", Time: time.Now()},
+		{IP: ip, Domain: "ads.example", Dropped: true, Time: time.Now()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !etl.RunAnalyticsETL(ctx, config.Default().ETL, store.Stores()) {
+		t.Fatal("ETL run failed")
+	}
+	analytics, err := store.FindUserAnalytics(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An upsert inserts the fields of its filter and those it sets
+	filter, update := database.UserAnalyticsUpsert(analytics)
+	doc := bson.M{}
+	for _, fields := range []bson.M{filter, update["$set"].(bson.M)} {
+		for name, value := range fields {
+			doc[name] = value
+		}
+	}
+	validate(t, database.UserAnalyticsSchema(), doc)
+}
@@ -2,12 +2,16 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"maps"
+	"slices"
 
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
 )
 
 type UserSettings_DB struct {
@@ -16,6 +20,7 @@ type UserSettings_DB struct {
 	Parental      *mongo.Collection
 	DenyAllowList *mongo.Collection
 	client        *mongo.Client
+	transactions  bool // The deployment is a replica set or sharded cluster, see supportsTransactions
 }
 
 var global_settings_db *UserSettings_DB
@@ -28,29 +33,36 @@ func GetSettingsDB() (*UserSettings_DB, error) {
 	return nil, fmt.Errorf("not connected to db")
 }
 
-func (a *UserSettings_DB) Connect() error {
-	// Interface on your machine.
-	// MongoDB URI and database name
-	uri := os.Getenv("MONGO_DB_URI")
-	const dbName = "FireDNSUserSettings"
+func (a *UserSettings_DB) Connect(cfg config.Mongo) error {
+	dbName := cfg.SettingsDatabase
 
 	// Set client options
-	clientOptions := options.Client().ApplyURI(uri)
+	clientOptions := options.Client().ApplyURI(cfg.URI).SetMonitor(commandMonitor())
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
 
 	var err error
 	// Connect to MongoDB
-	a.client, err = mongo.Connect(context.Background(), clientOptions)
+	a.client, err = mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		return fmt.Errorf("error connecting to db: %w", err)
 	}
 
 	// Check the connection
-	err = a.client.Ping(context.Background(), nil)
+	err = a.client.Ping(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("error connecting to db: connection check failed: %w", err)
 	}
 
-	fmt.Println("Connected to MongoDB!")
+	zap.L().Info("Connected to settings MongoDB")
+
+	if a.transactions, err = supportsTransactions(ctx, a.client); err != nil {
+		return fmt.Errorf("error connecting to db: %w", err)
+	}
+	if !a.transactions {
+		zap.L().Warn("Settings MongoDB is a standalone server without transactions, replacing all the settings of a user is not atomic; use a replica set")
+	}
 
 	// Get a handle for the collection
 	a.General = a.client.Database(dbName).Collection("general")
@@ -65,12 +77,234 @@ func (a *UserSettings_DB) Connect() error {
 }
 
 func (a *UserSettings_DB) Disconnect() error {
+	if a.client == nil {
+		return nil // Never connected
+	}
 	if err := a.client.Disconnect(context.Background()); err != nil {
 		return fmt.Errorf("error disconnecting from db: %w", err)
 	}
 	return nil
 }
 
+// Ping checks that the settings MongoDB deployment is reachable.
+func (a *UserSettings_DB) Ping(ctx context.Context) error {
+	if a.client == nil {
+		return fmt.Errorf("not connected to db")
+	}
+	if err := a.client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("error pinging settings db: %w", err)
+	}
+	return nil
+}
+
+// supportsTransactions reports whether client is connected to a replica set or
+// a sharded cluster. Standalone servers, such as the one of docker-compose.yml,
+// reject transactions.
+func supportsTransactions(ctx context.Context, client *mongo.Client) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"` // "isdbgrid" from mongos
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, fmt.Errorf("error checking deployment type: %w", err)
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
+// WithTransaction runs fn in a transaction spanning every settings collection,
+// retrying it on transient errors. Operations in fn must use the context it is
+// given. Transactions need a replica set or sharded cluster; on a standalone
+// server they fail.
+func (a *UserSettings_DB) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if a.client == nil {
+		return fmt.Errorf("not connected to db")
+	}
+	session, err := a.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("error starting settings db session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("settings transaction failed: %w", err)
+	}
+	return nil
+}
+
+// Every write to a general, privacy or parental settings document increments
+// its revision. Documents written before revisions existed are at revision 0.
+const revisionField = "revision"
+
+var (
+	_ SettingsStore = (*UserSettings_DB)(nil)
+	_ ListStore     = (*UserSettings_DB)(nil)
+)
+
+// collection returns the collection holding a settings category.
+func (a *UserSettings_DB) collection(category SettingsCategory) (*mongo.Collection, error) {
+	var collection *mongo.Collection
+	switch category {
+	case CategoryGeneral:
+		collection = a.General
+	case CategoryPrivacy:
+		collection = a.Privacy
+	case CategoryParental:
+		collection = a.Parental
+	default:
+		return nil, fmt.Errorf("unknown settings category %q", category)
+	}
+	if collection == nil {
+		return nil, fmt.Errorf("not connected to db")
+	}
+	return collection, nil
+}
+
+// FindSettings implements SettingsStore.
+func (a *UserSettings_DB) FindSettings(ctx context.Context, category SettingsCategory, userID string, result any) error {
+	collection, err := a.collection(category)
+	if err != nil {
+		return err
+	}
+	err = collection.FindOne(ctx, bson.M{"userId": userID}).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching %s settings: %w", category, err)
+	}
+	return nil
+}
+
+// UpdateSettings implements SettingsStore. A conditional update that may
+// create the document relies on the unique userId index created by
+// BootstrapMongo, or checked by CheckMongoIndexes, to reject a concurrent insert.
+func (a *UserSettings_DB) UpdateSettings(ctx context.Context, category SettingsCategory, userID string, fields map[string]any, revisions []int64, result any) error {
+	collection, err := a.collection(category)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"userId": userID}
+	upsert := true
+	if len(revisions) > 0 {
+		if slices.Contains(revisions, 0) {
+			// Revision 0 is also a legacy document without the field, or no document at all
+			filter["$or"] = bson.A{
+				bson.M{revisionField: bson.M{"$in": revisions}},
+				bson.M{revisionField: bson.M{"$exists": false}},
+			}
+		} else {
+			filter[revisionField] = bson.M{"$in": revisions}
+			upsert = false
+		}
+	}
+
+	update := bson.M{
+		"$set": fields,
+		"$inc": bson.M{revisionField: 1},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(upsert).SetReturnDocument(options.After)
+
+	err = collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(result)
+	switch {
+	case err == nil:
+		return nil
+	case len(revisions) > 0 && (errors.Is(err, mongo.ErrNoDocuments) || mongo.IsDuplicateKeyError(err)):
+		return ErrRevisionMismatch
+	default:
+		return fmt.Errorf("error updating %s settings: %w", category, err)
+	}
+}
+
+// ReplaceSettings implements SettingsStore with a transaction spanning every
+// settings collection, see WithTransaction. On a standalone server, which has
+// no transactions, the collections are written one after another in a fixed
+// order instead, so a failure can leave the earlier ones replaced.
+func (a *UserSettings_DB) ReplaceSettings(ctx context.Context, userID string, categories map[SettingsCategory]map[string]any, lists DomainLists) error {
+	replace := func(ctx context.Context) error {
+		return a.replaceSettings(ctx, userID, categories, lists)
+	}
+	if !a.transactions {
+		return replace(ctx)
+	}
+	return a.WithTransaction(ctx, replace)
+}
+
+func (a *UserSettings_DB) replaceSettings(ctx context.Context, userID string, categories map[SettingsCategory]map[string]any, lists DomainLists) error {
+	filter := bson.M{"userId": userID}
+	upsert := options.Update().SetUpsert(true)
+	for _, category := range slices.Sorted(maps.Keys(categories)) {
+		fields := categories[category]
+		collection, err := a.collection(category)
+		if err != nil {
+			return err
+		}
+		update := bson.M{"$set": fields, "$inc": bson.M{revisionField: 1}}
+		if _, err := collection.UpdateOne(ctx, filter, update, upsert); err != nil {
+			return fmt.Errorf("error replacing %s settings: %w", category, err)
+		}
+	}
+	if a.DenyAllowList == nil {
+		return fmt.Errorf("not connected to db")
+	}
+	update := bson.M{"$set": bson.M{string(DenyList): lists.Denied, string(AllowList): lists.Allowed}}
+	if _, err := a.DenyAllowList.UpdateOne(ctx, filter, update, upsert); err != nil {
+		return fmt.Errorf("error replacing deny/allow lists: %w", err)
+	}
+	return nil
+}
+
+// FindLists implements ListStore.
+func (a *UserSettings_DB) FindLists(ctx context.Context, userID string) (DomainLists, error) {
+	if a.DenyAllowList == nil {
+		return DomainLists{}, fmt.Errorf("not connected to db")
+	}
+	var doc struct {
+		Denied  []string `bson:"deniedDomains"`
+		Allowed []string `bson:"allowedDomains"`
+	}
+	err := a.DenyAllowList.FindOne(ctx, bson.M{"userId": userID}).Decode(&doc)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return DomainLists{}, fmt.Errorf("error fetching deny/allow lists: %w", err)
+	}
+	return DomainLists{Denied: doc.Denied, Allowed: doc.Allowed}, nil
+}
+
+// AddDomain implements ListStore.
+func (a *UserSettings_DB) AddDomain(ctx context.Context, userID string, list DomainList, domain string) (bool, error) {
+	if a.DenyAllowList == nil {
+		return false, fmt.Errorf("not connected to db")
+	}
+	update := bson.M{
+		"$addToSet":    bson.M{string(list): domain},
+		"$setOnInsert": bson.M{"userId": userID}, // Set userId only if inserting a new document
+	}
+	result, err := a.DenyAllowList.UpdateOne(ctx, bson.M{"userId": userID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return false, fmt.Errorf("error adding domain to %s: %w", list, err)
+	}
+	return result.UpsertedCount > 0 || result.ModifiedCount > 0, nil
+}
+
+// RemoveDomain implements ListStore.
+func (a *UserSettings_DB) RemoveDomain(ctx context.Context, userID string, list DomainList, domain string) (bool, error) {
+	if a.DenyAllowList == nil {
+		return false, fmt.Errorf("not connected to db")
+	}
+	update := bson.M{"$pull": bson.M{string(list): domain}}
+	result, err := a.DenyAllowList.UpdateOne(ctx, bson.M{"userId": userID}, update)
+	if err != nil {
+		return false, fmt.Errorf("error removing domain from %s: %w", list, err)
+	}
+	if result.MatchedCount == 0 {
+		return false, ErrNotFound
+	}
+	return result.ModifiedCount > 0, nil
+}
+
 func (a *UserSettings_DB) Update(ip bson.M, doc bson.M, collection *mongo.Collection) (ID interface{}, err error) {
 	updateOptions := options.Update().SetUpsert(true)
 	insertOneResult, err := collection.UpdateOne(context.Background(), ip, doc, updateOptions)
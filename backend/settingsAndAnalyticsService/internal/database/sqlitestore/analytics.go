@@ -0,0 +1,126 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FindUserAnalytics implements database.AnalyticsStore.
+func (s *Store) FindUserAnalytics(ctx context.Context, userID string) (database.UserAnalytics, error) {
+	ctx, done := observe(ctx, "find_user_analytics")
+	var doc string
+	err := s.db.QueryRowContext(ctx, `SELECT document FROM user_analytics WHERE user_id = ?`, userID).Scan(&doc)
+	done(err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.UserAnalytics{}, database.ErrNotFound
+	}
+	if err != nil {
+		return database.UserAnalytics{}, fmt.Errorf("error fetching analytics of user %s: %w", userID, err)
+	}
+
+	var analytics database.UserAnalytics
+	if err := json.Unmarshal([]byte(doc), &analytics); err != nil {
+		return database.UserAnalytics{}, fmt.Errorf("error decoding analytics of user %s: %w", userID, err)
+	}
+	return analytics, nil
+}
+
+// UpsertUserAnalytics implements database.AnalyticsStore.
+func (s *Store) UpsertUserAnalytics(ctx context.Context, analytics database.UserAnalytics) error {
+	doc, err := json.Marshal(analytics)
+	if err != nil {
+		return fmt.Errorf("error encoding analytics of user %s: %w", analytics.UserID, err)
+	}
+
+	ctx, done := observe(ctx, "upsert_user_analytics")
+	_, err = s.db.ExecContext(ctx, `INSERT INTO user_analytics (user_id, document) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET document = excluded.document`, analytics.UserID, doc)
+	done(err)
+	if err != nil {
+		return fmt.Errorf("error upserting user analytics for %s: %w", analytics.UserID, err)
+	}
+	return nil
+}
+
+// FetchAllDNSMessages implements database.AnalyticsStore. The queries of each
+// client address are returned as one message, in the order they were
+// recorded, with their timestamps as MongoDB returns them.
+func (s *Store) FetchAllDNSMessages(ctx context.Context) ([]database.DNSMessage, error) {
+	ctx, done := observe(ctx, "fetch_dns_messages")
+	messages, err := fetchDNSMessages(ctx, s.db)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching DNS messages: %w", err)
+	}
+	return messages, nil
+}
+
+func fetchDNSMessages(ctx context.Context, db *sql.DB) ([]database.DNSMessage, error) {
+	rows, err := db.QueryContext(ctx, `SELECT ip, domain, dropped, time FROM dns_queries ORDER BY ip, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []database.DNSMessage
+	var ip string
+	for rows.Next() {
+		var address, domain string
+		var dropped bool
+		var at int64
+		if err := rows.Scan(&address, &domain, &dropped, &at); err != nil {
+			return nil, err
+		}
+		if len(messages) == 0 || address != ip {
+			addr, err := database.ParseIP(address)
+			if err != nil {
+				return nil, err
+			}
+			ip = address
+			messages = append(messages, database.DNSMessage{IP: database.IP{Addr: addr}})
+		}
+
+		msg := &messages[len(messages)-1]
+		entry := []interface{}{domain, primitive.NewDateTimeFromTime(fromMillis(at))}
+		if dropped {
+			msg.Dropped = append(msg.Dropped, entry)
+		} else {
+			msg.Passed = append(msg.Passed, entry)
+		}
+		msg.QuestionCount++
+	}
+	return messages, rows.Err()
+}
+
+// RecordQueryEvents implements database.AnalyticsStore.
+func (s *Store) RecordQueryEvents(ctx context.Context, events []database.QueryEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx, done := observe(ctx, "record_query_events")
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		insert, err := tx.PrepareContext(ctx, `INSERT INTO dns_queries (ip, domain, dropped, time) VALUES (?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insert.Close()
+		for _, event := range events {
+			if _, err := insert.ExecContext(ctx, event.IP.String(), event.Domain, event.Dropped, millis(event.Time)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	done(err)
+	if err != nil {
+		return fmt.Errorf("error recording %d query events: %w", len(events), err)
+	}
+	return nil
+}
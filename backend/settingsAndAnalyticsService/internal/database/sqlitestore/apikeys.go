@@ -0,0 +1,125 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+)
+
+// CreateAPIKey implements database.APIKeyStore.
+func (s *Store) CreateAPIKey(ctx context.Context, userID, name, prefix, keyHash string, scopes []string) (database.APIKey, error) {
+	encoded, err := json.Marshal(scopes)
+	if err != nil {
+		return database.APIKey{}, fmt.Errorf("error encoding api key scopes: %w", err)
+	}
+	key := database.APIKey{UserID: userID, Name: name, Prefix: prefix, Scopes: scopes, CreatedAt: fromMillis(millis(time.Now()))}
+
+	ctx, done := observe(ctx, "create_api_key")
+	result, err := s.db.ExecContext(ctx, `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, userID, name, prefix, keyHash, string(encoded), millis(key.CreatedAt))
+	var id int64
+	if err == nil {
+		id, err = result.LastInsertId()
+	}
+	done(err)
+	if err != nil {
+		return database.APIKey{}, fmt.Errorf("error inserting api key for user %s: %w", userID, err)
+	}
+	key.ID = strconv.FormatInt(id, 10)
+	return key, nil
+}
+
+// ListAPIKeys implements database.APIKeyStore.
+func (s *Store) ListAPIKeys(ctx context.Context, userID string) ([]database.APIKey, error) {
+	ctx, done := observe(ctx, "list_api_keys")
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_id, name, prefix, scopes, created_at, last_used_at, revoked_at
+		FROM api_keys WHERE user_id = ? ORDER BY created_at DESC, id DESC`, userID)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("error listing api keys for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	keys := []database.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning api key for user %s: %w", userID, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing api keys for user %s: %w", userID, err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey implements database.APIKeyStore.
+func (s *Store) RevokeAPIKey(ctx context.Context, userID, keyID string) (bool, error) {
+	ctx, done := observe(ctx, "revoke_api_key")
+	result, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = ?
+		WHERE CAST(id AS TEXT) = ? AND user_id = ? AND revoked_at IS NULL`, millis(time.Now()), keyID, userID)
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	done(err)
+	if err != nil {
+		return false, fmt.Errorf("error revoking api key %s for user %s: %w", keyID, userID, err)
+	}
+	return affected > 0, nil
+}
+
+// UseAPIKey implements database.APIKeyStore.
+func (s *Store) UseAPIKey(ctx context.Context, keyHash string) (*database.APIKey, error) {
+	ctx, done := observe(ctx, "use_api_key")
+	row := s.db.QueryRowContext(ctx, `SELECT id, user_id, name, prefix, scopes, created_at, last_used_at, revoked_at
+		FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL`, keyHash)
+	key, err := scanAPIKey(row)
+	if err == nil {
+		// Only a stale key is updated, so most lookups of a busy key are reads
+		if now := fromMillis(millis(time.Now())); key.UseIsStale(now) {
+			_, err = s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", millis(now), key.ID)
+			key.LastUsedAt = &now
+		}
+	}
+	done(err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // Unknown or revoked key
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error looking up api key: %w", err)
+	}
+	return &key, nil
+}
+
+// scanAPIKey reads the id, user_id, name, prefix, scopes, created_at,
+// last_used_at and revoked_at columns of a key.
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (database.APIKey, error) {
+	var key database.APIKey
+	var scopes string
+	var createdAt int64
+	var lastUsedAt, revokedAt sql.NullInt64
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &createdAt, &lastUsedAt, &revokedAt); err != nil {
+		return database.APIKey{}, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return database.APIKey{}, fmt.Errorf("error decoding api key scopes: %w", err)
+	}
+	key.CreatedAt = fromMillis(createdAt)
+	if lastUsedAt.Valid {
+		t := fromMillis(lastUsedAt.Int64)
+		key.LastUsedAt = &t
+	}
+	if revokedAt.Valid {
+		t := fromMillis(revokedAt.Int64)
+		key.RevokedAt = &t
+	}
+	return key, nil
+}
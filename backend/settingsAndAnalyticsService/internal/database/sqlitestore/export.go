@@ -0,0 +1,63 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ExportUser collects a user's settings, analytics, API keys (without their
+// hashes) and linked IPs, keyed as database.ExportUser keys them.
+func (s *Store) ExportUser(ctx context.Context, userID string) (*database.UserExport, error) {
+	export := &database.UserExport{
+		UserID:     userID,
+		ExportedAt: time.Now().UTC(),
+		Settings:   make(map[string]bson.M),
+	}
+
+	for _, category := range []database.SettingsCategory{database.CategoryGeneral, database.CategoryPrivacy, database.CategoryParental} {
+		var doc bson.M
+		err := s.FindSettings(ctx, category, userID, &doc)
+		if errors.Is(err, database.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s settings of user %s: %w", category, userID, err)
+		}
+		export.Settings[string(category)] = doc
+	}
+
+	ctx, done := observe(ctx, "find_lists")
+	lists, found, err := readLists(ctx, s.db, userID)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("error reading deny/allow lists of user %s: %w", userID, err)
+	}
+	if found {
+		export.Settings["DenyAllowList"] = bson.M{
+			"userId":                   userID,
+			string(database.DenyList):  lists.Denied,
+			string(database.AllowList): lists.Allowed,
+		}
+	}
+
+	analytics, err := s.FindUserAnalytics(ctx, userID)
+	switch {
+	case err == nil:
+		export.Analytics = &analytics
+	case !errors.Is(err, database.ErrNotFound):
+		return nil, err
+	}
+
+	if export.APIKeys, err = s.ListAPIKeys(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.LinkedIPs, err = s.ListLinkedIPs(ctx, userID); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
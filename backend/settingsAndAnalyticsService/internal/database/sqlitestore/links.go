@@ -0,0 +1,143 @@
+package sqlitestore
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"go.uber.org/zap"
+)
+
+// Links are few in the deployments the embedded backend is meant for, so
+// lookups read them all and match addresses in Go, as SQLite has no network
+// types. The iplinks.Resolver in front of the store caches the results.
+
+// LinkIP links an address or a network to a user from now on, as the dashboard
+// does in PostgreSQL. It returns the linked network.
+func (s *Store) LinkIP(ctx context.Context, userID, ip string) (netip.Prefix, error) {
+	network, err := database.ParseNetwork(ip)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if userID == "" {
+		return netip.Prefix{}, fmt.Errorf("user ID must not be empty")
+	}
+
+	ctx, done := observe(ctx, "link_ip")
+	_, err = s.db.ExecContext(ctx, `INSERT INTO linked_ips (user_id, ip, time) VALUES (?, ?, ?)`, userID, ip, millis(time.Now()))
+	done(err)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("error linking %s to user %s: %w", ip, userID, err)
+	}
+	return network, nil
+}
+
+// ListLinkedIPs returns the addresses linked to a user, oldest first.
+func (s *Store) ListLinkedIPs(ctx context.Context, userID string) ([]database.LinkedIP, error) {
+	ctx, done := observe(ctx, "list_linked_ips")
+	rows, err := s.db.QueryContext(ctx, `SELECT ip, time FROM linked_ips WHERE user_id = ? ORDER BY time, id`, userID)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("error listing linked ips for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	ips := []database.LinkedIP{}
+	for rows.Next() {
+		var ip database.LinkedIP
+		var at int64
+		if err := rows.Scan(&ip.IP, &at); err != nil {
+			return nil, fmt.Errorf("error scanning linked ip for user %s: %w", userID, err)
+		}
+		ip.Time = fromMillis(at)
+		ips = append(ips, ip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing linked ips for user %s: %w", userID, err)
+	}
+	return ips, nil
+}
+
+// UserIDByIP implements database.IPLinkStore.
+func (s *Store) UserIDByIP(ctx context.Context, ip netip.Addr) (string, error) {
+	users, err := s.UserIDsByIP(ctx, []netip.Addr{ip})
+	if err != nil {
+		return "", err
+	}
+	return users[ip], nil
+}
+
+// UserIDsByIP implements database.IPLinkStore. The current link of the most
+// specific network containing an address wins.
+func (s *Store) UserIDsByIP(ctx context.Context, ips []netip.Addr) (map[netip.Addr]string, error) {
+	intervals, err := s.linkIntervals(ctx, "user_ids_by_ip")
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[netip.Addr]string)
+	for _, ip := range ips {
+		bits := -1
+		for _, link := range intervals {
+			if link.Until.IsZero() && link.Network.Bits() > bits && link.Network.Contains(ip.Unmap()) {
+				users[ip], bits = link.UserID, link.Network.Bits()
+			}
+		}
+	}
+	return users, nil
+}
+
+// LinkHistories implements database.IPLinkStore.
+func (s *Store) LinkHistories(ctx context.Context, ips []netip.Addr, from, to time.Time) (map[netip.Addr]database.LinkHistory, error) {
+	intervals, err := s.linkIntervals(ctx, "link_histories")
+	if err != nil {
+		return nil, err
+	}
+	histories := make(map[netip.Addr]database.LinkHistory)
+	for _, ip := range ips {
+		for _, link := range intervals {
+			if link.Network.Contains(ip.Unmap()) && link.Overlaps(from, to) {
+				histories[ip] = append(histories[ip], link)
+			}
+		}
+	}
+	return histories, nil
+}
+
+// linkIntervals returns the validity intervals of every link. Rows whose ip
+// is not an address or a network are skipped, as PostgreSQL skips them.
+func (s *Store) linkIntervals(ctx context.Context, query string) ([]database.LinkInterval, error) {
+	ctx, done := observe(ctx, query)
+	links, err := s.links(ctx)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("error reading linked ips: %w", err)
+	}
+	return database.LinkIntervals(links), nil
+}
+
+func (s *Store) links(ctx context.Context) ([]database.Link, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id, ip, time FROM linked_ips ORDER BY time, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []database.Link
+	for rows.Next() {
+		var link database.Link
+		var ip string
+		var at int64
+		if err := rows.Scan(&link.UserID, &ip, &at); err != nil {
+			return nil, err
+		}
+		if link.Network, err = database.ParseNetwork(ip); err != nil {
+			zap.L().Warn("Skipping linked ip that is not an address", zap.String("ip", ip), zap.Error(err))
+			continue
+		}
+		link.Time = fromMillis(at)
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
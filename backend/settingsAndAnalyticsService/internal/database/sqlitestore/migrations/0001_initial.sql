@@ -0,0 +1,52 @@
+-- Settings documents are stored as BSON, as MongoDB stores them, so that
+-- fields the service does not know yet survive a round trip.
+CREATE TABLE settings (
+    category TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    document BLOB NOT NULL,
+    PRIMARY KEY (category, user_id)
+);
+
+CREATE TABLE domain_lists (
+    user_id TEXT PRIMARY KEY,
+    denied TEXT NOT NULL,  -- JSON arrays of domains, in insertion order
+    allowed TEXT NOT NULL
+);
+
+CREATE TABLE user_analytics (
+    user_id TEXT PRIMARY KEY,
+    document TEXT NOT NULL -- JSON encoded UserAnalytics
+);
+
+-- One row per query, rather than a document per client address.
+CREATE TABLE dns_queries (
+    id INTEGER PRIMARY KEY,
+    ip TEXT NOT NULL,
+    domain TEXT NOT NULL,
+    dropped INTEGER NOT NULL,
+    time INTEGER NOT NULL -- Unix milliseconds, the precision of MongoDB dates
+);
+CREATE INDEX dns_queries_ip ON dns_queries (ip);
+
+-- Like the linked_ips table of PostgreSQL: ip holds an address or a network,
+-- as written by the link-ip command.
+CREATE TABLE linked_ips (
+    id INTEGER PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    time INTEGER NOT NULL -- Unix milliseconds
+);
+CREATE INDEX linked_ips_user_id ON linked_ips (user_id, time);
+
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL, -- JSON array
+    created_at INTEGER NOT NULL, -- Unix milliseconds
+    last_used_at INTEGER,
+    revoked_at INTEGER
+);
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,271 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FindSettings implements database.SettingsStore.
+func (s *Store) FindSettings(ctx context.Context, category database.SettingsCategory, userID string, result any) error {
+	if err := checkCategory(category); err != nil {
+		return err
+	}
+	ctx, done := observe(ctx, "find_settings")
+	var raw []byte
+	err := s.db.QueryRowContext(ctx, `SELECT document FROM settings WHERE category = ? AND user_id = ?`, category, userID).Scan(&raw)
+	done(err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching %s settings: %w", category, err)
+	}
+	return bson.Unmarshal(raw, result)
+}
+
+// UpdateSettings implements database.SettingsStore. The transaction holds the
+// write lock from the start, so the revision check cannot race another writer.
+func (s *Store) UpdateSettings(ctx context.Context, category database.SettingsCategory, userID string, fields map[string]any, revisions []int64, result any) error {
+	if err := checkCategory(category); err != nil {
+		return err
+	}
+
+	var raw bson.Raw
+	ctx, done := observe(ctx, "update_settings")
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		doc, err := document(ctx, tx, category, userID)
+		if err != nil {
+			return err
+		}
+		if len(revisions) > 0 && !slices.Contains(revisions, revision(doc)) {
+			return database.ErrRevisionMismatch
+		}
+		raw, err = write(ctx, tx, category, userID, doc, fields)
+		return err
+	})
+	done(err)
+	switch {
+	case errors.Is(err, database.ErrRevisionMismatch):
+		return err
+	case err != nil:
+		return fmt.Errorf("error updating %s settings: %w", category, err)
+	}
+	return bson.Unmarshal(raw, result)
+}
+
+// ReplaceSettings implements database.SettingsStore in a single transaction.
+func (s *Store) ReplaceSettings(ctx context.Context, userID string, categories map[database.SettingsCategory]map[string]any, lists database.DomainLists) error {
+	ctx, done := observe(ctx, "replace_settings")
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for category, fields := range categories {
+			if err := checkCategory(category); err != nil {
+				return err
+			}
+			doc, err := document(ctx, tx, category, userID)
+			if err != nil {
+				return err
+			}
+			if _, err := write(ctx, tx, category, userID, doc, fields); err != nil {
+				return err
+			}
+		}
+		return writeLists(ctx, tx, userID, lists)
+	})
+	done(err)
+	if err != nil {
+		return fmt.Errorf("error replacing settings: %w", err)
+	}
+	return nil
+}
+
+func checkCategory(category database.SettingsCategory) error {
+	switch category {
+	case database.CategoryGeneral, database.CategoryPrivacy, database.CategoryParental:
+		return nil
+	}
+	return fmt.Errorf("unknown settings category %q", category)
+}
+
+// document decodes the stored settings of a user, or returns nil if there are none.
+func document(ctx context.Context, tx *sql.Tx, category database.SettingsCategory, userID string) (bson.M, error) {
+	var raw []byte
+	err := tx.QueryRowContext(ctx, `SELECT document FROM settings WHERE category = ? AND user_id = ?`, category, userID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("error decoding %s settings: %w", category, err)
+	}
+	return doc, nil
+}
+
+// write sets fields on doc, created if nil, increments its revision and stores it.
+func write(ctx context.Context, tx *sql.Tx, category database.SettingsCategory, userID string, doc bson.M, fields map[string]any) (bson.Raw, error) {
+	if doc == nil {
+		doc = bson.M{"userId": userID}
+	}
+	for name, value := range fields {
+		doc[name] = value
+	}
+	doc["revision"] = revision(doc) + 1
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s settings: %w", category, err)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO settings (category, user_id, document) VALUES (?, ?, ?)
+		ON CONFLICT (category, user_id) DO UPDATE SET document = excluded.document`, category, userID, raw)
+	return raw, err
+}
+
+// revision returns the revision of a settings document, 0 if it has none.
+func revision(doc bson.M) int64 {
+	switch value := doc["revision"].(type) {
+	case int64:
+		return value
+	case int32:
+		return int64(value)
+	default:
+		return 0
+	}
+}
+
+// FindLists implements database.ListStore.
+func (s *Store) FindLists(ctx context.Context, userID string) (database.DomainLists, error) {
+	ctx, done := observe(ctx, "find_lists")
+	lists, _, err := readLists(ctx, s.db, userID)
+	done(err)
+	if err != nil {
+		return database.DomainLists{}, fmt.Errorf("error fetching deny/allow lists: %w", err)
+	}
+	return lists, nil
+}
+
+// AddDomain implements database.ListStore.
+func (s *Store) AddDomain(ctx context.Context, userID string, list database.DomainList, domain string) (bool, error) {
+	var added bool
+	ctx, done := observe(ctx, "add_domain")
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		lists, _, err := readLists(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		domains, err := listOf(&lists, list)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(*domains, domain) {
+			*domains = append(*domains, domain)
+			added = true
+		}
+		return writeLists(ctx, tx, userID, lists)
+	})
+	done(err)
+	if err != nil {
+		return false, fmt.Errorf("error adding domain to %s: %w", list, err)
+	}
+	return added, nil
+}
+
+// RemoveDomain implements database.ListStore.
+func (s *Store) RemoveDomain(ctx context.Context, userID string, list database.DomainList, domain string) (bool, error) {
+	var removed bool
+	ctx, done := observe(ctx, "remove_domain")
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		lists, found, err := readLists(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return database.ErrNotFound
+		}
+		domains, err := listOf(&lists, list)
+		if err != nil {
+			return err
+		}
+		i := slices.Index(*domains, domain)
+		if i < 0 {
+			return nil
+		}
+		*domains = slices.Delete(*domains, i, i+1)
+		removed = true
+		return writeLists(ctx, tx, userID, lists)
+	})
+	done(err)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return false, err
+	case err != nil:
+		return false, fmt.Errorf("error removing domain from %s: %w", list, err)
+	}
+	return removed, nil
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// readLists returns the lists of a user and whether the user has any.
+func readLists(ctx context.Context, q queryer, userID string) (database.DomainLists, bool, error) {
+	var denied, allowed string
+	err := q.QueryRowContext(ctx, `SELECT denied, allowed FROM domain_lists WHERE user_id = ?`, userID).Scan(&denied, &allowed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.DomainLists{}, false, nil
+	}
+	if err != nil {
+		return database.DomainLists{}, false, err
+	}
+	var lists database.DomainLists
+	if err := json.Unmarshal([]byte(denied), &lists.Denied); err != nil {
+		return database.DomainLists{}, false, fmt.Errorf("error decoding deny list: %w", err)
+	}
+	if err := json.Unmarshal([]byte(allowed), &lists.Allowed); err != nil {
+		return database.DomainLists{}, false, fmt.Errorf("error decoding allow list: %w", err)
+	}
+	return lists, true, nil
+}
+
+func writeLists(ctx context.Context, tx *sql.Tx, userID string, lists database.DomainLists) error {
+	denied, err := json.Marshal(nonNil(lists.Denied))
+	if err != nil {
+		return err
+	}
+	allowed, err := json.Marshal(nonNil(lists.Allowed))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO domain_lists (user_id, denied, allowed) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET denied = excluded.denied, allowed = excluded.allowed`, userID, denied, allowed)
+	return err
+}
+
+func listOf(lists *database.DomainLists, list database.DomainList) (*[]string, error) {
+	switch list {
+	case database.DenyList:
+		return &lists.Denied, nil
+	case database.AllowList:
+		return &lists.Allowed, nil
+	default:
+		return nil, fmt.Errorf("unknown domain list %q", list)
+	}
+}
+
+// nonNil returns domains, or an empty list if it is nil, so that lists are stored as JSON arrays.
+func nonNil(domains []string) []string {
+	if domains == nil {
+		return []string{}
+	}
+	return domains
+}
@@ -0,0 +1,187 @@
+// Package sqlitestore implements the database stores in a SQLite database, so
+// that the service runs as a single binary with a data directory instead of
+// MongoDB and PostgreSQL. Several processes may open the same directory at
+// once, e.g. serve and an ETL run from cron.
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/metrics"
+	"github.com/BrachiGH/firedns-dashboard/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite" // Pure Go, so that the binary needs no C toolchain
+)
+
+// File is the name of the database in the data directory.
+const File = "firedns.db"
+
+// migrationFiles holds the schema as numbered scripts, NNNN_name.sql, applied
+// in order on Open. Never edit a released migration; add the next one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Store implements every store of database.Stores. Create stores with Open.
+type Store struct {
+	db   *sql.DB
+	path string
+}
+
+var (
+	_ database.SettingsStore  = (*Store)(nil)
+	_ database.ListStore      = (*Store)(nil)
+	_ database.AnalyticsStore = (*Store)(nil)
+	_ database.IPLinkStore    = (*Store)(nil)
+	_ database.APIKeyStore    = (*Store)(nil)
+)
+
+// Open opens the database of dir, creating the directory and the database if
+// needed, and brings its schema up to date.
+func Open(ctx context.Context, dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating data directory: %w", err)
+	}
+	path := filepath.Join(dir, File)
+
+	// Writers take the lock when their transaction begins, so that concurrent
+	// read-modify-write transactions wait for each other instead of failing
+	params := url.Values{
+		"_pragma": {"busy_timeout(10000)", "journal_mode(WAL)", "synchronous(NORMAL)"},
+		"_txlock": {"immediate"},
+	}
+	db, err := sql.Open("sqlite", path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("error opening embedded database: %w", err)
+	}
+	s := &Store{db: db, path: path}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	zap.L().Info("Opened embedded database", zap.String("path", path))
+	return s, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("error closing embedded database: %w", err)
+	}
+	zap.L().Info("Closed embedded database")
+	return nil
+}
+
+// Ping checks that the database can still be queried.
+func (s *Store) Ping(ctx context.Context) error {
+	if err := s.db.QueryRowContext(ctx, `SELECT 1`).Scan(new(int)); err != nil {
+		return fmt.Errorf("error querying embedded database %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Stores returns s as every store of the API.
+func (s *Store) Stores() database.Stores {
+	return database.Stores{
+		Settings:  s,
+		Lists:     s,
+		Analytics: s,
+		IPLinks:   s,
+		APIKeys:   s,
+		Pings:     []database.Ping{{Name: "embedded", Check: s.Ping}},
+	}
+}
+
+// migrate applies the migrations the database has not run yet, recording its
+// version in the user_version pragma.
+func (s *Store) migrate(ctx context.Context) error {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	for i, name := range names { // Sorted by Glob
+		if prefix := fmt.Sprintf("%04d_", i+1); len(path.Base(name)) <= len(prefix) || path.Base(name)[:len(prefix)] != prefix {
+			return fmt.Errorf("migration %s: expected version %d, versions must be consecutive from 1", name, i+1)
+		}
+	}
+
+	ctx, done := observe(ctx, "migrate")
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		var version int
+		if err := tx.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+			return err
+		}
+		if version > len(names) {
+			return fmt.Errorf("schema is at version %d, ahead of this build (%d)", version, len(names))
+		}
+		for _, name := range names[version:] {
+			script, err := migrationFiles.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+				return fmt.Errorf("migration %s: %w", path.Base(name), err)
+			}
+			zap.L().Info("Applied embedded database migration", zap.String("migration", path.Base(name)))
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, len(names)))
+		return err
+	})
+	done(err)
+	if err != nil {
+		return fmt.Errorf("error migrating embedded database: %w", err)
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction, committed if fn succeeds.
+func (s *Store) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No-op once committed
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// observe records the duration and outcome of a query, as a metric and as a client span.
+func observe(ctx context.Context, query string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "sqlite "+query,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system.name", "sqlite"), attribute.String("db.operation.name", query)))
+	return ctx, func(err error) {
+		metrics.ObserveSQLite(query, start, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil // An empty result is not a failure
+		}
+		tracing.End(span, err)
+	}
+}
+
+// millis returns t as stored: Unix milliseconds, the precision of MongoDB dates.
+func millis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+// fromMillis returns a stored time as a UTC time.
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
@@ -0,0 +1,223 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func open(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := Open(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+type general struct {
+	UserID   string `bson:"userId"`
+	Revision int64  `bson:"revision"`
+	Theme    string `bson:"theme"`
+	Legacy   string `bson:"legacy"`
+}
+
+func TestSettings(t *testing.T) {
+	ctx := context.Background()
+	s := open(t, t.TempDir())
+
+	var got general
+	if err := s.FindSettings(ctx, database.CategoryGeneral, "alice", &got); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("FindSettings of a new user = %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateSettings(ctx, database.CategoryGeneral, "alice", map[string]any{"theme": "dark", "legacy": "kept"}, []int64{0}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Revision != 1 || got.Theme != "dark" || got.UserID != "alice" {
+		t.Fatalf("created %+v, want revision 1 of alice's dark theme", got)
+	}
+
+	err := s.UpdateSettings(ctx, database.CategoryGeneral, "alice", map[string]any{"theme": "light"}, []int64{0}, &got)
+	if !errors.Is(err, database.ErrRevisionMismatch) {
+		t.Fatalf("update at a stale revision = %v, want ErrRevisionMismatch", err)
+	}
+
+	lists := database.DomainLists{Denied: []string{"ads.example"}}
+	if err := s.ReplaceSettings(ctx, "alice", map[database.SettingsCategory]map[string]any{database.CategoryGeneral: {"theme": "light"}}, lists); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.FindSettings(ctx, database.CategoryGeneral, "alice", &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Revision != 2 || got.Theme != "light" || got.Legacy != "kept" {
+		t.Fatalf("replaced %+v, want revision 2 with the light theme and the other fields kept", got)
+	}
+
+	if err := s.FindSettings(ctx, "unknown", "alice", &got); err == nil {
+		t.Fatal("FindSettings of an unknown category succeeded")
+	}
+}
+
+func TestLists(t *testing.T) {
+	ctx := context.Background()
+	s := open(t, t.TempDir())
+
+	if _, err := s.RemoveDomain(ctx, "alice", database.DenyList, "ads.example"); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("RemoveDomain without lists = %v, want ErrNotFound", err)
+	}
+	for _, want := range []bool{true, false} {
+		if added, err := s.AddDomain(ctx, "alice", database.DenyList, "ads.example"); err != nil || added != want {
+			t.Fatalf("AddDomain = %v, %v, want %v", added, err, want)
+		}
+	}
+	if _, err := s.AddDomain(ctx, "alice", database.AllowList, "example.org"); err != nil {
+		t.Fatal(err)
+	}
+	lists, err := s.FindLists(ctx, "alice")
+	if err != nil || len(lists.Denied) != 1 || len(lists.Allowed) != 1 {
+		t.Fatalf("FindLists = %+v, %v, want a domain in each list", lists, err)
+	}
+
+	if removed, err := s.RemoveDomain(ctx, "alice", database.DenyList, "ads.example"); err != nil || !removed {
+		t.Fatalf("RemoveDomain = %v, %v, want the domain removed", removed, err)
+	}
+	if removed, err := s.RemoveDomain(ctx, "alice", database.DenyList, "ads.example"); err != nil || removed {
+		t.Fatalf("second RemoveDomain = %v, %v, want nothing left to remove", removed, err)
+	}
+}
+
+func TestAnalyticsAndLinks(t *testing.T) {
+	ctx := context.Background()
+	s := open(t, t.TempDir())
+
+	home := netip.MustParseAddr("2001:db8::10")
+	office := netip.MustParseAddr("192.0.2.1")
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []database.QueryEvent{
+		{IP: office, Domain: "example.org", Time: at},
+		{IP: home, Domain: "ads.example", Dropped: true, Time: at},
+		{IP: office, Domain: "example.com", Time: at.Add(time.Minute)},
+	}
+	if err := s.RecordQueryEvents(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.FetchAllDNSMessages(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].IP.Addr != office || messages[0].QuestionCount != 2 || len(messages[1].Dropped) != 1 {
+		t.Fatalf("messages = %+v, want one per address", messages)
+	}
+
+	for _, link := range []struct{ user, ip string }{{"alice", "2001:db8::/56"}, {"bob", "192.0.2.0/24"}, {"carol", "192.0.2.1"}, {"dave", "not an address"}} {
+		if _, err := s.LinkIP(ctx, link.user, link.ip); err != nil && link.user != "dave" {
+			t.Fatal(err)
+		}
+	}
+	users, err := s.UserIDsByIP(ctx, []netip.Addr{home, office, netip.MustParseAddr("192.0.2.2"), netip.MustParseAddr("198.51.100.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 || users[home] != "alice" || users[office] != "carol" {
+		t.Fatalf("users = %v, want the most specific links", users)
+	}
+	histories, err := s.LinkHistories(ctx, []netip.Addr{office}, at, time.Time{})
+	if err != nil || len(histories[office]) != 2 {
+		t.Fatalf("histories = %v, %v, want bob's and carol's networks", histories, err)
+	}
+
+	analytics := database.UserAnalytics{UserID: "carol", LastUpdated: at, PassedCounts: map[string]int{"example.org": 1}}
+	if err := s.UpsertUserAnalytics(ctx, analytics); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.FindUserAnalytics(ctx, "carol"); err != nil || got.PassedCounts["example.org"] != 1 || !got.LastUpdated.Equal(at) {
+		t.Fatalf("FindUserAnalytics = %+v, %v", got, err)
+	}
+	if _, err := s.FindUserAnalytics(ctx, "alice"); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("FindUserAnalytics of a user without analytics = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	s := open(t, t.TempDir())
+
+	key, err := s.CreateAPIKey(ctx, "alice", "cli", "fdns_ab", "hash", []string{"settings:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	used, err := s.UseAPIKey(ctx, "hash")
+	if err != nil || used == nil || used.ID != key.ID || used.LastUsedAt == nil || used.Scopes[0] != "settings:read" {
+		t.Fatalf("UseAPIKey = %+v, %v, want the key marked as used", used, err)
+	}
+	firstUse := *used.LastUsedAt
+	if _, err := s.db.Exec("UPDATE api_keys SET last_used_at = ?", millis(firstUse.Add(-time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	if used, err := s.UseAPIKey(ctx, "hash"); err != nil || used == nil || !used.LastUsedAt.Equal(firstUse.Add(-time.Second)) {
+		t.Fatalf("UseAPIKey right after a use = %+v, %v, want the last use left alone", used, err)
+	}
+	stale := firstUse.Add(-database.APIKeyUseResolution)
+	if _, err := s.db.Exec("UPDATE api_keys SET last_used_at = ?", millis(stale)); err != nil {
+		t.Fatal(err)
+	}
+	if used, err := s.UseAPIKey(ctx, "hash"); err != nil || used == nil || !used.LastUsedAt.After(stale) {
+		t.Fatalf("UseAPIKey of a stale key = %+v, %v, want the use recorded", used, err)
+	}
+
+	if revoked, err := s.RevokeAPIKey(ctx, "bob", key.ID); err != nil || revoked {
+		t.Fatalf("RevokeAPIKey of another user = %v, %v", revoked, err)
+	}
+	if revoked, err := s.RevokeAPIKey(ctx, "alice", key.ID); err != nil || !revoked {
+		t.Fatalf("RevokeAPIKey = %v, %v, want the key revoked", revoked, err)
+	}
+	if used, err := s.UseAPIKey(ctx, "hash"); err != nil || used != nil {
+		t.Fatalf("UseAPIKey of a revoked key = %+v, %v, want nil", used, err)
+	}
+	keys, err := s.ListAPIKeys(ctx, "alice")
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Fatalf("ListAPIKeys = %+v, %v, want the revoked key", keys, err)
+	}
+}
+
+func TestReopenKeepsData(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := Open(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddDomain(ctx, "alice", database.DenyList, "ads.example"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.LinkIP(ctx, "alice", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second process may hold the database open meanwhile
+	other := open(t, dir)
+	s = open(t, dir)
+	if err := other.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	export, err := s.ExportUser(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(export.LinkedIPs) != 1 || export.Settings["DenyAllowList"] == nil {
+		t.Fatalf("export = %+v, want the data written before reopening", export)
+	}
+	var lists bson.M = export.Settings["DenyAllowList"]
+	if denied, _ := lists[string(database.DenyList)].([]string); len(denied) != 1 {
+		t.Fatalf("exported lists = %v, want the denied domain", lists)
+	}
+}
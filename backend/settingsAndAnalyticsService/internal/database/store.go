@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// ErrNotFound is returned by stores when a user has no document of the requested kind.
+var ErrNotFound = errors.New("not found")
+
+// ErrRevisionMismatch is returned by a conditional settings update when the
+// stored settings are not at any of the expected revisions.
+var ErrRevisionMismatch = errors.New("revision does not match")
+
+// SettingsCategory names one of the settings documents of a user.
+type SettingsCategory string
+
+const (
+	CategoryGeneral  SettingsCategory = "general"
+	CategoryPrivacy  SettingsCategory = "privacy"
+	CategoryParental SettingsCategory = "parental"
+)
+
+// DomainList names one of the domain lists of a user, by its stored field.
+type DomainList string
+
+const (
+	DenyList  DomainList = "deniedDomains"
+	AllowList DomainList = "allowedDomains"
+)
+
+// DomainLists holds both domain lists of a user.
+type DomainLists struct {
+	Denied  []string
+	Allowed []string
+}
+
+// SettingsStore reads and writes the general, privacy and parental settings of
+// users. Settings documents are decoded into structs with bson tags, and each
+// carries a revision that every write increments.
+type SettingsStore interface {
+	// FindSettings decodes the user's document of a category into result. It
+	// returns ErrNotFound if the user never saved that category.
+	FindSettings(ctx context.Context, category SettingsCategory, userID string, result any) error
+
+	// UpdateSettings sets fields on the user's document of a category, creating
+	// it if needed, increments its revision and decodes the updated document
+	// into result. If revisions is not empty, the update only applies when the
+	// document is at one of them, revision 0 also matching a missing document;
+	// otherwise it returns ErrRevisionMismatch.
+	UpdateSettings(ctx context.Context, category SettingsCategory, userID string, fields map[string]any, revisions []int64, result any) error
+
+	// ReplaceSettings sets the fields of every category and both domain lists
+	// of a user at once, so that readers never see half of a configuration.
+	ReplaceSettings(ctx context.Context, userID string, categories map[SettingsCategory]map[string]any, lists DomainLists) error
+}
+
+// ListStore reads and writes the deny and allow lists of users.
+type ListStore interface {
+	// FindLists returns the domain lists of a user, both empty if the user has none.
+	FindLists(ctx context.Context, userID string) (DomainLists, error)
+
+	// AddDomain adds a domain to a list, creating the user's lists if needed.
+	// It reports whether the domain was not in the list yet.
+	AddDomain(ctx context.Context, userID string, list DomainList, domain string) (bool, error)
+
+	// RemoveDomain removes a domain from a list and reports whether it was
+	// there. It returns ErrNotFound if the user has no lists.
+	RemoveDomain(ctx context.Context, userID string, list DomainList, domain string) (bool, error)
+}
+
+// AnalyticsStore holds the DNS messages reported by the resolvers and the
+// per-user analytics aggregated from them by the ETL.
+type AnalyticsStore interface {
+	// FindUserAnalytics returns the analytics of a user, or ErrNotFound if the ETL never loaded any.
+	FindUserAnalytics(ctx context.Context, userID string) (UserAnalytics, error)
+
+	// UpsertUserAnalytics replaces the analytics of a user.
+	UpsertUserAnalytics(ctx context.Context, analytics UserAnalytics) error
+
+	// FetchAllDNSMessages returns every DNS message document.
+	FetchAllDNSMessages(ctx context.Context) ([]DNSMessage, error)
+
+	// RecordQueryEvents appends events to the DNS messages of their client address.
+	RecordQueryEvents(ctx context.Context, events []QueryEvent) error
+}
+
+// IPLinkStore resolves client addresses to the users they are linked to.
+type IPLinkStore interface {
+	// UserIDByIP returns the user an address, IPv4 or IPv6, is linked to,
+	// directly or through the most specific linked prefix, or "" if it is not linked.
+	UserIDByIP(ctx context.Context, ip netip.Addr) (string, error)
+
+	// UserIDsByIP resolves several addresses at once, as UserIDByIP does.
+	// Addresses that are not linked are left out of the result.
+	UserIDsByIP(ctx context.Context, ips []netip.Addr) (map[netip.Addr]string, error)
+
+	// LinkHistories returns, for each address of ips, the links of the
+	// networks containing it that were valid at some point between from and
+	// to, a zero to meaning until now. Addresses never linked in that range
+	// are left out of the result.
+	LinkHistories(ctx context.Context, ips []netip.Addr, from, to time.Time) (map[netip.Addr]LinkHistory, error)
+}
+
+// APIKeyStore holds the API keys of users, by the hash of their secret.
+type APIKeyStore interface {
+	// CreateAPIKey stores a new key and returns it with its ID and creation time.
+	CreateAPIKey(ctx context.Context, userID, name, prefix, keyHash string, scopes []string) (APIKey, error)
+
+	// ListAPIKeys returns every key of a user, including revoked ones, newest first.
+	ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+
+	// RevokeAPIKey revokes a key. It returns false if the user has no active key with that ID.
+	RevokeAPIKey(ctx context.Context, userID, keyID string) (bool, error)
+
+	// UseAPIKey returns the active key with that hash and records that it was
+	// used, at most once per APIKeyUseResolution. It returns nil, nil when no
+	// active key matches.
+	UseAPIKey(ctx context.Context, keyHash string) (*APIKey, error)
+}
+
+// Ping checks that one of the databases behind the stores is reachable.
+type Ping struct {
+	Name  string // Name of its health check
+	Check func(ctx context.Context) error
+}
+
+// Stores are the data stores behind the API.
+type Stores struct {
+	Settings  SettingsStore
+	Lists     ListStore
+	Analytics AnalyticsStore
+	IPLinks   IPLinkStore
+	APIKeys   APIKeyStore
+
+	// Pings are the databases behind the stores, as checked by the health
+	// endpoints and before each ETL run.
+	Pings []Ping
+}
@@ -0,0 +1,1034 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        (unknown)
+// source: firedns/resolver/v1/resolver.proto
+
+package resolverv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type QueryEvent_Action int32
+
+const (
+	QueryEvent_ACTION_UNSPECIFIED QueryEvent_Action = 0
+	// The query was resolved.
+	QueryEvent_ACTION_PASSED QueryEvent_Action = 1
+	// The query was blocked by the user's settings.
+	QueryEvent_ACTION_DROPPED QueryEvent_Action = 2
+)
+
+// Enum value maps for QueryEvent_Action.
+var (
+	QueryEvent_Action_name = map[int32]string{
+		0: "ACTION_UNSPECIFIED",
+		1: "ACTION_PASSED",
+		2: "ACTION_DROPPED",
+	}
+	QueryEvent_Action_value = map[string]int32{
+		"ACTION_UNSPECIFIED": 0,
+		"ACTION_PASSED":      1,
+		"ACTION_DROPPED":     2,
+	}
+)
+
+func (x QueryEvent_Action) Enum() *QueryEvent_Action {
+	p := new(QueryEvent_Action)
+	*p = x
+	return p
+}
+
+func (x QueryEvent_Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (QueryEvent_Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_firedns_resolver_v1_resolver_proto_enumTypes[0].Descriptor()
+}
+
+func (QueryEvent_Action) Type() protoreflect.EnumType {
+	return &file_firedns_resolver_v1_resolver_proto_enumTypes[0]
+}
+
+func (x QueryEvent_Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use QueryEvent_Action.Descriptor instead.
+func (QueryEvent_Action) EnumDescriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{12, 0}
+}
+
+type GetSettingsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to User:
+	//
+	//	*GetSettingsRequest_UserId
+	//	*GetSettingsRequest_Ip
+	User          isGetSettingsRequest_User `protobuf_oneof:"user"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSettingsRequest) Reset() {
+	*x = GetSettingsRequest{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSettingsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSettingsRequest) ProtoMessage() {}
+
+func (x *GetSettingsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSettingsRequest.ProtoReflect.Descriptor instead.
+func (*GetSettingsRequest) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetSettingsRequest) GetUser() isGetSettingsRequest_User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+func (x *GetSettingsRequest) GetUserId() string {
+	if x != nil {
+		if x, ok := x.User.(*GetSettingsRequest_UserId); ok {
+			return x.UserId
+		}
+	}
+	return ""
+}
+
+func (x *GetSettingsRequest) GetIp() string {
+	if x != nil {
+		if x, ok := x.User.(*GetSettingsRequest_Ip); ok {
+			return x.Ip
+		}
+	}
+	return ""
+}
+
+type isGetSettingsRequest_User interface {
+	isGetSettingsRequest_User()
+}
+
+type GetSettingsRequest_UserId struct {
+	// ID of the dashboard user.
+	UserId string `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3,oneof"`
+}
+
+type GetSettingsRequest_Ip struct {
+	// Client address linked to the user, as sent to the resolver.
+	Ip string `protobuf:"bytes,2,opt,name=ip,proto3,oneof"`
+}
+
+func (*GetSettingsRequest_UserId) isGetSettingsRequest_User() {}
+
+func (*GetSettingsRequest_Ip) isGetSettingsRequest_User() {}
+
+type GetSettingsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Settings      *UserSettings          `protobuf:"bytes,1,opt,name=settings,proto3" json:"settings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSettingsResponse) Reset() {
+	*x = GetSettingsResponse{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSettingsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSettingsResponse) ProtoMessage() {}
+
+func (x *GetSettingsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSettingsResponse.ProtoReflect.Descriptor instead.
+func (*GetSettingsResponse) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetSettingsResponse) GetSettings() *UserSettings {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+type WatchSettingsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Users to watch. At least one is required.
+	UserIds       []string `protobuf:"bytes,1,rep,name=user_ids,json=userIds,proto3" json:"user_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchSettingsRequest) Reset() {
+	*x = WatchSettingsRequest{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchSettingsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchSettingsRequest) ProtoMessage() {}
+
+func (x *WatchSettingsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchSettingsRequest.ProtoReflect.Descriptor instead.
+func (*WatchSettingsRequest) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *WatchSettingsRequest) GetUserIds() []string {
+	if x != nil {
+		return x.UserIds
+	}
+	return nil
+}
+
+type WatchSettingsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Settings      *UserSettings          `protobuf:"bytes,1,opt,name=settings,proto3" json:"settings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchSettingsResponse) Reset() {
+	*x = WatchSettingsResponse{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchSettingsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchSettingsResponse) ProtoMessage() {}
+
+func (x *WatchSettingsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchSettingsResponse.ProtoReflect.Descriptor instead.
+func (*WatchSettingsResponse) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *WatchSettingsResponse) GetSettings() *UserSettings {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+type ReportQueryEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Events to record. A stream may send any number of requests.
+	Events        []*QueryEvent `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportQueryEventsRequest) Reset() {
+	*x = ReportQueryEventsRequest{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportQueryEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportQueryEventsRequest) ProtoMessage() {}
+
+func (x *ReportQueryEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportQueryEventsRequest.ProtoReflect.Descriptor instead.
+func (*ReportQueryEventsRequest) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ReportQueryEventsRequest) GetEvents() []*QueryEvent {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+type ReportQueryEventsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Events stored.
+	Accepted int64 `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	// Events dropped because they were invalid, e.g. an unparsable client address.
+	Rejected      int64 `protobuf:"varint,2,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportQueryEventsResponse) Reset() {
+	*x = ReportQueryEventsResponse{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportQueryEventsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportQueryEventsResponse) ProtoMessage() {}
+
+func (x *ReportQueryEventsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportQueryEventsResponse.ProtoReflect.Descriptor instead.
+func (*ReportQueryEventsResponse) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ReportQueryEventsResponse) GetAccepted() int64 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *ReportQueryEventsResponse) GetRejected() int64 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+// UserSettings groups the settings the resolvers enforce for a user.
+type UserSettings struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	General       *GeneralSettings       `protobuf:"bytes,2,opt,name=general,proto3" json:"general,omitempty"`
+	Privacy       *PrivacySettings       `protobuf:"bytes,3,opt,name=privacy,proto3" json:"privacy,omitempty"`
+	Parental      *ParentalSettings      `protobuf:"bytes,4,opt,name=parental,proto3" json:"parental,omitempty"`
+	Lists         *DomainLists           `protobuf:"bytes,5,opt,name=lists,proto3" json:"lists,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserSettings) Reset() {
+	*x = UserSettings{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserSettings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserSettings) ProtoMessage() {}
+
+func (x *UserSettings) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserSettings.ProtoReflect.Descriptor instead.
+func (*UserSettings) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UserSettings) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *UserSettings) GetGeneral() *GeneralSettings {
+	if x != nil {
+		return x.General
+	}
+	return nil
+}
+
+func (x *UserSettings) GetPrivacy() *PrivacySettings {
+	if x != nil {
+		return x.Privacy
+	}
+	return nil
+}
+
+func (x *UserSettings) GetParental() *ParentalSettings {
+	if x != nil {
+		return x.Parental
+	}
+	return nil
+}
+
+func (x *UserSettings) GetLists() *DomainLists {
+	if x != nil {
+		return x.Lists
+	}
+	return nil
+}
+
+type GeneralSettings struct {
+	state                   protoimpl.MessageState `protogen:"open.v1"`
+	ThreatIntelligence      bool                   `protobuf:"varint,1,opt,name=threat_intelligence,json=threatIntelligence,proto3" json:"threat_intelligence,omitempty"`
+	GoogleSafeBrowsing      bool                   `protobuf:"varint,2,opt,name=google_safe_browsing,json=googleSafeBrowsing,proto3" json:"google_safe_browsing,omitempty"`
+	HomographProtection     bool                   `protobuf:"varint,3,opt,name=homograph_protection,json=homographProtection,proto3" json:"homograph_protection,omitempty"`
+	TyposquattingProtection bool                   `protobuf:"varint,4,opt,name=typosquatting_protection,json=typosquattingProtection,proto3" json:"typosquatting_protection,omitempty"`
+	BlockNewDomains         bool                   `protobuf:"varint,5,opt,name=block_new_domains,json=blockNewDomains,proto3" json:"block_new_domains,omitempty"`
+	BlockDynamicDns         bool                   `protobuf:"varint,6,opt,name=block_dynamic_dns,json=blockDynamicDns,proto3" json:"block_dynamic_dns,omitempty"`
+	BlockCsam               bool                   `protobuf:"varint,7,opt,name=block_csam,json=blockCsam,proto3" json:"block_csam,omitempty"`
+	unknownFields           protoimpl.UnknownFields
+	sizeCache               protoimpl.SizeCache
+}
+
+func (x *GeneralSettings) Reset() {
+	*x = GeneralSettings{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GeneralSettings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GeneralSettings) ProtoMessage() {}
+
+func (x *GeneralSettings) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GeneralSettings.ProtoReflect.Descriptor instead.
+func (*GeneralSettings) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GeneralSettings) GetThreatIntelligence() bool {
+	if x != nil {
+		return x.ThreatIntelligence
+	}
+	return false
+}
+
+func (x *GeneralSettings) GetGoogleSafeBrowsing() bool {
+	if x != nil {
+		return x.GoogleSafeBrowsing
+	}
+	return false
+}
+
+func (x *GeneralSettings) GetHomographProtection() bool {
+	if x != nil {
+		return x.HomographProtection
+	}
+	return false
+}
+
+func (x *GeneralSettings) GetTyposquattingProtection() bool {
+	if x != nil {
+		return x.TyposquattingProtection
+	}
+	return false
+}
+
+func (x *GeneralSettings) GetBlockNewDomains() bool {
+	if x != nil {
+		return x.BlockNewDomains
+	}
+	return false
+}
+
+func (x *GeneralSettings) GetBlockDynamicDns() bool {
+	if x != nil {
+		return x.BlockDynamicDns
+	}
+	return false
+}
+
+func (x *GeneralSettings) GetBlockCsam() bool {
+	if x != nil {
+		return x.BlockCsam
+	}
+	return false
+}
+
+type PrivacySettings struct {
+	state                  protoimpl.MessageState `protogen:"open.v1"`
+	AdGuardMobileAdsFilter bool                   `protobuf:"varint,1,opt,name=ad_guard_mobile_ads_filter,json=adGuardMobileAdsFilter,proto3" json:"ad_guard_mobile_ads_filter,omitempty"`
+	AdAway                 bool                   `protobuf:"varint,2,opt,name=ad_away,json=adAway,proto3" json:"ad_away,omitempty"`
+	HageziMultiPro         bool                   `protobuf:"varint,3,opt,name=hagezi_multi_pro,json=hageziMultiPro,proto3" json:"hagezi_multi_pro,omitempty"`
+	GoodbyeAds             bool                   `protobuf:"varint,4,opt,name=goodbye_ads,json=goodbyeAds,proto3" json:"goodbye_ads,omitempty"`
+	HostsVn                bool                   `protobuf:"varint,5,opt,name=hosts_vn,json=hostsVn,proto3" json:"hosts_vn,omitempty"`
+	NextDnsAdsTrackers     bool                   `protobuf:"varint,6,opt,name=next_dns_ads_trackers,json=nextDnsAdsTrackers,proto3" json:"next_dns_ads_trackers,omitempty"`
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *PrivacySettings) Reset() {
+	*x = PrivacySettings{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PrivacySettings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PrivacySettings) ProtoMessage() {}
+
+func (x *PrivacySettings) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PrivacySettings.ProtoReflect.Descriptor instead.
+func (*PrivacySettings) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PrivacySettings) GetAdGuardMobileAdsFilter() bool {
+	if x != nil {
+		return x.AdGuardMobileAdsFilter
+	}
+	return false
+}
+
+func (x *PrivacySettings) GetAdAway() bool {
+	if x != nil {
+		return x.AdAway
+	}
+	return false
+}
+
+func (x *PrivacySettings) GetHageziMultiPro() bool {
+	if x != nil {
+		return x.HageziMultiPro
+	}
+	return false
+}
+
+func (x *PrivacySettings) GetGoodbyeAds() bool {
+	if x != nil {
+		return x.GoodbyeAds
+	}
+	return false
+}
+
+func (x *PrivacySettings) GetHostsVn() bool {
+	if x != nil {
+		return x.HostsVn
+	}
+	return false
+}
+
+func (x *PrivacySettings) GetNextDnsAdsTrackers() bool {
+	if x != nil {
+		return x.NextDnsAdsTrackers
+	}
+	return false
+}
+
+type ParentalSettings struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Whether each app or service is blocked, by name.
+	BlockedApps map[string]bool `protobuf:"bytes,1,rep,name=blocked_apps,json=blockedApps,proto3" json:"blocked_apps,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	// When blocked apps are allowed, by English day name ("Monday").
+	RecreationSchedule map[string]*TimeRange `protobuf:"bytes,2,rep,name=recreation_schedule,json=recreationSchedule,proto3" json:"recreation_schedule,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *ParentalSettings) Reset() {
+	*x = ParentalSettings{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ParentalSettings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ParentalSettings) ProtoMessage() {}
+
+func (x *ParentalSettings) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ParentalSettings.ProtoReflect.Descriptor instead.
+func (*ParentalSettings) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ParentalSettings) GetBlockedApps() map[string]bool {
+	if x != nil {
+		return x.BlockedApps
+	}
+	return nil
+}
+
+func (x *ParentalSettings) GetRecreationSchedule() map[string]*TimeRange {
+	if x != nil {
+		return x.RecreationSchedule
+	}
+	return nil
+}
+
+type TimeRange struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Local time of day, e.g. "12:00 PM".
+	Start         string `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End           string `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TimeRange) Reset() {
+	*x = TimeRange{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TimeRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TimeRange) ProtoMessage() {}
+
+func (x *TimeRange) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TimeRange.ProtoReflect.Descriptor instead.
+func (*TimeRange) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *TimeRange) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *TimeRange) GetEnd() string {
+	if x != nil {
+		return x.End
+	}
+	return ""
+}
+
+type DomainLists struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	DeniedDomains  []string               `protobuf:"bytes,1,rep,name=denied_domains,json=deniedDomains,proto3" json:"denied_domains,omitempty"`
+	AllowedDomains []string               `protobuf:"bytes,2,rep,name=allowed_domains,json=allowedDomains,proto3" json:"allowed_domains,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *DomainLists) Reset() {
+	*x = DomainLists{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DomainLists) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DomainLists) ProtoMessage() {}
+
+func (x *DomainLists) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DomainLists.ProtoReflect.Descriptor instead.
+func (*DomainLists) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *DomainLists) GetDeniedDomains() []string {
+	if x != nil {
+		return x.DeniedDomains
+	}
+	return nil
+}
+
+func (x *DomainLists) GetAllowedDomains() []string {
+	if x != nil {
+		return x.AllowedDomains
+	}
+	return nil
+}
+
+// QueryEvent is one DNS question answered by a resolver.
+type QueryEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Address of the client that sent the question.
+	ClientIp string `protobuf:"bytes,1,opt,name=client_ip,json=clientIp,proto3" json:"client_ip,omitempty"`
+	// Queried domain name.
+	Domain        string                 `protobuf:"bytes,2,opt,name=domain,proto3" json:"domain,omitempty"`
+	Action        QueryEvent_Action      `protobuf:"varint,3,opt,name=action,proto3,enum=firedns.resolver.v1.QueryEvent_Action" json:"action,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=time,proto3" json:"time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryEvent) Reset() {
+	*x = QueryEvent{}
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryEvent) ProtoMessage() {}
+
+func (x *QueryEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_firedns_resolver_v1_resolver_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryEvent.ProtoReflect.Descriptor instead.
+func (*QueryEvent) Descriptor() ([]byte, []int) {
+	return file_firedns_resolver_v1_resolver_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *QueryEvent) GetClientIp() string {
+	if x != nil {
+		return x.ClientIp
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetAction() QueryEvent_Action {
+	if x != nil {
+		return x.Action
+	}
+	return QueryEvent_ACTION_UNSPECIFIED
+}
+
+func (x *QueryEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+var File_firedns_resolver_v1_resolver_proto protoreflect.FileDescriptor
+
+const file_firedns_resolver_v1_resolver_proto_rawDesc = "" +
+	"\n" +
+	"\"firedns/resolver/v1/resolver.proto\x12\x13firedns.resolver.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"I\n" +
+	"\x12GetSettingsRequest\x12\x19\n" +
+	"\auser_id\x18\x01 \x01(\tH\x00R\x06userId\x12\x10\n" +
+	"\x02ip\x18\x02 \x01(\tH\x00R\x02ipB\x06\n" +
+	"\x04user\"T\n" +
+	"\x13GetSettingsResponse\x12=\n" +
+	"\bsettings\x18\x01 \x01(\v2!.firedns.resolver.v1.UserSettingsR\bsettings\"1\n" +
+	"\x14WatchSettingsRequest\x12\x19\n" +
+	"\buser_ids\x18\x01 \x03(\tR\auserIds\"V\n" +
+	"\x15WatchSettingsResponse\x12=\n" +
+	"\bsettings\x18\x01 \x01(\v2!.firedns.resolver.v1.UserSettingsR\bsettings\"S\n" +
+	"\x18ReportQueryEventsRequest\x127\n" +
+	"\x06events\x18\x01 \x03(\v2\x1f.firedns.resolver.v1.QueryEventR\x06events\"S\n" +
+	"\x19ReportQueryEventsResponse\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x03R\baccepted\x12\x1a\n" +
+	"\brejected\x18\x02 \x01(\x03R\brejected\"\xa2\x02\n" +
+	"\fUserSettings\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12>\n" +
+	"\ageneral\x18\x02 \x01(\v2$.firedns.resolver.v1.GeneralSettingsR\ageneral\x12>\n" +
+	"\aprivacy\x18\x03 \x01(\v2$.firedns.resolver.v1.PrivacySettingsR\aprivacy\x12A\n" +
+	"\bparental\x18\x04 \x01(\v2%.firedns.resolver.v1.ParentalSettingsR\bparental\x126\n" +
+	"\x05lists\x18\x05 \x01(\v2 .firedns.resolver.v1.DomainListsR\x05lists\"\xd9\x02\n" +
+	"\x0fGeneralSettings\x12/\n" +
+	"\x13threat_intelligence\x18\x01 \x01(\bR\x12threatIntelligence\x120\n" +
+	"\x14google_safe_browsing\x18\x02 \x01(\bR\x12googleSafeBrowsing\x121\n" +
+	"\x14homograph_protection\x18\x03 \x01(\bR\x13homographProtection\x129\n" +
+	"\x18typosquatting_protection\x18\x04 \x01(\bR\x17typosquattingProtection\x12*\n" +
+	"\x11block_new_domains\x18\x05 \x01(\bR\x0fblockNewDomains\x12*\n" +
+	"\x11block_dynamic_dns\x18\x06 \x01(\bR\x0fblockDynamicDns\x12\x1d\n" +
+	"\n" +
+	"block_csam\x18\a \x01(\bR\tblockCsam\"\xff\x01\n" +
+	"\x0fPrivacySettings\x12:\n" +
+	"\x1aad_guard_mobile_ads_filter\x18\x01 \x01(\bR\x16adGuardMobileAdsFilter\x12\x17\n" +
+	"\aad_away\x18\x02 \x01(\bR\x06adAway\x12(\n" +
+	"\x10hagezi_multi_pro\x18\x03 \x01(\bR\x0ehageziMultiPro\x12\x1f\n" +
+	"\vgoodbye_ads\x18\x04 \x01(\bR\n" +
+	"goodbyeAds\x12\x19\n" +
+	"\bhosts_vn\x18\x05 \x01(\bR\ahostsVn\x121\n" +
+	"\x15next_dns_ads_trackers\x18\x06 \x01(\bR\x12nextDnsAdsTrackers\"\x84\x03\n" +
+	"\x10ParentalSettings\x12Y\n" +
+	"\fblocked_apps\x18\x01 \x03(\v26.firedns.resolver.v1.ParentalSettings.BlockedAppsEntryR\vblockedApps\x12n\n" +
+	"\x13recreation_schedule\x18\x02 \x03(\v2=.firedns.resolver.v1.ParentalSettings.RecreationScheduleEntryR\x12recreationSchedule\x1a>\n" +
+	"\x10BlockedAppsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\bR\x05value:\x028\x01\x1ae\n" +
+	"\x17RecreationScheduleEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x124\n" +
+	"\x05value\x18\x02 \x01(\v2\x1e.firedns.resolver.v1.TimeRangeR\x05value:\x028\x01\"3\n" +
+	"\tTimeRange\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\tR\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\tR\x03end\"]\n" +
+	"\vDomainLists\x12%\n" +
+	"\x0edenied_domains\x18\x01 \x03(\tR\rdeniedDomains\x12'\n" +
+	"\x0fallowed_domains\x18\x02 \x03(\tR\x0eallowedDomains\"\xfa\x01\n" +
+	"\n" +
+	"QueryEvent\x12\x1b\n" +
+	"\tclient_ip\x18\x01 \x01(\tR\bclientIp\x12\x16\n" +
+	"\x06domain\x18\x02 \x01(\tR\x06domain\x12>\n" +
+	"\x06action\x18\x03 \x01(\x0e2&.firedns.resolver.v1.QueryEvent.ActionR\x06action\x12.\n" +
+	"\x04time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\"G\n" +
+	"\x06Action\x12\x16\n" +
+	"\x12ACTION_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rACTION_PASSED\x10\x01\x12\x12\n" +
+	"\x0eACTION_DROPPED\x10\x022\xd3\x02\n" +
+	"\x0fResolverService\x12`\n" +
+	"\vGetSettings\x12'.firedns.resolver.v1.GetSettingsRequest\x1a(.firedns.resolver.v1.GetSettingsResponse\x12h\n" +
+	"\rWatchSettings\x12).firedns.resolver.v1.WatchSettingsRequest\x1a*.firedns.resolver.v1.WatchSettingsResponse0\x01\x12t\n" +
+	"\x11ReportQueryEvents\x12-.firedns.resolver.v1.ReportQueryEventsRequest\x1a..firedns.resolver.v1.ReportQueryEventsResponse(\x01BSZQgithub.com/BrachiGH/firedns-dashboard/internal/gen/firedns/resolver/v1;resolverv1b\x06proto3"
+
+var (
+	file_firedns_resolver_v1_resolver_proto_rawDescOnce sync.Once
+	file_firedns_resolver_v1_resolver_proto_rawDescData []byte
+)
+
+func file_firedns_resolver_v1_resolver_proto_rawDescGZIP() []byte {
+	file_firedns_resolver_v1_resolver_proto_rawDescOnce.Do(func() {
+		file_firedns_resolver_v1_resolver_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_firedns_resolver_v1_resolver_proto_rawDesc), len(file_firedns_resolver_v1_resolver_proto_rawDesc)))
+	})
+	return file_firedns_resolver_v1_resolver_proto_rawDescData
+}
+
+var file_firedns_resolver_v1_resolver_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_firedns_resolver_v1_resolver_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_firedns_resolver_v1_resolver_proto_goTypes = []any{
+	(QueryEvent_Action)(0),            // 0: firedns.resolver.v1.QueryEvent.Action
+	(*GetSettingsRequest)(nil),        // 1: firedns.resolver.v1.GetSettingsRequest
+	(*GetSettingsResponse)(nil),       // 2: firedns.resolver.v1.GetSettingsResponse
+	(*WatchSettingsRequest)(nil),      // 3: firedns.resolver.v1.WatchSettingsRequest
+	(*WatchSettingsResponse)(nil),     // 4: firedns.resolver.v1.WatchSettingsResponse
+	(*ReportQueryEventsRequest)(nil),  // 5: firedns.resolver.v1.ReportQueryEventsRequest
+	(*ReportQueryEventsResponse)(nil), // 6: firedns.resolver.v1.ReportQueryEventsResponse
+	(*UserSettings)(nil),              // 7: firedns.resolver.v1.UserSettings
+	(*GeneralSettings)(nil),           // 8: firedns.resolver.v1.GeneralSettings
+	(*PrivacySettings)(nil),           // 9: firedns.resolver.v1.PrivacySettings
+	(*ParentalSettings)(nil),          // 10: firedns.resolver.v1.ParentalSettings
+	(*TimeRange)(nil),                 // 11: firedns.resolver.v1.TimeRange
+	(*DomainLists)(nil),               // 12: firedns.resolver.v1.DomainLists
+	(*QueryEvent)(nil),                // 13: firedns.resolver.v1.QueryEvent
+	nil,                               // 14: firedns.resolver.v1.ParentalSettings.BlockedAppsEntry
+	nil,                               // 15: firedns.resolver.v1.ParentalSettings.RecreationScheduleEntry
+	(*timestamppb.Timestamp)(nil),     // 16: google.protobuf.Timestamp
+}
+var file_firedns_resolver_v1_resolver_proto_depIdxs = []int32{
+	7,  // 0: firedns.resolver.v1.GetSettingsResponse.settings:type_name -> firedns.resolver.v1.UserSettings
+	7,  // 1: firedns.resolver.v1.WatchSettingsResponse.settings:type_name -> firedns.resolver.v1.UserSettings
+	13, // 2: firedns.resolver.v1.ReportQueryEventsRequest.events:type_name -> firedns.resolver.v1.QueryEvent
+	8,  // 3: firedns.resolver.v1.UserSettings.general:type_name -> firedns.resolver.v1.GeneralSettings
+	9,  // 4: firedns.resolver.v1.UserSettings.privacy:type_name -> firedns.resolver.v1.PrivacySettings
+	10, // 5: firedns.resolver.v1.UserSettings.parental:type_name -> firedns.resolver.v1.ParentalSettings
+	12, // 6: firedns.resolver.v1.UserSettings.lists:type_name -> firedns.resolver.v1.DomainLists
+	14, // 7: firedns.resolver.v1.ParentalSettings.blocked_apps:type_name -> firedns.resolver.v1.ParentalSettings.BlockedAppsEntry
+	15, // 8: firedns.resolver.v1.ParentalSettings.recreation_schedule:type_name -> firedns.resolver.v1.ParentalSettings.RecreationScheduleEntry
+	0,  // 9: firedns.resolver.v1.QueryEvent.action:type_name -> firedns.resolver.v1.QueryEvent.Action
+	16, // 10: firedns.resolver.v1.QueryEvent.time:type_name -> google.protobuf.Timestamp
+	11, // 11: firedns.resolver.v1.ParentalSettings.RecreationScheduleEntry.value:type_name -> firedns.resolver.v1.TimeRange
+	1,  // 12: firedns.resolver.v1.ResolverService.GetSettings:input_type -> firedns.resolver.v1.GetSettingsRequest
+	3,  // 13: firedns.resolver.v1.ResolverService.WatchSettings:input_type -> firedns.resolver.v1.WatchSettingsRequest
+	5,  // 14: firedns.resolver.v1.ResolverService.ReportQueryEvents:input_type -> firedns.resolver.v1.ReportQueryEventsRequest
+	2,  // 15: firedns.resolver.v1.ResolverService.GetSettings:output_type -> firedns.resolver.v1.GetSettingsResponse
+	4,  // 16: firedns.resolver.v1.ResolverService.WatchSettings:output_type -> firedns.resolver.v1.WatchSettingsResponse
+	6,  // 17: firedns.resolver.v1.ResolverService.ReportQueryEvents:output_type -> firedns.resolver.v1.ReportQueryEventsResponse
+	15, // [15:18] is the sub-list for method output_type
+	12, // [12:15] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_firedns_resolver_v1_resolver_proto_init() }
+func file_firedns_resolver_v1_resolver_proto_init() {
+	if File_firedns_resolver_v1_resolver_proto != nil {
+		return
+	}
+	file_firedns_resolver_v1_resolver_proto_msgTypes[0].OneofWrappers = []any{
+		(*GetSettingsRequest_UserId)(nil),
+		(*GetSettingsRequest_Ip)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_firedns_resolver_v1_resolver_proto_rawDesc), len(file_firedns_resolver_v1_resolver_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_firedns_resolver_v1_resolver_proto_goTypes,
+		DependencyIndexes: file_firedns_resolver_v1_resolver_proto_depIdxs,
+		EnumInfos:         file_firedns_resolver_v1_resolver_proto_enumTypes,
+		MessageInfos:      file_firedns_resolver_v1_resolver_proto_msgTypes,
+	}.Build()
+	File_firedns_resolver_v1_resolver_proto = out.File
+	file_firedns_resolver_v1_resolver_proto_goTypes = nil
+	file_firedns_resolver_v1_resolver_proto_depIdxs = nil
+}
@@ -0,0 +1,222 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: firedns/resolver/v1/resolver.proto
+
+package resolverv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ResolverService_GetSettings_FullMethodName       = "/firedns.resolver.v1.ResolverService/GetSettings"
+	ResolverService_WatchSettings_FullMethodName     = "/firedns.resolver.v1.ResolverService/WatchSettings"
+	ResolverService_ReportQueryEvents_FullMethodName = "/firedns.resolver.v1.ResolverService/ReportQueryEvents"
+)
+
+// ResolverServiceClient is the client API for ResolverService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ResolverService is used by the DNS resolver nodes: they fetch the settings
+// of the users they resolve for, follow changes to them, and report the
+// queries they answer so that the analytics ETL can count them.
+type ResolverServiceClient interface {
+	// GetSettings returns every setting of one user. Users who never changed
+	// their settings get the defaults.
+	GetSettings(ctx context.Context, in *GetSettingsRequest, opts ...grpc.CallOption) (*GetSettingsResponse, error)
+	// WatchSettings sends the current settings of the requested users, then the
+	// new settings of a user each time they change, until the call is cancelled.
+	// A user whose settings fail to load is skipped until their next change.
+	// Changes are only seen by the replica that saved them, so watches are
+	// only complete while the settings API runs as a single replica; behind
+	// several, resolvers must also refresh with GetSettings.
+	WatchSettings(ctx context.Context, in *WatchSettingsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchSettingsResponse], error)
+	// ReportQueryEvents records the queries answered by a resolver. Events are
+	// stored in batches; the response counts the events that were stored.
+	ReportQueryEvents(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ReportQueryEventsRequest, ReportQueryEventsResponse], error)
+}
+
+type resolverServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewResolverServiceClient(cc grpc.ClientConnInterface) ResolverServiceClient {
+	return &resolverServiceClient{cc}
+}
+
+func (c *resolverServiceClient) GetSettings(ctx context.Context, in *GetSettingsRequest, opts ...grpc.CallOption) (*GetSettingsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetSettingsResponse)
+	err := c.cc.Invoke(ctx, ResolverService_GetSettings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *resolverServiceClient) WatchSettings(ctx context.Context, in *WatchSettingsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchSettingsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ResolverService_ServiceDesc.Streams[0], ResolverService_WatchSettings_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchSettingsRequest, WatchSettingsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ResolverService_WatchSettingsClient = grpc.ServerStreamingClient[WatchSettingsResponse]
+
+func (c *resolverServiceClient) ReportQueryEvents(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ReportQueryEventsRequest, ReportQueryEventsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ResolverService_ServiceDesc.Streams[1], ResolverService_ReportQueryEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ReportQueryEventsRequest, ReportQueryEventsResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ResolverService_ReportQueryEventsClient = grpc.ClientStreamingClient[ReportQueryEventsRequest, ReportQueryEventsResponse]
+
+// ResolverServiceServer is the server API for ResolverService service.
+// All implementations must embed UnimplementedResolverServiceServer
+// for forward compatibility.
+//
+// ResolverService is used by the DNS resolver nodes: they fetch the settings
+// of the users they resolve for, follow changes to them, and report the
+// queries they answer so that the analytics ETL can count them.
+type ResolverServiceServer interface {
+	// GetSettings returns every setting of one user. Users who never changed
+	// their settings get the defaults.
+	GetSettings(context.Context, *GetSettingsRequest) (*GetSettingsResponse, error)
+	// WatchSettings sends the current settings of the requested users, then the
+	// new settings of a user each time they change, until the call is cancelled.
+	// A user whose settings fail to load is skipped until their next change.
+	// Changes are only seen by the replica that saved them, so watches are
+	// only complete while the settings API runs as a single replica; behind
+	// several, resolvers must also refresh with GetSettings.
+	WatchSettings(*WatchSettingsRequest, grpc.ServerStreamingServer[WatchSettingsResponse]) error
+	// ReportQueryEvents records the queries answered by a resolver. Events are
+	// stored in batches; the response counts the events that were stored.
+	ReportQueryEvents(grpc.ClientStreamingServer[ReportQueryEventsRequest, ReportQueryEventsResponse]) error
+	mustEmbedUnimplementedResolverServiceServer()
+}
+
+// UnimplementedResolverServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedResolverServiceServer struct{}
+
+func (UnimplementedResolverServiceServer) GetSettings(context.Context, *GetSettingsRequest) (*GetSettingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSettings not implemented")
+}
+func (UnimplementedResolverServiceServer) WatchSettings(*WatchSettingsRequest, grpc.ServerStreamingServer[WatchSettingsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchSettings not implemented")
+}
+func (UnimplementedResolverServiceServer) ReportQueryEvents(grpc.ClientStreamingServer[ReportQueryEventsRequest, ReportQueryEventsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ReportQueryEvents not implemented")
+}
+func (UnimplementedResolverServiceServer) mustEmbedUnimplementedResolverServiceServer() {}
+func (UnimplementedResolverServiceServer) testEmbeddedByValue()                         {}
+
+// UnsafeResolverServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ResolverServiceServer will
+// result in compilation errors.
+type UnsafeResolverServiceServer interface {
+	mustEmbedUnimplementedResolverServiceServer()
+}
+
+func RegisterResolverServiceServer(s grpc.ServiceRegistrar, srv ResolverServiceServer) {
+	// If the following call pancis, it indicates UnimplementedResolverServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ResolverService_ServiceDesc, srv)
+}
+
+func _ResolverService_GetSettings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSettingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ResolverServiceServer).GetSettings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ResolverService_GetSettings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ResolverServiceServer).GetSettings(ctx, req.(*GetSettingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ResolverService_WatchSettings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchSettingsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ResolverServiceServer).WatchSettings(m, &grpc.GenericServerStream[WatchSettingsRequest, WatchSettingsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ResolverService_WatchSettingsServer = grpc.ServerStreamingServer[WatchSettingsResponse]
+
+func _ResolverService_ReportQueryEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ResolverServiceServer).ReportQueryEvents(&grpc.GenericServerStream[ReportQueryEventsRequest, ReportQueryEventsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ResolverService_ReportQueryEventsServer = grpc.ClientStreamingServer[ReportQueryEventsRequest, ReportQueryEventsResponse]
+
+// ResolverService_ServiceDesc is the grpc.ServiceDesc for ResolverService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ResolverService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "firedns.resolver.v1.ResolverService",
+	HandlerType: (*ResolverServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetSettings",
+			Handler:    _ResolverService_GetSettings_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchSettings",
+			Handler:       _ResolverService_WatchSettings_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReportQueryEvents",
+			Handler:       _ResolverService_ReportQueryEvents_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "firedns/resolver/v1/resolver.proto",
+}
@@ -3,16 +3,17 @@ package analytics
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"math"
 	"net/http"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/BrachiGH/firedns-dashboard/internal/database" // Adjust import path if needed
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"github.com/BrachiGH/firedns-dashboard/internal/tracing"
+	"go.uber.org/zap"
 )
 
 // AnalyticsChartDataPoint represents a single point in the time-series chart.
@@ -38,57 +39,24 @@ type AnalyticsResponse struct {
 	BlockedDomains  []AnalyticsDomainCount    `json:"blockedDomains"`  // Top blocked domains
 }
 
-// AnalyticsHandler routes requests for analytics data.
-func AnalyticsHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract userID from path, e.g., /analytics/user123
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) < 2 || pathParts[0] != "analytics" {
-		http.Error(w, "Invalid path format. Expected /analytics/{userID}", http.StatusBadRequest)
-		return
-	}
-	userID := pathParts[1]
-	if userID == "" {
-		http.Error(w, "User ID cannot be empty", http.StatusBadRequest)
-		return
-	}
-
-	// Get database handle for analytics data
-	db, err := database.GetAnalyticsDB()
-	if err != nil {
-		log.Printf("Error getting analytics database handle: %v", err)
-		http.Error(w, "Server configuration error (database)", http.StatusInternalServerError)
-		return
-	}
-	// Add a specific check if the collection handle could be nil (if applicable in GetAnalyticsDB)
-	// if db.UserAnalyticsCollection == nil { // Adjust field name if necessary
-	//  log.Println("Error: User Analytics MongoDB collection is not initialized.")
-	//  http.Error(w, "Server configuration error (collection)", http.StatusInternalServerError)
-	//  return
-	// }
-
-	switch r.Method {
-	case http.MethodGet:
-		getAnalyticsData(w, r, userID, db) // Pass db handle
-	default:
-		w.Header().Set("Allow", "GET")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// GetAnalytics handles GET /v1/users/{userID}/analytics.
+func GetAnalytics(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := analyticsRequest(w, r); ok {
+		getAnalyticsData(w, r, userID, db)
 	}
 }
 
 // getAnalyticsData handles GET requests to fetch user analytics data.
-func getAnalyticsData(w http.ResponseWriter, r *http.Request, userID string, db *database.Analytics_DB) {
-	log.Printf("GET /analytics/%s", userID)
-	var userAnalytics database.UserAnalytics
+func getAnalyticsData(w http.ResponseWriter, r *http.Request, userID string, db database.AnalyticsStore) {
+	logger := logging.FromContext(r.Context())
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second) // Increased timeout for potential aggregation
+	ctx, cancel := context.WithTimeout(r.Context(), api.AnalyticsTimeout)
 	defer cancel()
 
-	filter := bson.M{"userId": userID}
-	err := db.UserAnalyticsCollection.FindOne(ctx, filter).Decode(&userAnalytics) // Adjust field name if necessary
-
+	userAnalytics, err := db.FindUserAnalytics(ctx, userID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Printf("No analytics data found for userID %s, returning empty/default response.", userID)
+		if errors.Is(err, database.ErrNotFound) {
+			logger.Debug("No analytics data found, returning empty/default response")
 			// Return a default empty response
 			emptyResponse := AnalyticsResponse{
 				QueryChartData:  []AnalyticsChartDataPoint{},
@@ -99,19 +67,24 @@ func getAnalyticsData(w http.ResponseWriter, r *http.Request, userID string, db
 			json.NewEncoder(w).Encode(emptyResponse)
 			return
 		}
-		log.Printf("Error fetching analytics data for userID %s from DB: %v", userID, err)
-		http.Error(w, "Failed to retrieve analytics data", http.StatusInternalServerError)
+		logger.Error("Error fetching analytics data from DB", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to retrieve analytics data")
 		return
 	}
 
 	// --- Process Data ---
+	_, span := tracing.Start(r.Context(), "analytics.process")
 	response := processUserAnalytics(userAnalytics)
+	span.End()
 
 	// --- Send Response ---
+	_, span = tracing.Start(r.Context(), "analytics.encode")
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding analytics response for userID %s: %v", userID, err)
-		// Avoid writing header again if already written by http.Error
+	err = json.NewEncoder(w).Encode(response)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Error("Error encoding analytics response", zap.Error(err))
+		// Avoid writing header again if already written by problem.Write
 	}
 }
 
@@ -142,8 +115,8 @@ func processUserAnalytics(data database.UserAnalytics) AnalyticsResponse {
 	chartData := generateChartData(data.PassedDomains, data.DroppedDomains)
 
 	// Get Top Domains
-	topResolved := getTopDomains(resolvedDomainsMap, 6) // Get top 6 resolved
-	topBlocked := getTopDomains(blockedDomainsMap, 6)   // Get top 6 blocked
+	topResolved := getTopDomains(resolvedDomainsMap, api.TopDomains)
+	topBlocked := getTopDomains(blockedDomainsMap, api.TopDomains)
 
 	return AnalyticsResponse{
 		TotalQueries:    totalQueries,
@@ -223,7 +196,7 @@ func getTopDomains(domainCounts map[string]int, limit int) []AnalyticsDomainCoun
 	})
 
 	// Take the top N
-	var topDomains []AnalyticsDomainCount
+	topDomains := []AnalyticsDomainCount{} // Encode as [] rather than null when there are none
 	for i := 0; i < len(ss) && i < limit; i++ {
 		topDomains = append(topDomains, AnalyticsDomainCount{
 			Domain: ss[i].Key,
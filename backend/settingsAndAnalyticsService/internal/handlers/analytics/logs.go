@@ -3,15 +3,15 @@ package analytics
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/BrachiGH/firedns-dashboard/internal/database" // Adjust import path if needed
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"go.uber.org/zap"
 )
 
 // LogEntryResponse defines the structure for a single log entry returned by the API.
@@ -22,66 +22,37 @@ type LogEntryResponse struct {
 	Status    string    `json:"status"`    // "allowed" or "blocked"
 }
 
-// LogsHandler routes requests for user query logs.
-func LogsHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract userID from path, e.g., /logs/user123
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) < 2 || pathParts[0] != "logs" {
-		http.Error(w, "Invalid path format. Expected /logs/{userID}", http.StatusBadRequest)
-		return
-	}
-	userID := pathParts[1]
-	if userID == "" {
-		http.Error(w, "User ID cannot be empty", http.StatusBadRequest)
-		return
-	}
-
-	// Get database handle for analytics data (contains the logs)
-	db, err := database.GetAnalyticsDB()
-	if err != nil {
-		log.Printf("Error getting analytics database handle for logs: %v", err)
-		http.Error(w, "Server configuration error (database)", http.StatusInternalServerError)
-		return
-	}
-	// Optional: Add check if db.UserAnalyticsCollection is nil if needed
-
-	switch r.Method {
-	case http.MethodGet:
-		getLogsData(w, r, userID, db) // Pass db handle
-	default:
-		w.Header().Set("Allow", "GET")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// GetLogs handles GET /v1/users/{userID}/logs.
+func GetLogs(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := analyticsRequest(w, r); ok {
+		getLogsData(w, r, userID, db)
 	}
 }
 
 // getLogsData handles GET requests to fetch user query logs.
-func getLogsData(w http.ResponseWriter, r *http.Request, userID string, db *database.Analytics_DB) {
-	log.Printf("GET /logs/%s", userID)
-	var userAnalytics database.UserAnalytics
+func getLogsData(w http.ResponseWriter, r *http.Request, userID string, db database.AnalyticsStore) {
+	logger := logging.FromContext(r.Context())
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), api.AnalyticsTimeout)
 	defer cancel()
 
-	filter := bson.M{"userId": userID}
-	// Fetch the document containing the domain lists
-	err := db.UserAnalyticsCollection.FindOne(ctx, filter).Decode(&userAnalytics)
-
+	userAnalytics, err := db.FindUserAnalytics(ctx, userID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Printf("No analytics/log data found for userID %s, returning empty list.", userID)
+		if errors.Is(err, database.ErrNotFound) {
+			logger.Debug("No analytics/log data found, returning empty list")
 			// Return an empty JSON array
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK) // Important to send 200 OK with empty list
 			json.NewEncoder(w).Encode([]LogEntryResponse{})
 			return
 		}
-		log.Printf("Error fetching analytics/log data for userID %s from DB: %v", userID, err)
-		http.Error(w, "Failed to retrieve log data", http.StatusInternalServerError)
+		logger.Error("Error fetching analytics/log data from DB", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to retrieve log data")
 		return
 	}
 
 	// --- Process Data: Combine Passed and Dropped into a single log list ---
-	var logEntries []LogEntryResponse
+	logEntries := []LogEntryResponse{} // Encode as [] rather than null when there are none
 
 	// Add passed domains
 	for _, entry := range userAnalytics.PassedDomains {
@@ -109,7 +80,7 @@ func getLogsData(w http.ResponseWriter, r *http.Request, userID string, db *data
 	// --- Send Response ---
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(logEntries); err != nil {
-		log.Printf("Error encoding logs response for userID %s: %v", userID, err)
-		// Avoid writing header again if already written by http.Error
+		logger.Error("Error encoding logs response", zap.Error(err))
+		// Avoid writing header again if already written by problem.Write
 	}
 }
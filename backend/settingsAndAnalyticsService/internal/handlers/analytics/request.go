@@ -0,0 +1,42 @@
+package analytics
+
+import (
+	"net/http"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+)
+
+// api holds the handler settings and store is the analytics database, both
+// replaced by Configure before the server starts.
+var (
+	api   = config.Default().API
+	store database.AnalyticsStore
+)
+
+// Configure applies the handler settings and sets the store they read.
+func Configure(cfg config.API, db database.Stores) {
+	api = cfg
+	store = db.Analytics
+}
+
+// analyticsRequest returns the authenticated user and the analytics store for a request.
+// It writes a problem response and returns false if either is unavailable.
+func analyticsRequest(w http.ResponseWriter, r *http.Request) (string, database.AnalyticsStore, bool) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+		return "", nil, false
+	}
+
+	if store == nil {
+		logging.FromContext(r.Context()).Error("Analytics store is not configured")
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseUnavailable, "Server configuration error (database)")
+		return "", nil, false
+	}
+
+	return userID, store, true
+}
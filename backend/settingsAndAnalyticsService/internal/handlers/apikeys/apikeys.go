@@ -0,0 +1,193 @@
+package apikeys
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"github.com/BrachiGH/firedns-dashboard/internal/validate"
+	"go.uber.org/zap"
+)
+
+// api holds the handler settings and store is the key database, both replaced
+// by Configure before the server starts.
+var (
+	api   = config.Default().API
+	store database.APIKeyStore
+)
+
+// Configure applies the handler settings and sets the store they read and write.
+func Configure(cfg config.API, db database.Stores) {
+	api = cfg
+	store = db.APIKeys
+}
+
+// CreateAPIKeyRequest defines the structure for the create key request body.
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreateAPIKeyResponse is returned once when a key is created. Key is never shown again.
+type CreateAPIKeyResponse struct {
+	database.APIKey
+	Key string `json:"key"`
+}
+
+// RevokeAPIKeyRequest defines the structure for the revoke key request body.
+type RevokeAPIKeyRequest struct {
+	ID string `json:"id"`
+}
+
+// APIKeysResponse defines the structure for the key list GET response.
+type APIKeysResponse struct {
+	UserID string            `json:"userId"`
+	Keys   []database.APIKey `json:"keys"`
+}
+
+// ListAPIKeys handles GET /v1/users/{userID}/apikeys.
+func ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := keysRequest(w, r); ok {
+		listAPIKeys(w, r, userID, db)
+	}
+}
+
+// CreateAPIKey handles POST /v1/users/{userID}/apikeys.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := keysRequest(w, r); ok {
+		createAPIKey(w, r, userID, db)
+	}
+}
+
+// RevokeAPIKey handles DELETE /v1/users/{userID}/apikeys.
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := keysRequest(w, r); ok {
+		revokeAPIKey(w, r, userID, db)
+	}
+}
+
+// keysRequest returns the authenticated user and the key store for a request.
+// It writes a problem response and returns false if either is unavailable.
+func keysRequest(w http.ResponseWriter, r *http.Request) (string, database.APIKeyStore, bool) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+		return "", nil, false
+	}
+
+	if store == nil {
+		logging.FromContext(r.Context()).Error("API key store is not configured")
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseUnavailable, "Server configuration error (database)")
+		return "", nil, false
+	}
+
+	return userID, store, true
+}
+
+// listAPIKeys handles GET requests to list the user's keys (without their secrets).
+func listAPIKeys(w http.ResponseWriter, r *http.Request, userID string, db database.APIKeyStore) {
+	logger := logging.FromContext(r.Context())
+
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
+	defer cancel()
+
+	keys, err := db.ListAPIKeys(ctx, userID)
+	if err != nil {
+		logger.Error("Error listing api keys", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to retrieve api keys")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(APIKeysResponse{UserID: userID, Keys: keys}); err != nil {
+		logger.Error("Error encoding api keys response", zap.Error(err))
+	}
+}
+
+// createAPIKey handles POST requests to create a new scoped key.
+func createAPIKey(w http.ResponseWriter, r *http.Request, userID string, db database.APIKeyStore) {
+	logger := logging.FromContext(r.Context())
+	var req CreateAPIKeyRequest
+
+	if _, ok := validate.Decode(w, r, &req); !ok {
+		return
+	}
+
+	var errs validate.Errors
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		errs.Add("name", "must not be empty")
+	}
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		errs.Add("scopes", "%s", err.Error())
+	}
+	if errs.Write(w, r) {
+		return
+	}
+
+	key, keyHash, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		logger.Error("Error generating api key", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "Failed to create api key")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
+	defer cancel()
+
+	stored, err := db.CreateAPIKey(ctx, userID, name, prefix, keyHash, scopes)
+	if err != nil {
+		logger.Error("Error storing api key", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to create api key")
+		return
+	}
+
+	logger.Info("Created api key", zap.String("key_id", stored.ID), zap.Strings("scopes", scopes))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(CreateAPIKeyResponse{APIKey: stored, Key: key}); err != nil {
+		logger.Error("Error encoding create api key response", zap.Error(err))
+	}
+}
+
+// revokeAPIKey handles DELETE requests to revoke one of the user's keys.
+func revokeAPIKey(w http.ResponseWriter, r *http.Request, userID string, db database.APIKeyStore) {
+	logger := logging.FromContext(r.Context())
+	var req RevokeAPIKeyRequest
+
+	if _, ok := validate.Decode(w, r, &req); !ok {
+		return
+	}
+
+	keyID := strings.TrimSpace(req.ID)
+	if keyID == "" {
+		var errs validate.Errors
+		errs.Add("id", "must not be empty")
+		errs.Write(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
+	defer cancel()
+
+	revoked, err := db.RevokeAPIKey(ctx, userID, keyID)
+	if err != nil {
+		logger.Error("Error revoking api key", zap.String("key_id", keyID), zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to revoke api key")
+		return
+	}
+	if !revoked {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "API key not found")
+		return
+	}
+
+	logger.Info("Revoked api key", zap.String("key_id", keyID))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/services/user/etl"
+	"go.uber.org/zap"
+)
+
+// Check statuses.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// checkTimeout bounds each dependency check so that a hung database cannot stall the probe.
+const checkTimeout = 2 * time.Second
+
+// Check is the outcome of one dependency check.
+type Check struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	DurationMs  int64      `json:"durationMs"`
+	Error       string     `json:"error,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"` // ETL check only
+}
+
+// Report is the response body of /healthz and /readyz.
+type Report struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Checks    []Check   `json:"checks"`
+}
+
+// checkETL names the check of the ETL routine. Database checks are named by
+// the pings of the stores.
+const checkETL = "etl"
+
+// pings are the databases checked, set by Configure.
+var pings []database.Ping
+
+// Configure sets the databases the checks ping.
+func Configure(db database.Stores) {
+	pings = db.Pings
+}
+
+// Healthz handles GET /healthz (liveness). Only a hung ETL routine fails it:
+// restarting the process can revive a routine that stopped running, but not an
+// unreachable database, so database checks and runs failing because of them
+// are reported without affecting the status. Without an ETL routine in the
+// process nothing can fail it.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, r, runChecks(r.Context(), etlLiveness), map[string]bool{checkETL: true})
+}
+
+// Readyz handles GET /readyz (readiness). Any failed check fails it, including
+// an ETL without a recent successful run, so traffic is only routed to the
+// service while all of its dependencies are usable.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, r, runChecks(r.Context(), etlReadiness), nil)
+}
+
+// writeReport responds 503 if any check in critical (or any check at all when
+// critical is nil) has failed.
+func writeReport(w http.ResponseWriter, r *http.Request, checks []Check, critical map[string]bool) {
+	report := Report{Status: StatusOK, CheckedAt: time.Now().UTC(), Checks: checks}
+	for _, c := range checks {
+		if c.Status == StatusFail && (critical == nil || critical[c.Name]) {
+			report.Status = StatusFail
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status == StatusFail {
+		status = http.StatusServiceUnavailable
+		logging.FromContext(r.Context()).Warn("Health check failed", zap.Any("checks", checks))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding health report", zap.Error(err))
+	}
+}
+
+// runChecks runs every database check concurrently and returns them, followed
+// by the ETL check, in a fixed order.
+func runChecks(ctx context.Context, etlCheck func(now time.Time) Check) []Check {
+	checks := make([]Check, len(pings))
+	var wg sync.WaitGroup
+	for i, p := range pings {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checks[i] = ping(ctx, p.Name, p.Check)
+		}()
+	}
+	wg.Wait()
+
+	// The ETL is only checked in a process that runs it (serve -with-etl)
+	if !etl.CurrentStatus().Started.IsZero() {
+		checks = append(checks, etlCheck(time.Now()))
+	}
+	return checks
+}
+
+func ping(ctx context.Context, name string, fn func(context.Context) error) Check {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := fn(ctx)
+	check := Check{Name: name, Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		check.Status = StatusFail
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// etlLiveness fails when the ETL routine is not running or its loop has not
+// started or finished a run recently, however those runs ended.
+func etlLiveness(now time.Time) Check {
+	status, check := etlStatus()
+	switch {
+	case !status.Running:
+		check.Status = StatusFail
+		check.Error = "ETL routine is not running"
+	case status.Hung(now):
+		check.Status = StatusFail
+		check.Error = "ETL routine has not started or finished a run in the last " + status.StaleAfter().String()
+	}
+	return check
+}
+
+// etlReadiness fails when the ETL routine is not running or has not succeeded recently.
+func etlReadiness(now time.Time) Check {
+	status, check := etlStatus()
+	switch {
+	case !status.Running:
+		check.Status = StatusFail
+		check.Error = "ETL routine is not running"
+	case status.Stale(now):
+		check.Status = StatusFail
+		check.Error = "no successful ETL run in the last " + status.StaleAfter().String()
+	}
+	return check
+}
+
+// etlStatus returns the status of the ETL routine and a passed check reporting
+// its last successful run.
+func etlStatus() (etl.Status, Check) {
+	status := etl.CurrentStatus()
+	check := Check{Name: checkETL, Status: StatusOK}
+	if !status.LastSuccess.IsZero() {
+		lastSuccess := status.LastSuccess.UTC()
+		check.LastSuccess = &lastSuccess
+	}
+	return status, check
+}
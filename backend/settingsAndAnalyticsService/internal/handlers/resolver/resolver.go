@@ -0,0 +1,247 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	resolverv1 "github.com/BrachiGH/firedns-dashboard/internal/gen/firedns/resolver/v1"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/settings"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// eventBatchSize is the number of query events written to MongoDB at once.
+const eventBatchSize = 500
+
+// Service implements the gRPC API used by the DNS resolver nodes.
+type Service struct {
+	resolverv1.UnimplementedResolverServiceServer
+
+	api config.API
+	db  database.Stores
+}
+
+// NewService returns the resolver API, backed by the same stores as the HTTP API.
+func NewService(cfg config.API, db database.Stores) *Service {
+	return &Service{api: cfg, db: db}
+}
+
+// GetSettings returns the settings of a user, looked up by ID or by linked address.
+func (s *Service) GetSettings(ctx context.Context, req *resolverv1.GetSettingsRequest) (*resolverv1.GetSettingsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.api.RequestTimeout)
+	defer cancel()
+
+	var userID string
+	switch user := req.GetUser().(type) {
+	case *resolverv1.GetSettingsRequest_UserId:
+		userID = user.UserId
+	case *resolverv1.GetSettingsRequest_Ip:
+		var err error
+		if userID, err = s.userByIP(ctx, user.Ip); err != nil {
+			return nil, err
+		}
+	}
+	if userID == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id or ip is required")
+	}
+
+	loaded, err := settings.Load(ctx, s.db, userID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error loading settings", zap.String("user_id", userID), zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "failed to load settings")
+	}
+	return &resolverv1.GetSettingsResponse{Settings: toProto(userID, loaded)}, nil
+}
+
+// userByIP returns the user an address is linked to.
+func (s *Service) userByIP(ctx context.Context, address string) (string, error) {
+	ip, err := database.ParseIP(address)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	userID, err := s.db.IPLinks.UserIDByIP(ctx, ip)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error resolving linked address", zap.String("ip", address), zap.Error(err))
+		return "", status.Error(codes.Unavailable, "failed to resolve the address")
+	}
+	if userID == "" {
+		return "", status.Errorf(codes.NotFound, "%s is not linked to a user", address)
+	}
+	return userID, nil
+}
+
+// WatchSettings sends the settings of the requested users, then resends those of a user whenever they are saved.
+func (s *Service) WatchSettings(req *resolverv1.WatchSettingsRequest, stream resolverv1.ResolverService_WatchSettingsServer) error {
+	userIDs := req.GetUserIds()
+	if len(userIDs) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one user_id is required")
+	}
+	ctx := stream.Context()
+	logger := logging.FromContext(ctx).With(zap.Int("users", len(userIDs)))
+
+	// Watch before the first load, so that no change is missed in between
+	watcher := settings.Watch(userIDs...)
+	defer watcher.Close()
+
+	if err := s.sendSettings(stream, userIDs); err != nil {
+		return err
+	}
+	logger.Info("Watching settings")
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Settings watch ended")
+			return nil
+		case <-watcher.Changed():
+			if err := s.sendSettings(stream, watcher.Take()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendSettings sends the settings of userIDs. A user whose settings fail to
+// load is skipped rather than ending the watch of the others; only a failed
+// send ends it.
+func (s *Service) sendSettings(stream resolverv1.ResolverService_WatchSettingsServer, userIDs []string) error {
+	for _, userID := range userIDs {
+		ctx, cancel := context.WithTimeout(stream.Context(), s.api.RequestTimeout)
+		loaded, err := settings.Load(ctx, s.db, userID)
+		cancel()
+		if err != nil {
+			logging.FromContext(stream.Context()).Error("Error loading settings, skipping the user", zap.String("user_id", userID), zap.Error(err))
+			continue
+		}
+		if err := stream.Send(&resolverv1.WatchSettingsResponse{Settings: toProto(userID, loaded)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReportQueryEvents stores the events of a client stream in batches. Invalid
+// events are counted as rejected and skipped; a failed write ends the call.
+func (s *Service) ReportQueryEvents(stream resolverv1.ResolverService_ReportQueryEventsServer) error {
+	ctx := stream.Context()
+	logger := logging.FromContext(ctx)
+
+	var accepted, rejected int64
+	batch := make([]database.QueryEvent, 0, eventBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		writeCtx, cancel := context.WithTimeout(ctx, s.api.RequestTimeout)
+		defer cancel()
+		if err := s.db.Analytics.RecordQueryEvents(writeCtx, batch); err != nil {
+			logger.Error("Error recording query events", zap.Int("events", len(batch)), zap.Error(err))
+			return status.Errorf(codes.Unavailable, "failed to record query events, %d were recorded", accepted)
+		}
+		accepted += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, event := range req.GetEvents() {
+			converted, ok := fromProto(event)
+			if !ok {
+				rejected++
+				continue
+			}
+			batch = append(batch, converted)
+			if len(batch) == eventBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if rejected > 0 {
+		logger.Warn("Rejected invalid query events", zap.Int64("rejected", rejected))
+	}
+	logger.Debug("Recorded query events", zap.Int64("accepted", accepted))
+	return stream.SendAndClose(&resolverv1.ReportQueryEventsResponse{Accepted: accepted, Rejected: rejected})
+}
+
+// fromProto validates a reported event. Events without a time are stamped with the time they arrived.
+func fromProto(event *resolverv1.QueryEvent) (database.QueryEvent, bool) {
+	ip, err := database.ParseIP(event.GetClientIp())
+	if err != nil || event.GetDomain() == "" {
+		return database.QueryEvent{}, false
+	}
+
+	var dropped bool
+	switch event.GetAction() {
+	case resolverv1.QueryEvent_ACTION_PASSED:
+	case resolverv1.QueryEvent_ACTION_DROPPED:
+		dropped = true
+	default:
+		return database.QueryEvent{}, false
+	}
+
+	at := time.Now().UTC()
+	if event.GetTime() != nil {
+		if err := event.GetTime().CheckValid(); err != nil {
+			return database.QueryEvent{}, false
+		}
+		at = event.GetTime().AsTime()
+	}
+	return database.QueryEvent{IP: ip, Domain: event.GetDomain(), Dropped: dropped, Time: at}, true
+}
+
+func toProto(userID string, s settings.UserSettings) *resolverv1.UserSettings {
+	schedule := make(map[string]*resolverv1.TimeRange, len(s.Parental.RecreationSchedule))
+	for day, times := range s.Parental.RecreationSchedule {
+		schedule[day] = &resolverv1.TimeRange{Start: times.Start, End: times.End}
+	}
+
+	return &resolverv1.UserSettings{
+		UserId: userID,
+		General: &resolverv1.GeneralSettings{
+			ThreatIntelligence:      s.General.ThreatIntelligence,
+			GoogleSafeBrowsing:      s.General.GoogleSafeBrowsing,
+			HomographProtection:     s.General.HomographProtection,
+			TyposquattingProtection: s.General.TyposquattingProtection,
+			BlockNewDomains:         s.General.BlockNewDomains,
+			BlockDynamicDns:         s.General.BlockDynamicDNS,
+			BlockCsam:               s.General.BlockCSAM,
+		},
+		Privacy: &resolverv1.PrivacySettings{
+			AdGuardMobileAdsFilter: s.Privacy.AdGuardMobileAdsFilter,
+			AdAway:                 s.Privacy.AdAway,
+			HageziMultiPro:         s.Privacy.HageziMultiPro,
+			GoodbyeAds:             s.Privacy.GoodbyeAds,
+			HostsVn:                s.Privacy.HostsVN,
+			NextDnsAdsTrackers:     s.Privacy.NextDNSAdsTrackers,
+		},
+		Parental: &resolverv1.ParentalSettings{
+			BlockedApps:        s.Parental.BlockedApps,
+			RecreationSchedule: schedule,
+		},
+		Lists: &resolverv1.DomainLists{
+			DeniedDomains:  s.Lists.DeniedDomains,
+			AllowedDomains: s.Lists.AllowedDomains,
+		},
+	}
+}
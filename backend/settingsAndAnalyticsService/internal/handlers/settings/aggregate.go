@@ -0,0 +1,183 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"github.com/BrachiGH/firedns-dashboard/internal/validate"
+	"go.uber.org/zap"
+)
+
+// AllSettings is the whole configuration of a user: every settings category
+// and both domain lists. PUT requires every member except userId.
+type AllSettings struct {
+	UserID    string                   `json:"userId"`
+	General   *GeneralSettings         `json:"general"`
+	Privacy   *PrivacySettings         `json:"privacy"`
+	Parental  *ParentalControlSettings `json:"parental"`
+	DenyList  []string                 `json:"denylist"`
+	AllowList []string                 `json:"allowlist"`
+}
+
+// GetAllSettings handles GET /v1/users/{userID}/settings.
+func GetAllSettings(w http.ResponseWriter, r *http.Request) {
+	// The route requires settings:read, the lists need their own scope
+	if !auth.RequireScope(w, r, auth.ScopeListsRead) {
+		return
+	}
+	if userID, db, ok := settingsRequest(w, r); ok {
+		getAllSettings(w, r, userID, db)
+	}
+}
+
+// ReplaceAllSettings handles PUT /v1/users/{userID}/settings.
+func ReplaceAllSettings(w http.ResponseWriter, r *http.Request) {
+	if !auth.RequireScope(w, r, auth.ScopeListsWrite) {
+		return
+	}
+	if userID, db, ok := settingsRequest(w, r); ok {
+		replaceAllSettings(w, r, userID, db)
+	}
+}
+
+func getAllSettings(w http.ResponseWriter, r *http.Request, userID string, db database.Stores) {
+	logger := logging.FromContext(r.Context())
+
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
+	defer cancel()
+
+	loaded, err := Load(ctx, db, userID)
+	if err != nil {
+		logger.Error("Error fetching settings from DB", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to retrieve settings")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newAllSettings(userID, loaded)); err != nil {
+		logger.Error("Error encoding settings response", zap.Error(err))
+	}
+}
+
+// replaceAllSettings writes every category at once, so that resolvers and
+// concurrent readers never see half of a configuration.
+func replaceAllSettings(w http.ResponseWriter, r *http.Request, userID string, db database.Stores) {
+	logger := logging.FromContext(r.Context())
+	var replacement AllSettings
+
+	if _, ok := validate.Decode(w, r, &replacement); !ok {
+		return
+	}
+	if checkAllSettings(&replacement, userID).Write(w, r) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
+	defer cancel()
+
+	categories := map[database.SettingsCategory]map[string]any{
+		database.CategoryGeneral: generalFields(*replacement.General),
+		database.CategoryPrivacy: privacyFields(*replacement.Privacy),
+		database.CategoryParental: {
+			"blockedApps":        replacement.Parental.BlockedApps,
+			"recreationSchedule": replacement.Parental.RecreationSchedule,
+		},
+	}
+	lists := database.DomainLists{Denied: replacement.DenyList, Allowed: replacement.AllowList}
+	err := db.Settings.ReplaceSettings(ctx, userID, categories, lists)
+	if err != nil {
+		logger.Error("Error replacing settings in DB", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to update settings")
+		return
+	}
+	notifyChanged(userID)
+
+	// Read back, so that the response carries the stored state and the parental defaults
+	saved, err := Load(ctx, db, userID)
+	if err != nil {
+		logger.Error("Error fetching replaced settings from DB", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Settings were saved but could not be read back")
+		return
+	}
+
+	logger.Info("Successfully replaced settings",
+		zap.Int("denied_domains", len(replacement.DenyList)), zap.Int("allowed_domains", len(replacement.AllowList)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(newAllSettings(userID, saved)); err != nil {
+		logger.Error("Error encoding settings response", zap.Error(err))
+	}
+}
+
+// checkAllSettings checks that a replacement is complete, belongs to userID
+// and holds valid values, and normalizes its domain lists.
+// A null member counts as missing.
+func checkAllSettings(s *AllSettings, userID string) validate.Errors {
+	var errs validate.Errors
+	checkUserID(&errs, "userId", s.UserID, userID)
+
+	if s.General == nil {
+		errs.Add("general", "is required")
+	} else {
+		checkUserID(&errs, "general.userId", s.General.UserID, userID)
+	}
+	if s.Privacy == nil {
+		errs.Add("privacy", "is required")
+	} else {
+		checkUserID(&errs, "privacy.userId", s.Privacy.UserID, userID)
+	}
+	if s.Parental == nil {
+		errs.Add("parental", "is required")
+	} else {
+		checkUserID(&errs, "parental.userId", s.Parental.UserID, userID)
+		if s.Parental.BlockedApps == nil {
+			errs.Add("parental.blockedApps", "is required")
+		}
+		if s.Parental.RecreationSchedule == nil {
+			errs.Add("parental.recreationSchedule", "is required")
+		}
+		checkParental(&errs, "parental.", *s.Parental)
+	}
+
+	if s.DenyList == nil {
+		errs.Add("denylist", "is required, send [] for an empty list")
+	}
+	if s.AllowList == nil {
+		errs.Add("allowlist", "is required, send [] for an empty list")
+	}
+	s.DenyList = checkDomains(&errs, "denylist", s.DenyList)
+	s.AllowList = checkDomains(&errs, "allowlist", s.AllowList)
+	denied := make(map[string]bool, len(s.DenyList))
+	for _, domain := range s.DenyList {
+		denied[domain] = true
+	}
+	for _, domain := range s.AllowList {
+		if denied[domain] {
+			errs.Add("allowlist", "%s is also in the denylist", domain)
+		}
+	}
+	return errs
+}
+
+func newAllSettings(userID string, s UserSettings) AllSettings {
+	all := AllSettings{
+		UserID:    userID,
+		General:   &s.General,
+		Privacy:   &s.Privacy,
+		Parental:  &s.Parental,
+		DenyList:  s.Lists.DeniedDomains,
+		AllowList: s.Lists.AllowedDomains,
+	}
+	if all.DenyList == nil {
+		all.DenyList = []string{}
+	}
+	if all.AllowList == nil {
+		all.AllowList = []string{}
+	}
+	return all
+}
@@ -0,0 +1,84 @@
+package settings
+
+import (
+	"sync"
+)
+
+// Watchers are told which users' settings changed, so that long-lived
+// consumers such as the resolver gRPC stream can resend them. Only changes
+// saved through this process are seen.
+var watchers = struct {
+	sync.Mutex
+	byUser map[string]map[*Watcher]bool
+}{byUser: make(map[string]map[*Watcher]bool)}
+
+// Watcher collects the IDs of watched users whose settings changed. Changes
+// that happen before they are taken are merged, so a slow consumer never
+// blocks writers and only ever needs to reload each user once.
+type Watcher struct {
+	userIDs []string
+	signal  chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+// Watch starts watching the settings of userIDs. The caller must Close the watcher.
+func Watch(userIDs ...string) *Watcher {
+	w := &Watcher{userIDs: userIDs, signal: make(chan struct{}, 1), pending: make(map[string]bool)}
+
+	watchers.Lock()
+	defer watchers.Unlock()
+	for _, id := range userIDs {
+		if watchers.byUser[id] == nil {
+			watchers.byUser[id] = make(map[*Watcher]bool)
+		}
+		watchers.byUser[id][w] = true
+	}
+	return w
+}
+
+// Changed receives a value when Take has changes to return.
+func (w *Watcher) Changed() <-chan struct{} {
+	return w.signal
+}
+
+// Take returns the users whose settings changed since the previous call.
+func (w *Watcher) Take() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changed := make([]string, 0, len(w.pending))
+	for id := range w.pending {
+		changed = append(changed, id)
+	}
+	clear(w.pending)
+	return changed
+}
+
+// Close stops watching.
+func (w *Watcher) Close() {
+	watchers.Lock()
+	defer watchers.Unlock()
+	for _, id := range w.userIDs {
+		delete(watchers.byUser[id], w)
+		if len(watchers.byUser[id]) == 0 {
+			delete(watchers.byUser, id)
+		}
+	}
+}
+
+// notifyChanged tells the watchers of a user that their settings were saved.
+func notifyChanged(userID string) {
+	watchers.Lock()
+	defer watchers.Unlock()
+	for w := range watchers.byUser[userID] {
+		w.mu.Lock()
+		w.pending[userID] = true
+		w.mu.Unlock()
+
+		select {
+		case w.signal <- struct{}{}:
+		default: // Already signalled, the change is picked up by the pending Take
+		}
+	}
+}
@@ -3,15 +3,15 @@ package settings
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"strings"
-	"time"
 
-	"github.com/BrachiGH/firedns-dashboard/internal/database" // Assuming this is your database package
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"github.com/BrachiGH/firedns-dashboard/internal/validate"
+	"go.uber.org/zap"
 )
 
 // DenyAllowListSettings defines the structure for the document in the DenyAllowList collection.
@@ -44,363 +44,268 @@ type RemoveDomainRequest struct {
 	Domain string `json:"domain"`
 }
 
-// --- Deny List Handlers ---
+// decodeAddDomain decodes an AddDomainRequest and returns its domain, normalized.
+// It writes a problem response and returns false if the domain is not valid.
+func decodeAddDomain(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req AddDomainRequest
+	present, ok := validate.Decode(w, r, &req)
+	if !ok {
+		return "", false
+	}
 
-// DenyListHandler routes requests for deny list settings (/settings/denylist/{userID}).
-func DenyListHandler(w http.ResponseWriter, r *http.Request) {
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) < 3 || pathParts[0] != "settings" || pathParts[1] != "denylist" {
-		http.Error(w, "Invalid path format. Expected /settings/denylist/{userID}", http.StatusBadRequest)
-		return
+	var errs validate.Errors
+	errs.Required(present, "domain")
+	domain, err := validate.Domain(req.Domain)
+	if err != nil && present["domain"] {
+		errs.Add("domain", "%s", err.Error())
 	}
-	userID := pathParts[2]
-	if userID == "" {
-		http.Error(w, "User ID cannot be empty", http.StatusBadRequest)
-		return
+	if errs.Write(w, r) {
+		return "", false
 	}
+	return domain, true
+}
 
-	db, err := database.GetSettingsDB()
-	if err != nil {
-		log.Printf("Error getting database handle: %v", err)
-		http.Error(w, "Server configuration error (database)", http.StatusInternalServerError)
-		return
+// decodeRemoveDomain decodes a RemoveDomainRequest and returns its domain.
+// The syntax is not checked, so that domains stored before validation can
+// still be removed.
+func decodeRemoveDomain(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req RemoveDomainRequest
+	if _, ok := validate.Decode(w, r, &req); !ok {
+		return "", false
 	}
-	// *** IMPORTANT: Ensure db.DenyAllowList is initialized in your database package ***
-	if db.DenyAllowList == nil {
-		log.Println("Error: DenyAllowList MongoDB collection is not initialized.")
-		http.Error(w, "Server configuration error (collection)", http.StatusInternalServerError)
-		return
+
+	domain := strings.TrimSpace(req.Domain)
+	if domain == "" {
+		var errs validate.Errors
+		errs.Add("domain", "must not be empty")
+		errs.Write(w, r)
+		return "", false
+	}
+	return domain, true
+}
+
+// --- Deny List Handlers ---
+
+// GetDenyList handles GET /v1/users/{userID}/settings/denylist.
+func GetDenyList(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := settingsRequest(w, r); ok {
+		getDenyList(w, r, userID, db.Lists)
+	}
+}
+
+// AddDenyDomain handles POST /v1/users/{userID}/settings/denylist.
+func AddDenyDomain(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := settingsRequest(w, r); ok {
+		addDenyDomain(w, r, userID, db.Lists)
 	}
+}
 
-	collection := db.DenyAllowList // Use the single collection
-
-	switch r.Method {
-	case http.MethodGet:
-		getDenyList(w, r, userID, collection)
-	case http.MethodPost:
-		addDenyDomain(w, r, userID, collection)
-	case http.MethodDelete: // Add DELETE method handler
-		removeDenyDomain(w, r, userID, collection)
-	default:
-		w.Header().Set("Allow", "GET, POST, DELETE") // Update Allow header
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// RemoveDenyDomain handles DELETE /v1/users/{userID}/settings/denylist.
+func RemoveDenyDomain(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := settingsRequest(w, r); ok {
+		removeDenyDomain(w, r, userID, db.Lists)
 	}
 }
 
 // getDenyList handles GET requests to fetch the user's deny list.
-func getDenyList(w http.ResponseWriter, r *http.Request, userID string, collection *mongo.Collection) {
-	log.Printf("GET /settings/denylist/%s", userID)
-	var settings DenyAllowListSettings                                // Fetch the combined settings document
+func getDenyList(w http.ResponseWriter, r *http.Request, userID string, lists database.ListStore) {
+	logger := logging.FromContext(r.Context())
 	response := DenyListResponse{UserID: userID, Domains: []string{}} // Default to empty list
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
 	defer cancel()
 
-	filter := bson.M{"userId": userID}
-	// Only retrieve the deniedDomains field to be more efficient
-	opts := options.FindOne().SetProjection(bson.M{"deniedDomains": 1})
-	err := collection.FindOne(ctx, filter, opts).Decode(&settings)
-
+	stored, err := lists.FindLists(ctx, userID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Printf("No deny/allow list document found for userID %s, returning empty deny list.", userID)
-			// Response already defaults to empty, do nothing
-		} else {
-			log.Printf("Error fetching deny list for userID %s from DB: %v", userID, err)
-			http.Error(w, "Failed to retrieve deny list", http.StatusInternalServerError)
-			return
-		}
-	} else {
-		// If document found and DeniedDomains is not nil, use it
-		if settings.DeniedDomains != nil {
-			response.Domains = settings.DeniedDomains
-		}
+		logger.Error("Error fetching deny list from DB", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to retrieve deny list")
+		return
+	}
+	// Users without lists get the empty default
+	if stored.Denied != nil {
+		response.Domains = stored.Denied
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding deny list response for userID %s: %v", userID, err)
+		logger.Error("Error encoding deny list response", zap.Error(err))
 	}
 }
 
 // addDenyDomain handles POST requests to add a domain to the user's deny list.
-func addDenyDomain(w http.ResponseWriter, r *http.Request, userID string, collection *mongo.Collection) {
-	log.Printf("POST /settings/denylist/%s", userID)
-	var req AddDomainRequest
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding add deny domain request body for userID %s: %v", userID, err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-	defer r.Body.Close()
-
-	domainToAdd := strings.TrimSpace(req.Domain)
-	if domainToAdd == "" {
-		http.Error(w, "Domain cannot be empty", http.StatusBadRequest)
+func addDenyDomain(w http.ResponseWriter, r *http.Request, userID string, lists database.ListStore) {
+	logger := logging.FromContext(r.Context())
+	domainToAdd, ok := decodeAddDomain(w, r)
+	if !ok {
 		return
 	}
-	// Add more robust domain validation if needed
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
 	defer cancel()
 
-	filter := bson.M{"userId": userID}
-	// Use $addToSet on the 'deniedDomains' field
-	update := bson.M{
-		"$addToSet":    bson.M{"deniedDomains": domainToAdd},
-		"$setOnInsert": bson.M{"userId": userID}, // Set userId only if inserting a new document
-	}
-	opts := options.Update().SetUpsert(true) // Create the document if it doesn't exist
-
-	result, err := collection.UpdateOne(ctx, filter, update, opts)
+	added, err := lists.AddDomain(ctx, userID, database.DenyList, domainToAdd)
 	if err != nil {
-		log.Printf("Error adding deny domain '%s' for userID %s in DB: %v", domainToAdd, userID, err)
-		http.Error(w, "Failed to update deny list", http.StatusInternalServerError)
+		logger.Error("Error adding deny domain in DB", zap.String("domain", domainToAdd), zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to update deny list")
 		return
 	}
 
-	if result.UpsertedCount > 0 {
-		log.Printf("Created deny/allow list document and added domain '%s' to deny list for userID %s", domainToAdd, userID)
-	} else if result.ModifiedCount > 0 {
-		log.Printf("Added domain '%s' to deny list for userID %s", domainToAdd, userID)
+	if added {
+		logger.Info("Added domain to deny list", zap.String("domain", domainToAdd))
 	} else {
-		log.Printf("Domain '%s' was already in the deny list for userID %s.", domainToAdd, userID)
+		logger.Info("Domain was already in the deny list", zap.String("domain", domainToAdd))
 	}
 
-	log.Printf("Successfully processed add deny domain request for userID %s, domain '%s'", userID, domainToAdd)
+	notifyChanged(userID)
+	logger.Info("Successfully processed add deny domain request", zap.String("domain", domainToAdd))
 	w.WriteHeader(http.StatusNoContent) // Indicate success with no content to return
 }
 
 // removeDenyDomain handles DELETE requests to remove a domain from the user's deny list.
-func removeDenyDomain(w http.ResponseWriter, r *http.Request, userID string, collection *mongo.Collection) {
-	log.Printf("DELETE /settings/denylist/%s", userID)
-	var req RemoveDomainRequest
-
+func removeDenyDomain(w http.ResponseWriter, r *http.Request, userID string, lists database.ListStore) {
+	logger := logging.FromContext(r.Context())
 	// For DELETE, the domain might be in the query params or request body.
 	// Let's assume request body for consistency with POST.
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding remove deny domain request body for userID %s: %v", userID, err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-	defer r.Body.Close()
-
-	domainToRemove := strings.TrimSpace(req.Domain)
-	if domainToRemove == "" {
-		http.Error(w, "Domain cannot be empty", http.StatusBadRequest)
+	domainToRemove, ok := decodeRemoveDomain(w, r)
+	if !ok {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
 	defer cancel()
 
-	filter := bson.M{"userId": userID}
-	// Use $pull to remove the domain from the 'deniedDomains' array
-	update := bson.M{
-		"$pull": bson.M{"deniedDomains": domainToRemove},
-	}
-
-	result, err := collection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		log.Printf("Error removing deny domain '%s' for userID %s from DB: %v", domainToRemove, userID, err)
-		http.Error(w, "Failed to update deny list", http.StatusInternalServerError)
+	removed, err := lists.RemoveDomain(ctx, userID, database.DenyList, domainToRemove)
+	if errors.Is(err, database.ErrNotFound) {
+		logger.Debug("No deny/allow list document found, cannot remove domain")
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "User settings not found")
 		return
 	}
-
-	if result.MatchedCount == 0 {
-		log.Printf("No deny/allow list document found for userID %s, cannot remove domain.", userID)
-		// Or you could return 404 Not Found
-		http.Error(w, "User settings not found", http.StatusNotFound)
+	if err != nil {
+		logger.Error("Error removing deny domain from DB", zap.String("domain", domainToRemove), zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to update deny list")
 		return
 	}
 
-	if result.ModifiedCount > 0 {
-		log.Printf("Removed domain '%s' from deny list for userID %s", domainToRemove, userID)
+	if removed {
+		logger.Info("Removed domain from deny list", zap.String("domain", domainToRemove))
 	} else {
-		log.Printf("Domain '%s' was not found in the deny list for userID %s.", domainToRemove, userID)
+		logger.Info("Domain was not found in the deny list", zap.String("domain", domainToRemove))
 		// It's often okay to return success even if the item wasn't there (idempotent DELETE)
 	}
 
-	log.Printf("Successfully processed remove deny domain request for userID %s, domain '%s'", userID, domainToRemove)
+	notifyChanged(userID)
+	logger.Info("Successfully processed remove deny domain request", zap.String("domain", domainToRemove))
 	w.WriteHeader(http.StatusNoContent) // Indicate success with no content to return
 }
 
 // --- Allow List Handlers ---
 
-// AllowListHandler routes requests for allow list settings (/settings/allowlist/{userID}).
-func AllowListHandler(w http.ResponseWriter, r *http.Request) {
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) < 3 || pathParts[0] != "settings" || pathParts[1] != "allowlist" {
-		http.Error(w, "Invalid path format. Expected /settings/allowlist/{userID}", http.StatusBadRequest)
-		return
-	}
-	userID := pathParts[2]
-	if userID == "" {
-		http.Error(w, "User ID cannot be empty", http.StatusBadRequest)
-		return
+// GetAllowList handles GET /v1/users/{userID}/settings/allowlist.
+func GetAllowList(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := settingsRequest(w, r); ok {
+		getAllowList(w, r, userID, db.Lists)
 	}
+}
 
-	db, err := database.GetSettingsDB()
-	if err != nil {
-		log.Printf("Error getting database handle: %v", err)
-		http.Error(w, "Server configuration error (database)", http.StatusInternalServerError)
-		return
-	}
-	// *** IMPORTANT: Ensure db.DenyAllowList is initialized in your database package ***
-	if db.DenyAllowList == nil {
-		log.Println("Error: DenyAllowList MongoDB collection is not initialized.")
-		http.Error(w, "Server configuration error (collection)", http.StatusInternalServerError)
-		return
+// AddAllowDomain handles POST /v1/users/{userID}/settings/allowlist.
+func AddAllowDomain(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := settingsRequest(w, r); ok {
+		addAllowDomain(w, r, userID, db.Lists)
 	}
+}
 
-	collection := db.DenyAllowList // Use the single collection
-
-	switch r.Method {
-	case http.MethodGet:
-		getAllowList(w, r, userID, collection)
-	case http.MethodPost:
-		addAllowDomain(w, r, userID, collection)
-	case http.MethodDelete: // Add DELETE method handler
-		removeAllowDomain(w, r, userID, collection)
-	default:
-		w.Header().Set("Allow", "GET, POST, DELETE") // Update Allow header
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// RemoveAllowDomain handles DELETE /v1/users/{userID}/settings/allowlist.
+func RemoveAllowDomain(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := settingsRequest(w, r); ok {
+		removeAllowDomain(w, r, userID, db.Lists)
 	}
 }
 
 // getAllowList handles GET requests to fetch the user's allow list.
-func getAllowList(w http.ResponseWriter, r *http.Request, userID string, collection *mongo.Collection) {
-	log.Printf("GET /settings/allowlist/%s", userID)
-	var settings DenyAllowListSettings                                 // Fetch the combined settings document
+func getAllowList(w http.ResponseWriter, r *http.Request, userID string, lists database.ListStore) {
+	logger := logging.FromContext(r.Context())
 	response := AllowListResponse{UserID: userID, Domains: []string{}} // Default to empty list
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
 	defer cancel()
 
-	filter := bson.M{"userId": userID}
-	// Only retrieve the allowedDomains field to be more efficient
-	opts := options.FindOne().SetProjection(bson.M{"allowedDomains": 1})
-	err := collection.FindOne(ctx, filter, opts).Decode(&settings)
-
+	stored, err := lists.FindLists(ctx, userID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Printf("No deny/allow list document found for userID %s, returning empty allow list.", userID)
-			// Response already defaults to empty, do nothing
-		} else {
-			log.Printf("Error fetching allow list for userID %s from DB: %v", userID, err)
-			http.Error(w, "Failed to retrieve allow list", http.StatusInternalServerError)
-			return
-		}
-	} else {
-		// If document found and AllowedDomains is not nil, use it
-		if settings.AllowedDomains != nil {
-			response.Domains = settings.AllowedDomains
-		}
+		logger.Error("Error fetching allow list from DB", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to retrieve allow list")
+		return
+	}
+	// Users without lists get the empty default
+	if stored.Allowed != nil {
+		response.Domains = stored.Allowed
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding allow list response for userID %s: %v", userID, err)
+		logger.Error("Error encoding allow list response", zap.Error(err))
 	}
 }
 
 // addAllowDomain handles POST requests to add a domain to the user's allow list.
-func addAllowDomain(w http.ResponseWriter, r *http.Request, userID string, collection *mongo.Collection) {
-	log.Printf("POST /settings/allowlist/%s", userID)
-	var req AddDomainRequest
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding add allow domain request body for userID %s: %v", userID, err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-	defer r.Body.Close()
-
-	domainToAdd := strings.TrimSpace(req.Domain)
-	if domainToAdd == "" {
-		http.Error(w, "Domain cannot be empty", http.StatusBadRequest)
+func addAllowDomain(w http.ResponseWriter, r *http.Request, userID string, lists database.ListStore) {
+	logger := logging.FromContext(r.Context())
+	domainToAdd, ok := decodeAddDomain(w, r)
+	if !ok {
 		return
 	}
-	// Add more robust domain validation if needed
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
 	defer cancel()
 
-	filter := bson.M{"userId": userID}
-	// Use $addToSet on the 'allowedDomains' field
-	update := bson.M{
-		"$addToSet":    bson.M{"allowedDomains": domainToAdd},
-		"$setOnInsert": bson.M{"userId": userID}, // Set userId only if inserting a new document
-	}
-	opts := options.Update().SetUpsert(true) // Create the document if it doesn't exist
-
-	result, err := collection.UpdateOne(ctx, filter, update, opts)
+	added, err := lists.AddDomain(ctx, userID, database.AllowList, domainToAdd)
 	if err != nil {
-		log.Printf("Error adding allow domain '%s' for userID %s in DB: %v", domainToAdd, userID, err)
-		http.Error(w, "Failed to update allow list", http.StatusInternalServerError)
+		logger.Error("Error adding allow domain in DB", zap.String("domain", domainToAdd), zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to update allow list")
 		return
 	}
 
-	if result.UpsertedCount > 0 {
-		log.Printf("Created deny/allow list document and added domain '%s' to allow list for userID %s", domainToAdd, userID)
-	} else if result.ModifiedCount > 0 {
-		log.Printf("Added domain '%s' to allow list for userID %s", domainToAdd, userID)
+	if added {
+		logger.Info("Added domain to allow list", zap.String("domain", domainToAdd))
 	} else {
-		log.Printf("Domain '%s' was already in the allow list for userID %s.", domainToAdd, userID)
+		logger.Info("Domain was already in the allow list", zap.String("domain", domainToAdd))
 	}
 
-	log.Printf("Successfully processed add allow domain request for userID %s, domain '%s'", userID, domainToAdd)
+	notifyChanged(userID)
+	logger.Info("Successfully processed add allow domain request", zap.String("domain", domainToAdd))
 	w.WriteHeader(http.StatusNoContent) // Indicate success with no content to return
 }
 
 // removeAllowDomain handles DELETE requests to remove a domain from the user's allow list.
-func removeAllowDomain(w http.ResponseWriter, r *http.Request, userID string, collection *mongo.Collection) {
-	log.Printf("DELETE /settings/allowlist/%s", userID)
-	var req RemoveDomainRequest
-
+func removeAllowDomain(w http.ResponseWriter, r *http.Request, userID string, lists database.ListStore) {
+	logger := logging.FromContext(r.Context())
 	// Assume request body for consistency
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding remove allow domain request body for userID %s: %v", userID, err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	domainToRemove, ok := decodeRemoveDomain(w, r)
+	if !ok {
 		return
 	}
-	defer r.Body.Close()
 
-	domainToRemove := strings.TrimSpace(req.Domain)
-	if domainToRemove == "" {
-		http.Error(w, "Domain cannot be empty", http.StatusBadRequest)
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
 	defer cancel()
 
-	filter := bson.M{"userId": userID}
-	// Use $pull to remove the domain from the 'allowedDomains' array
-	update := bson.M{
-		"$pull": bson.M{"allowedDomains": domainToRemove},
-	}
-
-	result, err := collection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		log.Printf("Error removing allow domain '%s' for userID %s from DB: %v", domainToRemove, userID, err)
-		http.Error(w, "Failed to update allow list", http.StatusInternalServerError)
+	removed, err := lists.RemoveDomain(ctx, userID, database.AllowList, domainToRemove)
+	if errors.Is(err, database.ErrNotFound) {
+		logger.Debug("No deny/allow list document found, cannot remove domain")
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "User settings not found")
 		return
 	}
-
-	if result.MatchedCount == 0 {
-		log.Printf("No deny/allow list document found for userID %s, cannot remove domain.", userID)
-		http.Error(w, "User settings not found", http.StatusNotFound)
+	if err != nil {
+		logger.Error("Error removing allow domain from DB", zap.String("domain", domainToRemove), zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to update allow list")
 		return
 	}
 
-	if result.ModifiedCount > 0 {
-		log.Printf("Removed domain '%s' from allow list for userID %s", domainToRemove, userID)
+	if removed {
+		logger.Info("Removed domain from allow list", zap.String("domain", domainToRemove))
 	} else {
-		log.Printf("Domain '%s' was not found in the allow list for userID %s.", domainToRemove, userID)
+		logger.Info("Domain was not found in the allow list", zap.String("domain", domainToRemove))
 	}
 
-	log.Printf("Successfully processed remove allow domain request for userID %s, domain '%s'", userID, domainToRemove)
+	notifyChanged(userID)
+	logger.Info("Successfully processed remove allow domain request", zap.String("domain", domainToRemove))
 	w.WriteHeader(http.StatusNoContent) // Indicate success with no content to return
 }
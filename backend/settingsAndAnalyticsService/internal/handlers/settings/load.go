@@ -0,0 +1,86 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+)
+
+// UserSettings is every setting of a user, as enforced by the resolvers.
+type UserSettings struct {
+	General  GeneralSettings
+	Privacy  PrivacySettings
+	Parental ParentalControlSettings
+	Lists    DenyAllowListSettings
+}
+
+// Load reads every setting of a user. Settings that were never saved are returned with their defaults.
+func Load(ctx context.Context, db database.Stores, userID string) (UserSettings, error) {
+	var all UserSettings
+	var err error
+	if all.General, err = loadGeneral(ctx, db.Settings, userID); err != nil {
+		return UserSettings{}, err
+	}
+	if all.Privacy, err = loadPrivacy(ctx, db.Settings, userID); err != nil {
+		return UserSettings{}, err
+	}
+	if all.Parental, err = loadParental(ctx, db.Settings, userID); err != nil {
+		return UserSettings{}, err
+	}
+	if all.Lists, err = loadLists(ctx, db.Lists, userID); err != nil {
+		return UserSettings{}, err
+	}
+	return all, nil
+}
+
+func loadGeneral(ctx context.Context, store database.SettingsStore, userID string) (GeneralSettings, error) {
+	var settings GeneralSettings
+	err := store.FindSettings(ctx, database.CategoryGeneral, userID, &settings)
+	if errors.Is(err, database.ErrNotFound) {
+		logging.FromContext(ctx).Debug("No settings found, returning defaults")
+		return defaultGeneralSettings(userID), nil
+	}
+	if err != nil {
+		return GeneralSettings{}, fmt.Errorf("error fetching general settings: %w", err)
+	}
+	return settings, nil
+}
+
+func loadPrivacy(ctx context.Context, store database.SettingsStore, userID string) (PrivacySettings, error) {
+	var settings PrivacySettings
+	err := store.FindSettings(ctx, database.CategoryPrivacy, userID, &settings)
+	if errors.Is(err, database.ErrNotFound) {
+		logging.FromContext(ctx).Debug("No privacy settings found, returning defaults")
+		return defaultPrivacySettings(userID), nil
+	}
+	if err != nil {
+		return PrivacySettings{}, fmt.Errorf("error fetching privacy settings: %w", err)
+	}
+	return settings, nil
+}
+
+// loadParental also fills in the defaults of apps and days missing from the stored settings.
+func loadParental(ctx context.Context, store database.SettingsStore, userID string) (ParentalControlSettings, error) {
+	var settings ParentalControlSettings
+	err := store.FindSettings(ctx, database.CategoryParental, userID, &settings)
+	if errors.Is(err, database.ErrNotFound) {
+		logging.FromContext(ctx).Debug("No parental control settings found, returning defaults")
+		return defaultParentalControlSettings(userID), nil
+	}
+	if err != nil {
+		return ParentalControlSettings{}, fmt.Errorf("error fetching parental control settings: %w", err)
+	}
+	mergeParentalDefaults(&settings)
+	return settings, nil
+}
+
+func loadLists(ctx context.Context, store database.ListStore, userID string) (DenyAllowListSettings, error) {
+	lists, err := store.FindLists(ctx, userID)
+	if err != nil {
+		return DenyAllowListSettings{}, fmt.Errorf("error fetching deny/allow lists: %w", err)
+	}
+	return DenyAllowListSettings{UserID: userID, DeniedDomains: lists.Denied, AllowedDomains: lists.Allowed}, nil
+}
@@ -3,15 +3,14 @@ package settings
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"net/http"
-	"strings"
-	"time"
 
 	"github.com/BrachiGH/firedns-dashboard/internal/database" // Assuming this is your database package
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"github.com/BrachiGH/firedns-dashboard/internal/validate"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
 )
 
 // TimeRange defines the start and end time for recreation periods.
@@ -25,6 +24,7 @@ type ParentalControlSettings struct {
 	UserID             string               `json:"userId" bson:"userId"`
 	BlockedApps        map[string]bool      `json:"blockedApps" bson:"blockedApps"`               // Map of app/service name to blocked status
 	RecreationSchedule map[string]TimeRange `json:"recreationSchedule" bson:"recreationSchedule"` // Map of day ("Monday", "Tuesday", etc.) to TimeRange
+	Revision           int64                `json:"-" bson:"revision,omitempty"`                  // Sent as the ETag
 }
 
 // defaultParentalControlSettings returns a ParentalControlSettings struct with default values.
@@ -85,130 +85,77 @@ func defaultParentalControlSettings(userID string) ParentalControlSettings {
 	}
 }
 
-// ParentalControlHandler routes requests for parental control settings based on HTTP method.
-func ParentalControlHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract userID from path, e.g., /settings/parental/user123
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) < 3 || pathParts[0] != "settings" || pathParts[1] != "parental" {
-		http.Error(w, "Invalid path format. Expected /settings/parental/{userID}", http.StatusBadRequest)
-		return
-	}
-	userID := pathParts[2]
-	if userID == "" {
-		http.Error(w, "User ID cannot be empty", http.StatusBadRequest)
-		return
-	}
-
-	// Get database handle
-	db, err := database.GetSettingsDB()
-	if err != nil {
-		log.Printf("Error getting database handle: %v", err)
-		http.Error(w, "Server configuration error (database)", http.StatusInternalServerError)
-		return
+// GetParentalControlSettings handles GET /v1/users/{userID}/settings/parental.
+func GetParentalControlSettings(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := settingsRequest(w, r); ok {
+		getParentalControlSettings(w, r, userID, db)
 	}
-	// *** IMPORTANT: Ensure db.ParentalControl collection exists and is initialized in your database package ***
-	// Example check (adjust based on your database package structure):
-	// if db.ParentalControl == nil {
-	//  log.Println("Error: Parental Control MongoDB collection is not initialized.")
-	//  http.Error(w, "Server configuration error (collection)", http.StatusInternalServerError)
-	//  return
-	// }
+}
 
-	switch r.Method {
-	case http.MethodGet:
-		getParentalControlSettings(w, r, userID, db) // Pass db handle
-	case http.MethodPatch:
-		updateParentalControlSettings(w, r, userID, db) // Pass db handle
-	default:
-		w.Header().Set("Allow", "GET, PATCH")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// UpdateParentalControlSettings handles PATCH /v1/users/{userID}/settings/parental.
+func UpdateParentalControlSettings(w http.ResponseWriter, r *http.Request) {
+	if userID, db, ok := settingsRequest(w, r); ok {
+		updateParentalControlSettings(w, r, userID, db)
 	}
 }
 
 // getParentalControlSettings handles GET requests to fetch user parental control settings.
-func getParentalControlSettings(w http.ResponseWriter, r *http.Request, userID string, db *database.UserSettings_DB) { // Accept db handle
-	log.Printf("GET /settings/parental/%s", userID)
-	var settings ParentalControlSettings
+func getParentalControlSettings(w http.ResponseWriter, r *http.Request, userID string, db database.Stores) { // Accept db handle
+	logger := logging.FromContext(r.Context())
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
 	defer cancel()
 
-	filter := bson.M{"userId": userID}
-	// *** IMPORTANT: Use the correct collection handle from your db struct (e.g., db.ParentalControl) ***
-	err := db.Parental.FindOne(ctx, filter).Decode(&settings) // Replace 'ParentalControl' if needed
-
+	settings, err := loadParental(ctx, db.Settings, userID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Printf("No parental control settings found for userID %s, returning defaults.", userID)
-			settings = defaultParentalControlSettings(userID)
-			// Proceed to send default settings
-		} else {
-			log.Printf("Error fetching parental control settings for userID %s from DB: %v", userID, err)
-			http.Error(w, "Failed to retrieve parental control settings", http.StatusInternalServerError)
-			return
-		}
+		logger.Error("Error fetching parental control settings from DB", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to retrieve parental control settings")
+		return
 	}
 
-	// Ensure all default apps are present in the response, even if not stored in DB yet
-	// This handles cases where new apps are added to the defaults later.
-	defaultSettings := defaultParentalControlSettings(userID)
-	if settings.BlockedApps == nil {
-		settings.BlockedApps = defaultSettings.BlockedApps
-	} else {
-		for app, blocked := range defaultSettings.BlockedApps {
-			if _, exists := settings.BlockedApps[app]; !exists {
-				settings.BlockedApps[app] = blocked // Add missing default app with default status
-			}
-		}
-	}
-	if settings.RecreationSchedule == nil {
-		settings.RecreationSchedule = defaultSettings.RecreationSchedule
-	} else {
-		// Ensure all days are present
-		for day, timeRange := range defaultSettings.RecreationSchedule {
-			if _, exists := settings.RecreationSchedule[day]; !exists {
-				settings.RecreationSchedule[day] = timeRange
-			}
-		}
+	if notModified(w, r, settings.Revision) {
+		return
 	}
-
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(settings); err != nil {
-		log.Printf("Error encoding parental control settings response for userID %s: %v", userID, err)
-		// Avoid writing header again if already written by http.Error
+		logger.Error("Error encoding parental control settings response", zap.Error(err))
+		// Avoid writing header again if already written by problem.Write
 	}
 }
 
 // updateParentalControlSettings handles PATCH requests to update user parental control settings.
-func updateParentalControlSettings(w http.ResponseWriter, r *http.Request, userID string, db *database.UserSettings_DB) { // Accept db handle
-	log.Printf("PATCH /settings/parental/%s", userID)
+func updateParentalControlSettings(w http.ResponseWriter, r *http.Request, userID string, db database.Stores) { // Accept db handle
+	logger := logging.FromContext(r.Context())
 	var updatedSettings ParentalControlSettings
 
-	if err := json.NewDecoder(r.Body).Decode(&updatedSettings); err != nil {
-		log.Printf("Error decoding parental control request body for userID %s: %v", userID, err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if _, ok := validate.Decode(w, r, &updatedSettings); !ok {
+		return
+	}
+
+	var errs validate.Errors
+	checkUserID(&errs, "userId", updatedSettings.UserID, userID)
+	checkParental(&errs, "", updatedSettings)
+	if errs.Write(w, r) {
 		return
 	}
-	defer r.Body.Close()
 
 	// Ensure the settings we save have the correct UserID from the path
 	updatedSettings.UserID = userID
 
 	// Basic validation (optional but recommended)
 	if updatedSettings.BlockedApps == nil {
-		log.Printf("Warning: Received PATCH request for userID %s with nil BlockedApps", userID)
+		logger.Warn("Received PATCH request with nil BlockedApps")
 		// Decide how to handle: reject, use defaults, or proceed? Here we proceed.
 		// updatedSettings.BlockedApps = defaultParentalControlSettings(userID).BlockedApps // Option: Reset to defaults
 	}
 	if updatedSettings.RecreationSchedule == nil {
-		log.Printf("Warning: Received PATCH request for userID %s with nil RecreationSchedule", userID)
+		logger.Warn("Received PATCH request with nil RecreationSchedule")
 		// updatedSettings.RecreationSchedule = defaultParentalControlSettings(userID).RecreationSchedule // Option: Reset to defaults
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second) // Increased timeout slightly for potentially larger updates
+	ctx, cancel := context.WithTimeout(r.Context(), api.RequestTimeout)
 	defer cancel()
 
-	filter := bson.M{"userId": userID}
 	// Create the update document carefully to avoid overwriting entire maps if only parts are sent
 	updateFields := bson.M{}
 	if updatedSettings.BlockedApps != nil {
@@ -221,70 +168,61 @@ func updateParentalControlSettings(w http.ResponseWriter, r *http.Request, userI
 		updateFields["recreationSchedule"] = updatedSettings.RecreationSchedule
 	}
 
+	var finalSettings ParentalControlSettings
 	if len(updateFields) == 0 {
-		log.Printf("No fields to update for parental control settings for userID %s", userID)
-		w.WriteHeader(http.StatusOK) // Or http.StatusNoContent
-		json.NewEncoder(w).Encode(map[string]string{"message": "No changes detected"})
-		return
-	}
-
-	update := bson.M{"$set": updateFields}
-	opts := options.Update().SetUpsert(true)
-
-	// *** IMPORTANT: Use the correct collection handle from your db struct (e.g., db.ParentalControl) ***
-	result, err := db.Parental.UpdateOne(ctx, filter, update, opts) // Replace 'ParentalControl' if needed
-	if err != nil {
-		log.Printf("Error updating/inserting parental control settings for userID %s in DB: %v", userID, err)
-		http.Error(w, "Failed to update parental control settings", http.StatusInternalServerError)
-		return
-	}
-
-	if result.UpsertedCount > 0 {
-		log.Printf("Inserted new parental control settings for userID %s", userID)
-	} else if result.ModifiedCount > 0 {
-		log.Printf("Updated existing parental control settings for userID %s", userID)
+		// Nothing to save: answer with the current settings, as an update would
+		logger.Debug("No fields to update for parental control settings")
+		current, err := loadParental(ctx, db.Settings, userID)
+		if err != nil {
+			logger.Error("Error fetching parental control settings from DB", zap.Error(err))
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to retrieve parental control settings")
+			return
+		}
+		if !matchesIfMatch(w, r, current.Revision) {
+			return
+		}
+		finalSettings = current
 	} else {
-		log.Printf("Parental control settings for userID %s were already up-to-date.", userID)
-	}
+		// The updated document is the full current state, including fields not sent in this request
+		if !updateSettings(ctx, w, r, db.Settings, database.CategoryParental, userID, updateFields, &finalSettings) {
+			return
+		}
+		logger.Info("Successfully updated parental control settings", zap.Int64("revision", finalSettings.Revision))
 
-	log.Printf("Successfully updated parental control settings for userID %s", userID)
+		// Merge defaults back in case some apps were missing from the stored doc before GET merge logic runs
+		mergeParentalDefaults(&finalSettings)
+	}
 
-	// Fetch the potentially merged/updated settings to return the full current state
-	var finalSettings ParentalControlSettings
-	err = db.Parental.FindOne(ctx, filter).Decode(&finalSettings)
-	if err != nil {
-		log.Printf("Error fetching updated parental control settings for userID %s after update: %v", userID, err)
-		// Still return success, but maybe log the inconsistency or return the input data
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(updatedSettings) // Return the input as fallback
-		return
+	w.Header().Set("ETag", etag(finalSettings.Revision))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // Set status before writing body
+	if err := json.NewEncoder(w).Encode(finalSettings); err != nil {
+		logger.Error("Error encoding parental control update response", zap.Error(err))
 	}
+}
 
-	// Merge defaults back in case some apps were missing from the stored doc before GET merge logic runs
-	defaultSettings := defaultParentalControlSettings(userID)
-	if finalSettings.BlockedApps == nil {
-		finalSettings.BlockedApps = defaultSettings.BlockedApps
+// mergeParentalDefaults adds the default status of every app and the default
+// time range of every day missing from settings. This handles apps added to the
+// defaults after the settings were stored.
+func mergeParentalDefaults(settings *ParentalControlSettings) {
+	defaultSettings := defaultParentalControlSettings(settings.UserID)
+	if settings.BlockedApps == nil {
+		settings.BlockedApps = defaultSettings.BlockedApps
 	} else {
 		for app, blocked := range defaultSettings.BlockedApps {
-			if _, exists := finalSettings.BlockedApps[app]; !exists {
-				finalSettings.BlockedApps[app] = blocked
+			if _, exists := settings.BlockedApps[app]; !exists {
+				settings.BlockedApps[app] = blocked // Add missing default app with default status
 			}
 		}
 	}
-	if finalSettings.RecreationSchedule == nil {
-		finalSettings.RecreationSchedule = defaultSettings.RecreationSchedule
+	if settings.RecreationSchedule == nil {
+		settings.RecreationSchedule = defaultSettings.RecreationSchedule
 	} else {
+		// Ensure all days are present
 		for day, timeRange := range defaultSettings.RecreationSchedule {
-			if _, exists := finalSettings.RecreationSchedule[day]; !exists {
-				finalSettings.RecreationSchedule[day] = timeRange
+			if _, exists := settings.RecreationSchedule[day]; !exists {
+				settings.RecreationSchedule[day] = timeRange
 			}
 		}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK) // Set status before writing body
-	if err := json.NewEncoder(w).Encode(finalSettings); err != nil {
-		log.Printf("Error encoding parental control update response for userID %s: %v", userID, err)
-	}
 }
@@ -0,0 +1,42 @@
+package settings
+
+import (
+	"net/http"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+)
+
+// api holds the handler settings and stores are the databases behind them, both
+// replaced by Configure before the server starts.
+var (
+	api    = config.Default().API
+	stores database.Stores
+)
+
+// Configure applies the handler settings and sets the stores they read and write.
+func Configure(cfg config.API, db database.Stores) {
+	api = cfg
+	stores = db
+}
+
+// settingsRequest returns the authenticated user and the stores for a request.
+// It writes a problem response and returns false if either is unavailable.
+func settingsRequest(w http.ResponseWriter, r *http.Request) (string, database.Stores, bool) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+		return "", database.Stores{}, false
+	}
+
+	if stores.Settings == nil || stores.Lists == nil {
+		logging.FromContext(r.Context()).Error("Settings stores are not configured")
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseUnavailable, "Server configuration error (database)")
+		return "", database.Stores{}, false
+	}
+
+	return userID, stores, true
+}
@@ -0,0 +1,118 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+// The revision of a general, privacy or parental settings document, which every
+// write increments, is sent as the ETag of the settings. Users without a
+// document, and documents written before revisions existed, are at revision 0.
+
+// etag formats a revision as a strong entity tag.
+func etag(revision int64) string {
+	return `"` + strconv.FormatInt(revision, 10) + `"`
+}
+
+// notModified sets the ETag of a settings response and, if the client's
+// If-None-Match already names it, answers 304 Not Modified and returns true.
+func notModified(w http.ResponseWriter, r *http.Request, revision int64) bool {
+	w.Header().Set("ETag", etag(revision))
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/") // If-None-Match uses the weak comparison
+		if tag == "*" || tag == etag(revision) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch parses the If-Match header into the revisions it accepts. The update
+// is unconditional when the header is absent or "*": settings always exist, as
+// defaults at least. Weak and malformed tags never match.
+func ifMatch(r *http.Request) (revisions []int64, unconditional bool) {
+	header := r.Header.Get("If-Match")
+	if strings.TrimSpace(header) == "" {
+		return nil, true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+		quoted, ok := strings.CutPrefix(tag, `"`)
+		if !ok {
+			continue
+		}
+		value, ok := strings.CutSuffix(quoted, `"`)
+		if !ok {
+			continue
+		}
+		if revision, err := strconv.ParseInt(value, 10, 64); err == nil && revision >= 0 {
+			revisions = append(revisions, revision)
+		}
+	}
+	return revisions, false
+}
+
+// matchesIfMatch writes a 412 and returns false unless the If-Match header
+// accepts settings at revision.
+func matchesIfMatch(w http.ResponseWriter, r *http.Request, revision int64) bool {
+	revisions, unconditional := ifMatch(r)
+	if unconditional || slices.Contains(revisions, revision) {
+		return true
+	}
+	preconditionFailed(w, r)
+	return false
+}
+
+// updateSettings sets fields on the user's settings of a category, creating
+// them if needed, bumps their revision and decodes the updated document into
+// result. With If-Match, the update only applies if the settings are at one of
+// the listed revisions; otherwise a 412 is written. Any failure writes a
+// problem response and returns false.
+func updateSettings(ctx context.Context, w http.ResponseWriter, r *http.Request, store database.SettingsStore, category database.SettingsCategory, userID string, fields bson.M, result any) bool {
+	logger := logging.FromContext(r.Context()).With(zap.String("category", string(category)))
+
+	revisions, unconditional := ifMatch(r)
+	if !unconditional && len(revisions) == 0 {
+		preconditionFailed(w, r)
+		return false
+	}
+
+	err := store.UpdateSettings(ctx, category, userID, fields, revisions, result)
+	switch {
+	case err == nil:
+		notifyChanged(userID)
+		return true
+	case errors.Is(err, database.ErrRevisionMismatch):
+		logger.Info("Settings update rejected, revision does not match", zap.Int64s("if_match", revisions))
+		preconditionFailed(w, r)
+	default:
+		logger.Error("Error updating/inserting settings in DB", zap.Error(err))
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeDatabaseError, "Failed to update settings")
+	}
+	return false
+}
+
+func preconditionFailed(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusPreconditionFailed, problem.CodePreconditionFailed,
+		"Settings were changed since they were read; fetch them again and retry")
+}
@@ -0,0 +1,88 @@
+package settings
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/validate"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// scheduleTimeLayout is the format of recreation times, e.g. "6:30 PM".
+const scheduleTimeLayout = "3:04 PM"
+
+// appCatalog holds the apps and services that parental control can block.
+var appCatalog = defaultParentalControlSettings("").BlockedApps
+
+// weekdays are the keys of a recreation schedule.
+var weekdays = func() map[string]bool {
+	days := make(map[string]bool, 7)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		days[day.String()] = true
+	}
+	return days
+}()
+
+// checkUserID records a user ID in the body that differs from the one in the path.
+func checkUserID(errs *validate.Errors, field, sent, userID string) {
+	if sent != "" && sent != userID {
+		errs.Add(field, "does not match the user ID in the path")
+	}
+}
+
+// requireAll records every member of fields missing from the body. Updates of
+// general and privacy settings replace all of them, so a member left out would
+// silently be reset to false.
+func requireAll(errs *validate.Errors, present validate.Members, fields bson.M) {
+	errs.Required(present, slices.Sorted(maps.Keys(fields))...)
+}
+
+// checkParental checks the apps and the schedule of parental settings. Either
+// may be nil; field prefixes the JSON path of the errors.
+func checkParental(errs *validate.Errors, field string, settings ParentalControlSettings) {
+	for _, app := range slices.Sorted(maps.Keys(settings.BlockedApps)) {
+		if _, ok := appCatalog[app]; !ok {
+			errs.Add(field+"blockedApps."+app, "is not a known app or service")
+		}
+	}
+
+	for _, day := range slices.Sorted(maps.Keys(settings.RecreationSchedule)) {
+		path := field + "recreationSchedule." + day
+		if !weekdays[day] {
+			errs.Add(path, "is not a day of the week, e.g. Monday")
+			continue
+		}
+		times := settings.RecreationSchedule[day]
+		start, startErr := time.Parse(scheduleTimeLayout, times.Start)
+		end, endErr := time.Parse(scheduleTimeLayout, times.End)
+		if startErr != nil {
+			errs.Add(path+".start", "must be a time such as \"12:00 PM\"")
+		}
+		if endErr != nil {
+			errs.Add(path+".end", "must be a time such as \"6:30 PM\"")
+		}
+		if startErr == nil && endErr == nil && !start.Before(end) {
+			errs.Add(path, "must start before it ends")
+		}
+	}
+}
+
+// checkDomains validates and normalizes a domain list, dropping duplicates.
+func checkDomains(errs *validate.Errors, field string, domains []string) []string {
+	seen := make(map[string]bool, len(domains))
+	normalized := make([]string, 0, len(domains))
+	for i, domain := range domains {
+		domain, err := validate.Domain(domain)
+		if err != nil {
+			errs.Add(field+"["+strconv.Itoa(i)+"]", "%s", err.Error())
+			continue
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,214 @@
+// Package iplinks resolves client addresses to the users they are linked to,
+// in batches and through a cache shared by the ETL and the resolver API.
+package iplinks
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/metrics"
+)
+
+// Resolver is an IPLinkStore caching the lookups and link histories of
+// another. Unlinked addresses are cached too, since most clients are not
+// linked to anyone. Cached entries expire after the configured TTL, or
+// earlier through Invalidate when links change.
+type Resolver struct {
+	store  database.IPLinkStore
+	config config.IPLinks
+	now    func() time.Time
+
+	mu        sync.Mutex
+	entries   map[netip.Addr]entry
+	histories map[netip.Addr]historyEntry
+	epoch     uint64    // Incremented by Invalidate, so that lookups started before it are not cached
+	swept     time.Time // Last removal of the expired entries
+}
+
+type entry struct {
+	userID  string // Empty if the address is not linked
+	expires time.Time
+}
+
+type historyEntry struct {
+	history database.LinkHistory // Every link of the address, whatever its time; empty if never linked
+	expires time.Time
+}
+
+var _ database.IPLinkStore = (*Resolver)(nil)
+
+// New returns a resolver looking up the addresses it has not cached in store.
+func New(store database.IPLinkStore, cfg config.IPLinks) *Resolver {
+	return &Resolver{
+		store:     store,
+		config:    cfg,
+		now:       time.Now,
+		entries:   make(map[netip.Addr]entry),
+		histories: make(map[netip.Addr]historyEntry),
+	}
+}
+
+// UserIDByIP implements database.IPLinkStore.
+func (r *Resolver) UserIDByIP(ctx context.Context, ip netip.Addr) (string, error) {
+	users, err := r.UserIDsByIP(ctx, []netip.Addr{ip})
+	if err != nil {
+		return "", err
+	}
+	return users[ip], nil
+}
+
+// UserIDsByIP implements database.IPLinkStore. The addresses that are not
+// cached are looked up in batches of the configured size.
+func (r *Resolver) UserIDsByIP(ctx context.Context, ips []netip.Addr) (map[netip.Addr]string, error) {
+	users := make(map[netip.Addr]string)
+	now := r.now()
+
+	r.mu.Lock()
+	r.sweep(now)
+	epoch := r.epoch
+	var missing []netip.Addr
+	seen := make(map[netip.Addr]bool)
+	for _, ip := range ips {
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		if cached, ok := r.entries[ip]; ok && now.Before(cached.expires) {
+			if cached.userID != "" {
+				users[ip] = cached.userID
+			}
+			continue
+		}
+		missing = append(missing, ip)
+	}
+	r.mu.Unlock()
+	metrics.RecordIPLinkLookups(len(seen)-len(missing), len(missing))
+
+	for start := 0; start < len(missing); start += r.config.BatchSize {
+		batch := missing[start:min(start+r.config.BatchSize, len(missing))]
+		found, err := r.store.UserIDsByIP(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		r.mu.Lock()
+		if r.config.CacheTTL > 0 && r.epoch == epoch {
+			expires := now.Add(r.config.CacheTTL)
+			for _, ip := range batch {
+				r.entries[ip] = entry{userID: found[ip], expires: expires}
+			}
+		}
+		r.mu.Unlock()
+		for ip, userID := range found {
+			users[ip] = userID
+		}
+	}
+	return users, nil
+}
+
+// LinkHistories implements database.IPLinkStore. Histories that are not
+// cached are looked up in batches of the configured size. With a cache, the
+// whole history of each address is looked up and cached, whatever from and
+// to, so that the next ETL runs reuse it although their range moves on.
+func (r *Resolver) LinkHistories(ctx context.Context, ips []netip.Addr, from, to time.Time) (map[netip.Addr]database.LinkHistory, error) {
+	histories := make(map[netip.Addr]database.LinkHistory)
+	add := func(ip netip.Addr, history database.LinkHistory) {
+		for _, link := range history {
+			if link.Overlaps(from, to) {
+				histories[ip] = append(histories[ip], link)
+			}
+		}
+	}
+	now := r.now()
+
+	r.mu.Lock()
+	r.sweep(now)
+	epoch := r.epoch
+	var missing []netip.Addr
+	seen := make(map[netip.Addr]bool)
+	for _, ip := range ips {
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		if cached, ok := r.histories[ip]; ok && now.Before(cached.expires) {
+			add(ip, cached.history)
+			continue
+		}
+		missing = append(missing, ip)
+	}
+	r.mu.Unlock()
+	metrics.RecordIPLinkLookups(len(seen)-len(missing), len(missing))
+
+	queryFrom, queryTo := from, to
+	if r.config.CacheTTL > 0 {
+		queryFrom, queryTo = time.Time{}, time.Time{}
+	}
+	for start := 0; start < len(missing); start += r.config.BatchSize {
+		batch := missing[start:min(start+r.config.BatchSize, len(missing))]
+		found, err := r.store.LinkHistories(ctx, batch, queryFrom, queryTo)
+		if err != nil {
+			return nil, err
+		}
+
+		r.mu.Lock()
+		if r.config.CacheTTL > 0 && r.epoch == epoch {
+			expires := now.Add(r.config.CacheTTL)
+			for _, ip := range batch {
+				r.histories[ip] = historyEntry{history: found[ip], expires: expires}
+			}
+		}
+		r.mu.Unlock()
+		for ip, history := range found {
+			add(ip, history)
+		}
+	}
+	return histories, nil
+}
+
+// Invalidate forgets the cached users of the addresses within network, or
+// of every address if network is not valid. Pass it to
+// database.WatchLinkedIPs to follow the changes made by the dashboard.
+func (r *Resolver) Invalidate(network netip.Prefix) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.epoch++
+	if !network.IsValid() {
+		clear(r.entries)
+		clear(r.histories)
+		return
+	}
+	network = network.Masked()
+	for ip := range r.entries {
+		if network.Contains(ip) {
+			delete(r.entries, ip)
+		}
+	}
+	for ip := range r.histories {
+		if network.Contains(ip) {
+			delete(r.histories, ip)
+		}
+	}
+}
+
+// sweep removes the expired entries, at most once per TTL. The caller holds r.mu.
+func (r *Resolver) sweep(now time.Time) {
+	if now.Sub(r.swept) < r.config.CacheTTL {
+		return
+	}
+	r.swept = now
+	for ip, cached := range r.entries {
+		if !now.Before(cached.expires) {
+			delete(r.entries, ip)
+		}
+	}
+	for ip, cached := range r.histories {
+		if !now.Before(cached.expires) {
+			delete(r.histories, ip)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package iplinks
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/database/memstore"
+)
+
+// countingStore records the batches looked up in a memstore.
+type countingStore struct {
+	*memstore.Store
+	batches        [][]netip.Addr
+	historyBatches [][]netip.Addr
+}
+
+func (s *countingStore) UserIDsByIP(ctx context.Context, ips []netip.Addr) (map[netip.Addr]string, error) {
+	s.batches = append(s.batches, ips)
+	return s.Store.UserIDsByIP(ctx, ips)
+}
+
+func (s *countingStore) LinkHistories(ctx context.Context, ips []netip.Addr, from, to time.Time) (map[netip.Addr]database.LinkHistory, error) {
+	s.historyBatches = append(s.historyBatches, ips)
+	return s.Store.LinkHistories(ctx, ips, from, to)
+}
+
+var (
+	home    = netip.MustParseAddr("2001:db8:0:1::10")
+	office  = netip.MustParseAddr("192.0.2.1")
+	unknown = netip.MustParseAddr("198.51.100.7")
+)
+
+func newResolver(t *testing.T, cfg config.IPLinks) (*Resolver, *countingStore, *time.Time) {
+	t.Helper()
+	store := &countingStore{Store: memstore.New()}
+	store.LinkIP(netip.MustParsePrefix("2001:db8::/56"), "alice", time.Now())
+	store.LinkIP(netip.MustParsePrefix("192.0.2.1/32"), "bob", time.Now())
+
+	r := New(store, cfg)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	return r, store, &now
+}
+
+func lookup(t *testing.T, r *Resolver, ips ...netip.Addr) map[netip.Addr]string {
+	t.Helper()
+	users, err := r.UserIDsByIP(context.Background(), ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return users
+}
+
+func TestResolverBatchesLookups(t *testing.T) {
+	r, store, _ := newResolver(t, config.IPLinks{BatchSize: 2})
+
+	users := lookup(t, r, home, office, home, unknown)
+	if len(users) != 2 || users[home] != "alice" || users[office] != "bob" {
+		t.Fatalf("users = %v, want alice and bob", users)
+	}
+	if len(store.batches) != 2 || len(store.batches[0]) != 2 || len(store.batches[1]) != 1 {
+		t.Fatalf("batches = %v, want the 3 distinct addresses in batches of 2", store.batches)
+	}
+
+	lookup(t, r, home)
+	if len(store.batches) != 3 {
+		t.Fatal("lookup cached without a cache TTL")
+	}
+}
+
+func TestResolverCachesLookups(t *testing.T) {
+	r, store, now := newResolver(t, config.IPLinks{CacheTTL: time.Minute, BatchSize: 100})
+
+	lookup(t, r, home, unknown)
+	users := lookup(t, r, home, unknown)
+	if users[home] != "alice" || len(store.batches) != 1 {
+		t.Fatalf("second lookup: users = %v after %d batches, want alice from the cache", users, len(store.batches))
+	}
+
+	*now = now.Add(time.Minute)
+	if userID, err := r.UserIDByIP(context.Background(), unknown); err != nil || userID != "" {
+		t.Fatalf("UserIDByIP = %q, %v, want an unlinked address", userID, err)
+	}
+	if len(store.batches) != 2 {
+		t.Fatalf("%d batches, want the expired address looked up again", len(store.batches))
+	}
+}
+
+func TestResolverInvalidate(t *testing.T) {
+	r, store, _ := newResolver(t, config.IPLinks{CacheTTL: time.Hour, BatchSize: 100})
+	lookup(t, r, home, office, unknown)
+
+	// Linking the unknown address only drops its entry
+	store.LinkIP(netip.MustParsePrefix("198.51.100.0/24"), "carol", time.Now())
+	r.Invalidate(netip.MustParsePrefix("198.51.100.0/24"))
+	users := lookup(t, r, home, office, unknown)
+	if users[unknown] != "carol" || len(store.batches) != 2 || len(store.batches[1]) != 1 {
+		t.Fatalf("users = %v after batches %v, want carol looked up alone", users, store.batches)
+	}
+
+	// An invalid prefix drops every entry
+	r.Invalidate(netip.Prefix{})
+	lookup(t, r, home, office, unknown)
+	if len(store.batches) != 3 || len(store.batches[2]) != 3 {
+		t.Fatalf("batches = %v, want every address looked up again", store.batches)
+	}
+}
+
+func TestResolverReportsStoreFailures(t *testing.T) {
+	r, store, _ := newResolver(t, config.IPLinks{CacheTTL: time.Hour, BatchSize: 100})
+	store.Fail(context.DeadlineExceeded)
+	if _, err := r.UserIDsByIP(context.Background(), []netip.Addr{home}); err == nil {
+		t.Fatal("lookup succeeded with a failing store")
+	}
+
+	store.Fail(nil)
+	if users := lookup(t, r, home); users[home] != "alice" {
+		t.Fatalf("users = %v, want the failure not to be cached", users)
+	}
+}
+
+func TestResolverCachesLinkHistories(t *testing.T) {
+	r, store, _ := newResolver(t, config.IPLinks{CacheTTL: time.Hour, BatchSize: 2})
+	histories := func(from, to time.Time) map[netip.Addr]database.LinkHistory {
+		t.Helper()
+		found, err := r.LinkHistories(context.Background(), []netip.Addr{home, office, unknown}, from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return found
+	}
+
+	// The office address moves to carol, after the links made by newResolver
+	moved := time.Now().Add(time.Minute)
+	store.LinkIP(netip.MustParsePrefix("192.0.2.1/32"), "carol", moved)
+
+	// Each run's range is cut from the whole histories cached by the first one
+	all := histories(time.Time{}, time.Time{})
+	if len(all) != 2 || len(all[home]) != 1 || len(all[office]) != 2 || len(store.historyBatches) != 2 {
+		t.Fatalf("histories = %v after batches %v, want alice's and both of the office in batches of 2", all, store.historyBatches)
+	}
+	later := histories(moved.Add(time.Minute), time.Time{})
+	if len(later[office]) != 1 || later[office].UserAt(moved.Add(time.Minute)) != "carol" || len(store.historyBatches) != 2 {
+		t.Fatalf("later histories = %v after %d batches, want carol's link from the cache", later, len(store.historyBatches))
+	}
+	earlier := histories(time.Time{}, moved.Add(-time.Second))
+	if len(earlier[office]) != 1 || earlier[office][0].UserID != "bob" {
+		t.Fatalf("earlier histories = %v, want bob's link only", earlier)
+	}
+
+	// A link change drops the histories of the addresses within its network
+	store.LinkIP(netip.MustParsePrefix("198.51.100.0/24"), "dave", moved)
+	r.Invalidate(netip.MustParsePrefix("198.51.100.0/24"))
+	if found := histories(moved, time.Time{}); found[unknown].UserAt(moved) != "dave" || len(store.historyBatches) != 3 {
+		t.Fatalf("histories = %v after batches %v, want dave's link looked up alone", found, store.historyBatches)
+	}
+}
@@ -0,0 +1,65 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// hook is a named shutdown step.
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager waits for a termination signal and then runs the registered
+// shutdown hooks one after the other, in registration order.
+type Manager struct {
+	timeout time.Duration
+	hooks   []hook
+}
+
+// New creates a Manager whose hooks must all complete within timeout.
+func New(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout}
+}
+
+// OnShutdown registers a step to run during shutdown. Steps run in the order they were
+// registered, so register the HTTP server before the databases it depends on.
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// SignalContext returns a context cancelled on SIGINT or SIGTERM.
+func SignalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// Wait blocks until ctx is done, then runs the shutdown hooks.
+// A failing hook is logged and does not prevent the following ones from running.
+func (m *Manager) Wait(ctx context.Context) error {
+	<-ctx.Done()
+	zap.L().Info("Shutdown requested, stopping services", zap.Duration("timeout", m.timeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	var errs []error
+	for _, h := range m.hooks {
+		start := time.Now()
+		if err := h.fn(shutdownCtx); err != nil {
+			zap.L().Error("Shutdown step failed", zap.String("step", h.name), zap.Duration("elapsed", time.Since(start)), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		zap.L().Info("Shutdown step completed", zap.String("step", h.name), zap.Duration("elapsed", time.Since(start)))
+	}
+
+	return errors.Join(errs...)
+}
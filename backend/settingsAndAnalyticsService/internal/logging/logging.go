@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// New builds the service logger. APP_ENV=development selects human-readable
+// console output at debug level; anything else logs JSON at info level.
+// LOG_FORMAT ("json" or "console") and LOG_LEVEL override either default.
+func New() (*zap.Logger, error) {
+	config := zap.NewProductionConfig()
+	if strings.EqualFold(os.Getenv("APP_ENV"), "development") {
+		config = zap.NewDevelopmentConfig()
+	}
+
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "":
+	case "json", "console":
+		config.Encoding = format
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q: must be json or console", format)
+	}
+	if config.Encoding == "console" {
+		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		parsed, err := zap.ParseAtomicLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+		}
+		config.Level = parsed
+	}
+
+	logger, err := config.Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building logger: %w", err)
+	}
+	return logger, nil
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the global logger if there is none.
+func FromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return zap.L()
+}
+
+// With returns a copy of ctx whose logger has fields added. Inside a request
+// handled by Middleware, the fields are also added to the request's access log entry.
+func With(ctx context.Context, fields ...zap.Field) context.Context {
+	if entry, ok := ctx.Value(entryKey{}).(*accessEntry); ok {
+		entry.add(fields)
+	}
+	return NewContext(ctx, FromContext(ctx).With(fields...))
+}
+
+type entryKey struct{}
+
+// accessEntry collects fields added by inner handlers for the access log.
+type accessEntry struct {
+	mu     sync.Mutex
+	fields []zap.Field
+}
+
+func (e *accessEntry) add(fields []zap.Field) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fields = append(e.fields, fields...)
+}
+
+func (e *accessEntry) snapshot() []zap.Field {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]zap.Field(nil), e.fields...)
+}
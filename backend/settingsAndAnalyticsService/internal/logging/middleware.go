@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the request ID. An ID sent by the client (or a proxy)
+// is reused so that logs can be correlated across services.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs.
+const maxRequestIDLength = 128
+
+// Middleware assigns every request an ID, makes a logger carrying it available
+// to handlers through FromContext, and writes one access log entry per request
+// with the matched route, status and latency. It must wrap the http.ServeMux so
+// that the matched route pattern is known, and sit inside the tracing middleware
+// so that entries carry the trace ID.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		entry := &accessEntry{}
+		logger := zap.L().With(zap.String("request_id", requestID))
+		if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+			logger = logger.With(zap.String("trace_id", span.TraceID().String()))
+		}
+		ctx := context.WithValue(NewContext(r.Context(), logger), entryKey{}, entry)
+		r = r.WithContext(ctx)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := "unmatched"
+		if _, path, found := strings.Cut(r.Pattern, " "); found {
+			route = path
+		}
+		fields := append([]zap.Field{
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.String("route", route),
+			zap.Int("status", recorder.status),
+			zap.Int("bytes", recorder.bytes),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("remote_addr", r.RemoteAddr),
+		}, entry.snapshot()...)
+
+		if recorder.status >= http.StatusInternalServerError {
+			logger.Error("Request failed", fields...)
+		} else {
+			logger.Info("Request completed", fields...)
+		}
+	})
+}
+
+// validRequestID accepts short IDs made of characters that are safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b) // Never fails on supported platforms
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status code and body size written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,254 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const namespace = "firedns"
+
+// Registry holds every metric exported by the service.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	mongoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongodb_command_duration_seconds",
+		Help:      "MongoDB command latency by database and command.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"database", "command"})
+
+	mongoErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mongodb_command_errors_total",
+		Help:      "Failed MongoDB commands by database and command.",
+	}, []string{"database", "command"})
+
+	postgresDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "postgres_query_duration_seconds",
+		Help:      "PostgreSQL query latency by query name.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"query"})
+
+	postgresErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "postgres_query_errors_total",
+		Help:      "Failed PostgreSQL queries by query name.",
+	}, []string{"query"})
+
+	sqliteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sqlite_query_duration_seconds",
+		Help:      "Embedded SQLite query latency by query name.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"query"})
+
+	sqliteErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sqlite_query_errors_total",
+		Help:      "Failed embedded SQLite queries by query name.",
+	}, []string{"query"})
+
+	throttled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by the rate limiter by budget class (read, write) and key (user, ip).",
+	}, []string{"class", "key"})
+
+	ipLinkLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ip_link_lookups_total",
+		Help:      "Client addresses resolved to linked users by result (hit, miss) of the cache.",
+	}, []string{"result"})
+
+	etlRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "etl_runs_total",
+		Help:      "Analytics ETL runs by result (success, failed, cancelled).",
+	}, []string{"result"})
+
+	etlLastRun = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etl_last_run_timestamp_seconds",
+		Help:      "Unix time at which the last analytics ETL run started.",
+	})
+
+	etlLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etl_last_success_timestamp_seconds",
+		Help:      "Unix time at which the last successful analytics ETL run started.",
+	})
+
+	etlDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etl_last_run_duration_seconds",
+		Help:      "Duration of the last analytics ETL run.",
+	})
+
+	etlDocumentsFetched = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etl_documents_fetched",
+		Help:      "DNSmessages documents fetched by the last analytics ETL run.",
+	})
+
+	etlUsersLoaded = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etl_users_loaded",
+		Help:      "Users whose analytics were loaded by the last analytics ETL run.",
+	})
+
+	etlLoadErrors = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etl_load_errors",
+		Help:      "Users whose analytics failed to load in the last analytics ETL run.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		mongoDuration, mongoErrors,
+		postgresDuration, postgresErrors,
+		sqliteDuration, sqliteErrors,
+		throttled,
+		ipLinkLookups,
+		etlRuns, etlLastRun, etlLastSuccess, etlDuration, etlDocumentsFetched, etlUsersLoaded, etlLoadErrors,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// InstrumentHTTP records the count and latency of every request served by next.
+// It must wrap the http.ServeMux so that the matched route pattern is known;
+// requests that match no route are labelled "unmatched".
+func InstrumentHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := "unmatched"
+		if r.Pattern != "" {
+			// Patterns look like "GET /v1/users/{userID}/logs"; the method is a label of its own
+			_, path, found := strings.Cut(r.Pattern, " ")
+			if !found {
+				path = r.Pattern
+			}
+			route = path
+		}
+		status := strconv.Itoa(recorder.status)
+
+		httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		httpDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// MongoMonitor returns a command monitor to install on MongoDB clients with
+// options.Client().SetMonitor.
+func MongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoDuration.WithLabelValues(e.DatabaseName, e.CommandName).Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoDuration.WithLabelValues(e.DatabaseName, e.CommandName).Observe(e.Duration.Seconds())
+			mongoErrors.WithLabelValues(e.DatabaseName, e.CommandName).Inc()
+		},
+	}
+}
+
+// ObservePostgres records a query that started at start and finished with err.
+// sql.ErrNoRows is an expected outcome and is not counted as an error.
+func ObservePostgres(query string, start time.Time, err error) {
+	postgresDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		postgresErrors.WithLabelValues(query).Inc()
+	}
+}
+
+// ObserveSQLite records a query of the embedded backend that started at start
+// and finished with err, counted as ObservePostgres counts them.
+func ObserveSQLite(query string, start time.Time, err error) {
+	sqliteDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		sqliteErrors.WithLabelValues(query).Inc()
+	}
+}
+
+// RecordThrottled counts a request rejected by the rate limiter.
+func RecordThrottled(class, key string) {
+	throttled.WithLabelValues(class, key).Inc()
+}
+
+// RecordIPLinkLookups counts addresses resolved from the cache and from PostgreSQL.
+func RecordIPLinkLookups(hits, misses int) {
+	ipLinkLookups.WithLabelValues("hit").Add(float64(hits))
+	ipLinkLookups.WithLabelValues("miss").Add(float64(misses))
+}
+
+// ETLRun describes the outcome of one analytics ETL run.
+type ETLRun struct {
+	Start            time.Time
+	Duration         time.Duration
+	Result           string // "success", "failed" or "cancelled"
+	DocumentsFetched int
+	UsersLoaded      int
+	LoadErrors       int
+}
+
+// RecordETLRun publishes the outcome of an analytics ETL run.
+func RecordETLRun(run ETLRun) {
+	etlRuns.WithLabelValues(run.Result).Inc()
+	etlLastRun.Set(float64(run.Start.Unix()))
+	etlDuration.Set(run.Duration.Seconds())
+	etlDocumentsFetched.Set(float64(run.DocumentsFetched))
+	etlUsersLoaded.Set(float64(run.UsersLoaded))
+	etlLoadErrors.Set(float64(run.LoadErrors))
+	if run.Result == "success" {
+		etlLastSuccess.Set(float64(run.Start.Unix()))
+	}
+}
@@ -0,0 +1,28 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"go.uber.org/zap"
+)
+
+// document is the OpenAPI 3 description of the API. Keep it in sync with the
+// handler types; openapi_test.go fails when a schema and its Go struct diverge.
+//
+//go:embed openapi.json
+var document []byte
+
+// Document returns the raw OpenAPI document.
+func Document() []byte {
+	return document
+}
+
+// Handler serves the OpenAPI document at GET /openapi.json.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(document); err != nil {
+		logging.FromContext(r.Context()).Error("Error writing OpenAPI document", zap.Error(err))
+	}
+}
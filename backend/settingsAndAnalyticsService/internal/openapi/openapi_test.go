@@ -0,0 +1,242 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/analytics"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/apikeys"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/health"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/settings"
+	"github.com/BrachiGH/firedns-dashboard/internal/openapi"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+)
+
+// schemaTypes maps component schemas to the Go types they describe.
+var schemaTypes = map[string]reflect.Type{
+	"GeneralSettings":         reflect.TypeOf(settings.GeneralSettings{}),
+	"PrivacySettings":         reflect.TypeOf(settings.PrivacySettings{}),
+	"TimeRange":               reflect.TypeOf(settings.TimeRange{}),
+	"ParentalControlSettings": reflect.TypeOf(settings.ParentalControlSettings{}),
+	"DenyListResponse":        reflect.TypeOf(settings.DenyListResponse{}),
+	"AllowListResponse":       reflect.TypeOf(settings.AllowListResponse{}),
+	"AllSettings":             reflect.TypeOf(settings.AllSettings{}),
+	"AddDomainRequest":        reflect.TypeOf(settings.AddDomainRequest{}),
+	"RemoveDomainRequest":     reflect.TypeOf(settings.RemoveDomainRequest{}),
+	"AnalyticsChartDataPoint": reflect.TypeOf(analytics.AnalyticsChartDataPoint{}),
+	"AnalyticsDomainCount":    reflect.TypeOf(analytics.AnalyticsDomainCount{}),
+	"AnalyticsResponse":       reflect.TypeOf(analytics.AnalyticsResponse{}),
+	"LogEntryResponse":        reflect.TypeOf(analytics.LogEntryResponse{}),
+	"APIKey":                  reflect.TypeOf(database.APIKey{}),
+	"CreateAPIKeyRequest":     reflect.TypeOf(apikeys.CreateAPIKeyRequest{}),
+	"CreateAPIKeyResponse":    reflect.TypeOf(apikeys.CreateAPIKeyResponse{}),
+	"RevokeAPIKeyRequest":     reflect.TypeOf(apikeys.RevokeAPIKeyRequest{}),
+	"APIKeysResponse":         reflect.TypeOf(apikeys.APIKeysResponse{}),
+	"HealthCheck":             reflect.TypeOf(health.Check{}),
+	"HealthReport":            reflect.TypeOf(health.Report{}),
+	"Problem":                 reflect.TypeOf(problem.Problem{}),
+	"FieldError":              reflect.TypeOf(problem.FieldError{}),
+}
+
+// stringSchemas are component schemas of Go string values.
+var stringSchemas = map[string]bool{"Scope": true}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []string           `json:"enum"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+}
+
+type document struct {
+	OpenAPI    string `json:"openapi"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadDocument(t *testing.T) document {
+	t.Helper()
+	var doc document
+	if err := json.Unmarshal(openapi.Document(), &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+func TestDocumentVersion(t *testing.T) {
+	if doc := loadDocument(t); !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("openapi = %q, want a 3.x document", doc.OpenAPI)
+	}
+}
+
+func TestEverySchemaIsChecked(t *testing.T) {
+	for name := range loadDocument(t).Components.Schemas {
+		if schemaTypes[name] == nil && !stringSchemas[name] {
+			t.Errorf("schema %s is not mapped to a Go type in schemaTypes", name)
+		}
+	}
+}
+
+func TestSchemasMatchGoTypes(t *testing.T) {
+	schemas := loadDocument(t).Components.Schemas
+	for name, typ := range schemaTypes {
+		t.Run(name, func(t *testing.T) {
+			s, ok := schemas[name]
+			if !ok {
+				t.Fatalf("schema %s is missing from openapi.json", name)
+			}
+			compare(t, name, s, typ)
+		})
+	}
+}
+
+func TestScopeEnumMatchesAuth(t *testing.T) {
+	var want []string
+	for _, scope := range auth.AllScopes {
+		want = append(want, string(scope))
+	}
+	got := slices.Clone(loadDocument(t).Components.Schemas["Scope"].Enum)
+	sort.Strings(want)
+	sort.Strings(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("Scope enum = %v, want %v", got, want)
+	}
+}
+
+// compare checks that s describes values of typ as encoding/json produces them.
+func compare(t *testing.T, path string, s *schema, typ reflect.Type) {
+	t.Helper()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		switch {
+		case stringSchemas[name]:
+			if typ.Kind() != reflect.String {
+				t.Errorf("%s: refers to string schema %s but Go type is %s", path, name, typ)
+			}
+		case schemaTypes[name] != typ:
+			t.Errorf("%s: refers to schema %s but Go type is %s", path, name, typ)
+		}
+		return
+	}
+
+	if typ == reflect.TypeOf(time.Time{}) {
+		if s.Type != "string" || s.Format != "date-time" {
+			t.Errorf("%s: time.Time should be a date-time string, got type %q format %q", path, s.Type, s.Format)
+		}
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		expectType(t, path, s, "string")
+	case reflect.Bool:
+		expectType(t, path, s, "boolean")
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		expectType(t, path, s, "integer")
+	case reflect.Float32, reflect.Float64:
+		expectType(t, path, s, "number")
+	case reflect.Slice:
+		if expectType(t, path, s, "array") {
+			if s.Items == nil {
+				t.Errorf("%s: array schema has no items", path)
+				return
+			}
+			compare(t, path+"[]", s.Items, typ.Elem())
+		}
+	case reflect.Map:
+		if expectType(t, path, s, "object") {
+			if s.AdditionalProperties == nil {
+				t.Errorf("%s: map schema has no additionalProperties", path)
+				return
+			}
+			compare(t, path+"{}", s.AdditionalProperties, typ.Elem())
+		}
+	case reflect.Struct:
+		if expectType(t, path, s, "object") {
+			compareStruct(t, path, s, typ)
+		}
+	default:
+		t.Errorf("%s: unsupported Go kind %s", path, typ.Kind())
+	}
+}
+
+func expectType(t *testing.T, path string, s *schema, want string) bool {
+	t.Helper()
+	if s.Type != want {
+		t.Errorf("%s: schema type is %q, Go type encodes as %q", path, s.Type, want)
+		return false
+	}
+	return true
+}
+
+type jsonField struct {
+	typ      reflect.Type
+	required bool
+}
+
+// jsonFields lists the JSON members of a struct, flattening embedded structs.
+func jsonFields(typ reflect.Type) map[string]jsonField {
+	fields := make(map[string]jsonField)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for n, ef := range jsonFields(f.Type) {
+				fields[n] = ef
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		omitempty := strings.Contains(opts, "omitempty")
+		fields[name] = jsonField{typ: f.Type, required: !omitempty && f.Type.Kind() != reflect.Pointer}
+	}
+	return fields
+}
+
+func compareStruct(t *testing.T, path string, s *schema, typ reflect.Type) {
+	t.Helper()
+	fields := jsonFields(typ)
+
+	for name, field := range fields {
+		prop, ok := s.Properties[name]
+		if !ok {
+			t.Errorf("%s: Go field %q is missing from the schema", path, name)
+			continue
+		}
+		compare(t, path+"."+name, prop, field.typ)
+
+		if field.required != slices.Contains(s.Required, name) {
+			t.Errorf("%s: %q required = %v in the schema, want %v", path, name, !field.required, field.required)
+		}
+	}
+	for name := range s.Properties {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("%s: schema property %q has no Go field", path, name)
+		}
+	}
+}
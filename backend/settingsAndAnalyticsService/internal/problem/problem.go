@@ -0,0 +1,90 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"go.uber.org/zap"
+)
+
+// ContentType is the media type of RFC 7807 problem details.
+const ContentType = "application/problem+json"
+
+// Machine-readable error codes returned in the "code" member of every problem.
+const (
+	CodeInvalidPath         = "invalid_path"
+	CodeInvalidBody         = "invalid_body"
+	CodeInvalidField        = "invalid_field"
+	CodeValidationFailed    = "validation_failed"
+	CodeBodyTooLarge        = "body_too_large"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeInsufficientScope   = "insufficient_scope"
+	CodeNotFound            = "not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeRateLimited         = "rate_limited"
+	CodePreconditionFailed  = "precondition_failed"
+	CodeDatabaseUnavailable = "database_unavailable"
+	CodeDatabaseError       = "database_error"
+	CodeInternal            = "internal_error"
+)
+
+// Problem is the error envelope returned by every endpoint (RFC 7807).
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+
+	// Errors lists every invalid member of the request body of a 422 response.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is an invalid member of a request body. Field is its JSON path,
+// e.g. "recreationSchedule.Monday.start".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// New builds a problem for status with the given code and human-readable detail.
+func New(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "urn:firedns:problem:" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Write sends a problem response for the request.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	write(w, r, New(status, code, detail))
+}
+
+// WriteInvalid sends a 422 response listing every invalid field of the request body.
+func WriteInvalid(w http.ResponseWriter, r *http.Request, errs []FieldError) {
+	detail := "1 field is invalid"
+	if len(errs) != 1 {
+		detail = strconv.Itoa(len(errs)) + " fields are invalid"
+	}
+	p := New(http.StatusUnprocessableEntity, CodeValidationFailed, detail)
+	p.Errors = errs
+	write(w, r, p)
+}
+
+func write(w http.ResponseWriter, r *http.Request, p Problem) {
+	p.Instance = r.URL.Path
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		logging.FromContext(r.Context()).Error("Error encoding problem response", zap.Error(err))
+	}
+}
@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/metrics"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"golang.org/x/time/rate"
+)
+
+// Class separates the budgets of routes that only read from routes that write.
+type Class string
+
+const (
+	Read  Class = "read"
+	Write Class = "write"
+)
+
+// ClassOf returns the budget class of an HTTP method.
+func ClassOf(method string) Class {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return Read
+	default:
+		return Write
+	}
+}
+
+// Limiter throttles requests per client IP and per authenticated user.
+type Limiter struct {
+	config config.RateLimit
+	user   map[Class]*buckets
+	ip     map[Class]*buckets
+}
+
+// New creates a limiter with the given budgets.
+func New(cfg config.RateLimit) *Limiter {
+	return &Limiter{
+		config: cfg,
+		user: map[Class]*buckets{
+			Read:  newBuckets(cfg.UserRead),
+			Write: newBuckets(cfg.UserWrite),
+		},
+		ip: map[Class]*buckets{
+			Read:  newBuckets(cfg.IPRead),
+			Write: newBuckets(cfg.IPWrite),
+		},
+	}
+}
+
+// ByIP throttles requests by client address. It runs before authentication so
+// that requests with bad credentials are throttled too.
+func (l *Limiter) ByIP(class Class, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if delay, ok := l.ip[class].take(l.clientIP(r)); !ok {
+			reject(w, r, class, "ip", delay)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ByUser throttles requests by authenticated user; it must run after auth.RequireUser.
+func (l *Limiter) ByUser(class Class, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if userID, found := auth.UserIDFromContext(r.Context()); found {
+			if delay, ok := l.user[class].take(userID); !ok {
+				reject(w, r, class, "user", delay)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// reject sends a 429 telling the client when a token will be available.
+func reject(w http.ResponseWriter, r *http.Request, class Class, key string, delay time.Duration) {
+	metrics.RecordThrottled(string(class), key)
+
+	seconds := int(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	problem.Write(w, r, http.StatusTooManyRequests, problem.CodeRateLimited, "Rate limit exceeded for "+string(class)+" requests")
+}
+
+func (l *Limiter) clientIP(r *http.Request) string {
+	if l.config.TrustForwardedFor {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			// The last entry was added by our proxy; earlier ones are client-controlled
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// idleTimeout is how long an unused bucket is kept. A bucket idle for this
+// long has refilled completely, so dropping it does not change any decision.
+const idleTimeout = 10 * time.Minute
+
+// buckets holds one token bucket per key.
+type buckets struct {
+	budget    config.Budget
+	mu        sync.Mutex
+	entries   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newBuckets(budget config.Budget) *buckets {
+	return &buckets{budget: budget, entries: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// take consumes a token for key. When none is available it returns false and
+// how long until one will be.
+func (b *buckets) take(key string) (time.Duration, bool) {
+	if !b.budget.Enabled() {
+		return 0, true
+	}
+	now := time.Now()
+
+	b.mu.Lock()
+	if now.Sub(b.lastSweep) > idleTimeout {
+		for k, e := range b.entries {
+			if now.Sub(e.lastSeen) > idleTimeout {
+				delete(b.entries, k)
+			}
+		}
+		b.lastSweep = now
+	}
+	e, found := b.entries[key]
+	if !found {
+		e = &bucket{limiter: rate.NewLimiter(rate.Limit(b.budget.Rate), b.budget.Burst)}
+		b.entries[key] = e
+	}
+	e.lastSeen = now
+	b.mu.Unlock()
+
+	reservation := e.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now) // Rejected requests do not spend tokens
+		return delay, false
+	}
+	return 0, true
+}
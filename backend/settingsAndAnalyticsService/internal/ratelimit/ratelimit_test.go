@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+)
+
+// small lets a key make two requests; the next token comes after 1000s, so
+// none is refilled during a test.
+var small = config.Budget{Rate: 0.001, Burst: 2}
+
+func ok(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) }
+
+// request sends a request from addr, authenticated as userID if not empty.
+func request(handler http.HandlerFunc, method, addr, userID string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/v1/users/alice/settings", nil)
+	r.RemoteAddr = addr + ":1234"
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Add(header[i], header[i+1])
+	}
+	if userID != "" {
+		r = r.WithContext(auth.NewContext(r.Context(), auth.Identity{UserID: userID}))
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, r)
+	return rec
+}
+
+// wantThrottled checks the 429 response of a rejected request.
+func wantThrottled(t *testing.T, rec *httptest.ResponseRecorder, class Class) {
+	t.Helper()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", rec.Code)
+	}
+	if seconds, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || seconds < 1 {
+		t.Errorf("Retry-After %q, want a positive number of seconds", rec.Header().Get("Retry-After"))
+	}
+	var p problem.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("body %q is not a problem: %v", rec.Body, err)
+	}
+	if p.Code != problem.CodeRateLimited || p.Status != http.StatusTooManyRequests || p.Detail != "Rate limit exceeded for "+string(class)+" requests" {
+		t.Errorf("problem = %+v, want %s for %s requests", p, problem.CodeRateLimited, class)
+	}
+}
+
+// spend makes the requests a budget of burst 2 allows.
+func spend(t *testing.T, send func() *httptest.ResponseRecorder) {
+	t.Helper()
+	for range small.Burst {
+		if rec := send(); rec.Code != http.StatusNoContent {
+			t.Fatalf("status %d within the burst, want 204", rec.Code)
+		}
+	}
+}
+
+func TestByIP(t *testing.T) {
+	limiter := New(config.RateLimit{IPRead: small})
+	handler := limiter.ByIP(Read, ok)
+
+	spend(t, func() *httptest.ResponseRecorder { return request(handler, http.MethodGet, "192.0.2.1", "") })
+	wantThrottled(t, request(handler, http.MethodGet, "192.0.2.1", ""), Read)
+	// Rejected requests do not spend tokens, and other addresses have their own bucket
+	wantThrottled(t, request(handler, http.MethodGet, "192.0.2.1", ""), Read)
+	spend(t, func() *httptest.ResponseRecorder { return request(handler, http.MethodGet, "192.0.2.2", "") })
+
+	// The forwarded address is ignored unless the proxy is trusted
+	forwarded := func() *httptest.ResponseRecorder {
+		return request(handler, http.MethodGet, "192.0.2.1", "", "X-Forwarded-For", "198.51.100.9, 198.51.100.1")
+	}
+	wantThrottled(t, forwarded(), Read)
+	handler = New(config.RateLimit{IPRead: small, TrustForwardedFor: true}).ByIP(Read, ok)
+	spend(t, forwarded)
+	wantThrottled(t, forwarded(), Read)
+	// Only the entry added by the proxy is used, the client's own are not
+	if rec := request(handler, http.MethodGet, "192.0.2.1", "", "X-Forwarded-For", "203.0.113.7, 198.51.100.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status %d with a spoofed first hop, want 429", rec.Code)
+	}
+}
+
+func TestByUser(t *testing.T) {
+	limiter := New(config.RateLimit{UserWrite: small})
+	handler := limiter.ByUser(Write, ok)
+
+	// Users share an address but not a budget
+	spend(t, func() *httptest.ResponseRecorder { return request(handler, http.MethodPatch, "192.0.2.1", "alice") })
+	wantThrottled(t, request(handler, http.MethodPatch, "192.0.2.1", "alice"), Write)
+	spend(t, func() *httptest.ResponseRecorder { return request(handler, http.MethodPatch, "192.0.2.1", "bob") })
+
+	// Unauthenticated requests are left to ByIP
+	for range 2 * small.Burst {
+		if rec := request(handler, http.MethodPatch, "192.0.2.1", ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("status %d without a user, want 204", rec.Code)
+		}
+	}
+}
+
+func TestReadAndWriteBudgets(t *testing.T) {
+	for method, class := range map[string]Class{
+		http.MethodGet: Read, http.MethodHead: Read, http.MethodOptions: Read,
+		http.MethodPost: Write, http.MethodPut: Write, http.MethodPatch: Write, http.MethodDelete: Write,
+	} {
+		if got := ClassOf(method); got != class {
+			t.Errorf("ClassOf(%s) = %s, want %s", method, got, class)
+		}
+	}
+
+	limiter := New(config.RateLimit{UserRead: small, UserWrite: small, IPRead: small, IPWrite: small})
+	route := func(method string) *httptest.ResponseRecorder {
+		class := ClassOf(method)
+		return request(limiter.ByIP(class, limiter.ByUser(class, ok)), method, "192.0.2.1", "alice")
+	}
+
+	spend(t, func() *httptest.ResponseRecorder { return route(http.MethodGet) })
+	wantThrottled(t, route(http.MethodGet), Read)
+	// Exhausting reads leaves writes alone
+	spend(t, func() *httptest.ResponseRecorder { return route(http.MethodDelete) })
+	wantThrottled(t, route(http.MethodPost), Write)
+}
+
+func TestDisabledBudgets(t *testing.T) {
+	limiter := New(config.RateLimit{})
+	handler := limiter.ByIP(Write, limiter.ByUser(Write, ok))
+	for range 100 {
+		if rec := request(handler, http.MethodPost, "192.0.2.1", "alice"); rec.Code != http.StatusNoContent {
+			t.Fatalf("status %d without budgets, want 204", rec.Code)
+		}
+	}
+}
@@ -2,71 +2,144 @@ package etl
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"net/netip"
+	"slices"
 	"time"
 
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
 	"github.com/BrachiGH/firedns-dashboard/internal/database" // Adjust import path if needed
-	"go.mongodb.org/mongo-driver/bson/primitive"              // For handling ISODate
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/metrics"
+	"github.com/BrachiGH/firedns-dashboard/internal/tracing"
+	"go.mongodb.org/mongo-driver/bson/primitive" // For handling ISODate
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
-// RunAnalyticsETL performs one cycle of the ETL process.
-func RunAnalyticsETL() {
-	log.Println("Starting Analytics ETL process...")
+// Options selects the DNS messages counted by a run.
+type Options struct {
+	From   time.Time // Entries at or before From are ignored
+	To     time.Time // Entries after To are ignored; zero means no upper bound
+	UserID string    // Only this user's analytics are rebuilt; empty means every user
+}
+
+// RunAnalyticsETL performs one cycle of the ETL process and reports whether it succeeded.
+// Cancelling ctx stops the run between steps; an upsert that has already started is allowed to finish.
+func RunAnalyticsETL(ctx context.Context, cfg config.ETL, db database.Stores) bool {
 	startTime := time.Now()
+	logger := logging.FromContext(ctx).With(zap.Time("run_started", startTime))
+	ctx = logging.NewContext(ctx, logger)
+	logger.Info("Starting Analytics ETL process")
+	runStarting(startTime)
 
-	// --- Connect to Databases ---
-	analyticsDB, err := database.GetAnalyticsDB()
-	if err != nil {
-		// Attempt to connect if not already connected (or handle this in main/init)
-		log.Println("Analytics DB not connected, attempting connection...")
-		tempDB := &database.Analytics_DB{}
-		if err := tempDB.Connect(); err != nil {
-			log.Printf("ETL Error: Failed to connect to Analytics MongoDB: %v", err)
-			return
-		}
-		analyticsDB, _ = database.GetAnalyticsDB() // Get the now connected global instance
-		// Ensure disconnect is handled on application shutdown
-		// defer analyticsDB.Disconnect() // Be careful with defer in long-running routines
+	run := runETL(ctx, "etl.run", cfg, db, Options{From: startTime.Add(-cfg.Window)})
+	metrics.RecordETLRun(run)
+	runFinished(startTime, run.Result == "success")
+	return run.Result == "success"
+}
+
+// Backfill rebuilds the analytics of every user, or only opts.UserID, from the
+// DNS messages between opts.From and opts.To. The rebuilt counts replace the
+// stored ones, as a regular run would. Backfills are not reported to the
+// routine's health status.
+func Backfill(ctx context.Context, cfg config.ETL, db database.Stores, opts Options) error {
+	if opts.From.IsZero() {
+		return fmt.Errorf("backfill needs a start time")
+	}
+	if !opts.To.IsZero() && !opts.From.Before(opts.To) {
+		return fmt.Errorf("backfill start %s is not before its end %s", opts.From.Format(time.RFC3339), opts.To.Format(time.RFC3339))
 	}
 
-	// Ensure PG connection is established (ConnectPG handles singleton)
-	_, err = database.ConnectPG()
-	if err != nil {
-		log.Printf("ETL Error: Failed to connect to PostgreSQL: %v", err)
-		return // Cannot proceed without PG connection
+	logger := logging.FromContext(ctx).With(zap.Time("from", opts.From), zap.Time("to", opts.To), zap.String("user_id", opts.UserID))
+	ctx = logging.NewContext(ctx, logger)
+	logger.Info("Starting Analytics ETL backfill")
+
+	run := runETL(ctx, "etl.backfill", cfg, db, opts)
+	metrics.RecordETLRun(run)
+	switch {
+	case run.Result == "cancelled":
+		return ctx.Err()
+	case run.Result != "success":
+		return fmt.Errorf("backfill failed, see the logs")
+	case run.LoadErrors > 0:
+		return fmt.Errorf("backfill failed to load %d of %d users", run.LoadErrors, run.LoadErrors+run.UsersLoaded)
+	}
+	return nil
+}
+
+// runETL extracts, transforms and loads the messages selected by opts, in a
+// trace named name with a child span per phase, from the analytics store of
+// db to users found through its links. Early returns leave the result as failed.
+func runETL(ctx context.Context, name string, cfg config.ETL, db database.Stores, opts Options) (run metrics.ETLRun) {
+	logger := logging.FromContext(ctx)
+	startTime := time.Now()
+	run = metrics.ETLRun{Start: startTime, Result: "failed"}
+
+	ctx, span := tracing.Start(ctx, name, trace.WithNewRoot(), trace.WithAttributes(
+		attribute.String("etl.from", opts.From.Format(time.RFC3339)),
+		attribute.String("etl.user_id", opts.UserID)))
+	defer func() {
+		run.Duration = time.Since(startTime)
+		span.SetAttributes(attribute.String("etl.result", run.Result),
+			attribute.Int("etl.documents_fetched", run.DocumentsFetched),
+			attribute.Int("etl.users_loaded", run.UsersLoaded),
+			attribute.Int("etl.load_errors", run.LoadErrors))
+		if run.Result == "failed" {
+			span.SetStatus(codes.Error, "ETL run failed")
+		}
+		span.End()
+	}()
+
+	// --- Check the databases (connected by the caller) ---
+	for _, ping := range db.Pings {
+		if err := ping.Check(ctx); err != nil {
+			logger.Error("ETL failed to reach a database", zap.String("database", ping.Name), zap.Error(err))
+			return run // Cannot proceed without every database
+		}
 	}
 
 	// --- Extract ---
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute) // Context for the entire ETL run
+	extractCtx, cancel := context.WithTimeout(ctx, cfg.ExtractTimeout)
 	defer cancel()
+	extractCtx, extractSpan := tracing.Start(extractCtx, "etl.extract")
 
-	log.Println("Fetching DNS messages from MongoDB...")
-	dnsMessages, err := analyticsDB.FetchAllDNSMessages(ctx)
+	logger.Info("Fetching DNS messages")
+	dnsMessages, err := db.Analytics.FetchAllDNSMessages(extractCtx)
+	tracing.End(extractSpan, err)
 	if err != nil {
-		log.Printf("ETL Error: Failed to fetch DNS messages: %v", err)
-		return
+		logger.Error("ETL failed to fetch DNS messages", zap.Error(err))
+		return run
 	}
-	log.Printf("Fetched %d DNS message documents.", len(dnsMessages))
+	logger.Info("Fetched DNS message documents", zap.Int("documents", len(dnsMessages)))
+	run.DocumentsFetched = len(dnsMessages)
 
 	// --- Transform ---
-	log.Println("Transforming data...")
-	// Map to hold aggregated results per user ID
-	userAnalyticsMap := make(map[string]*database.UserAnalytics)
-	cutoffTime := time.Now().Add(-24 * time.Hour)
+	logger.Info("Transforming data")
+	transformCtx, transformSpan := tracing.Start(ctx, "etl.transform")
 
+	// Fetch who held every address during the run's range at once, rather than one query per document
+	ips := make([]netip.Addr, 0, len(dnsMessages))
 	for _, msg := range dnsMessages {
-		// Get UserID for the IP
-		userID, err := database.GetUserIDByIP(msg.IP)
-		if err != nil {
-			log.Printf("Warning: Failed to get user ID for IP %d: %v. Skipping this IP.", msg.IP, err)
-			continue
-		}
-		if userID == "" {
-			// log.Printf("Info: No user ID found for IP %d. Skipping.", msg.IP)
-			continue // Skip if no user is linked to this IP
+		if msg.IP.IsValid() {
+			ips = append(ips, msg.IP.Addr)
 		}
+	}
+	histories, err := db.IPLinks.LinkHistories(transformCtx, ips, opts.From, opts.To)
+	if err != nil {
+		logger.Error("ETL failed to fetch link histories", zap.Int("ips", len(ips)), zap.Error(err))
+		tracing.End(transformSpan, err)
+		return run
+	}
 
-		// Initialize map entry if needed
+	// Map to hold aggregated results per user ID
+	userAnalyticsMap := make(map[string]*database.UserAnalytics)
+	analyticsOf := func(userID string) *database.UserAnalytics {
+		if userID == "" || (opts.UserID != "" && userID != opts.UserID) {
+			return nil
+		}
 		if _, exists := userAnalyticsMap[userID]; !exists {
 			userAnalyticsMap[userID] = &database.UserAnalytics{
 				UserID:        userID,
@@ -74,43 +147,89 @@ func RunAnalyticsETL() {
 				DroppedCounts: make(map[string]int),
 			}
 		}
-		currentUserAnalytics := userAnalyticsMap[userID]
+		return userAnalyticsMap[userID]
+	}
 
-		// Process Passed domains
-		processDomainList(msg.Passed, cutoffTime, currentUserAnalytics.PassedCounts)
+	for _, msg := range dnsMessages {
+		if ctx.Err() != nil {
+			logger.Warn("ETL cancelled during transform, nothing was loaded")
+			tracing.End(transformSpan, ctx.Err())
+			run.Result = "cancelled"
+			return run
+		}
 
-		// Process Dropped domains (using "dorped" field name from example)
-		processDomainList(msg.Dropped, cutoffTime, currentUserAnalytics.DroppedCounts)
+		history := histories[msg.IP.Addr]
+		if len(history) == 0 {
+			continue // Skip if no user was linked to this IP
+		}
+		// Everyone who held the address gets fresh analytics, even without queries left to count
+		for _, link := range history {
+			analyticsOf(link.UserID)
+		}
+
+		// Each query counts for whoever held the address when it was asked
+		processDomainList(logger, msg.Passed, opts, func(domain string, at time.Time) {
+			if analytics := analyticsOf(history.UserAt(at)); analytics != nil {
+				analytics.PassedCounts[domain]++
+			}
+		})
+		dropped := msg.Dropped
+		if cfg.ReadLegacyDropped {
+			dropped = withLegacyDropped(msg.Dropped, msg.LegacyDropped)
+		}
+		processDomainList(logger, dropped, opts, func(domain string, at time.Time) {
+			if analytics := analyticsOf(history.UserAt(at)); analytics != nil {
+				analytics.DroppedCounts[domain]++
+			}
+		})
 	}
 
-	log.Printf("Transformed analytics for %d users.", len(userAnalyticsMap))
+	transformSpan.SetAttributes(attribute.Int("etl.users", len(userAnalyticsMap)))
+	transformSpan.End()
+	logger.Info("Transformed analytics", zap.Int("users", len(userAnalyticsMap)))
 
 	// --- Load ---
-	log.Println("Loading transformed data into userAnalytics collection...")
+	logger.Info("Loading transformed data into user analytics")
+	loadSpanCtx, loadSpan := tracing.Start(ctx, "etl.load")
+	defer loadSpan.End()
+	run.Result = "success"
 	loadErrors := 0
+	loaded := 0
 	for userID, analyticsData := range userAnalyticsMap {
+		if ctx.Err() != nil {
+			logger.Warn("ETL cancelled, skipping the remaining users", zap.Int("skipped", len(userAnalyticsMap)-loaded-loadErrors))
+			run.Result = "cancelled"
+			break
+		}
 		analyticsData.LastUpdated = time.Now() // Set update timestamp
 
-		loadCtx, loadCancel := context.WithTimeout(ctx, 10*time.Second) // Shorter context for each upsert
-		err := analyticsDB.UpsertUserAnalytics(loadCtx, *analyticsData)
+		// Detach from cancellation so shutdown never leaves a half-written upsert behind
+		loadCtx, loadCancel := context.WithTimeout(context.WithoutCancel(loadSpanCtx), cfg.LoadTimeout)
+		err := db.Analytics.UpsertUserAnalytics(loadCtx, *analyticsData)
 		loadCancel() // Cancel context immediately after use
 
 		if err != nil {
-			log.Printf("ETL Error: Failed to load analytics for user %s: %v", userID, err)
+			logger.Error("ETL failed to load analytics", zap.String("user_id", userID), zap.Error(err))
 			loadErrors++
+			continue
 		}
+		loaded++
 	}
 
-	duration := time.Since(startTime)
-	log.Printf("Analytics ETL process finished in %s. Loaded data for %d users with %d errors.", duration, len(userAnalyticsMap)-loadErrors, loadErrors)
+	run.UsersLoaded = loaded
+	run.LoadErrors = loadErrors
+
+	logger.Info("Analytics ETL process finished",
+		zap.Duration("duration", time.Since(startTime)), zap.Int("loaded", loaded), zap.Int("load_errors", loadErrors))
+	return run
 }
 
 // processDomainList iterates through a list of [domain, timestamp] pairs,
-// filters by time, and updates the counts map.
-func processDomainList(domainList [][]interface{}, cutoffTime time.Time, counts map[string]int) {
+// filters by the time range of opts, and calls count with those in range.
+func processDomainList(logger *zap.Logger, domainList [][]interface{}, opts Options, count func(domain string, at time.Time)) {
 	for _, entry := range domainList {
 		if len(entry) != 2 {
-			log.Printf("Warning: Malformed entry in domain list: %v. Skipping.", entry)
+			logger.Warn("Malformed entry in domain list, skipping", zap.Any("entry", entry))
 			continue
 		}
 
@@ -119,7 +238,7 @@ func processDomainList(domainList [][]interface{}, cutoffTime time.Time, counts
 		// Or potentially time.Time depending on driver version/configuration
 
 		if !okDomain {
-			log.Printf("Warning: Domain is not a string: %v. Skipping.", entry[0])
+			logger.Warn("Domain is not a string, skipping", zap.Any("domain", entry[0]))
 			continue
 		}
 		if !okTime {
@@ -128,32 +247,88 @@ func processDomainList(domainList [][]interface{}, cutoffTime time.Time, counts
 				timestamp = primitive.NewDateTimeFromTime(tTime)
 				okTime = true
 			} else {
-				log.Printf("Warning: Timestamp is not a recognized type (primitive.DateTime or time.Time): %T %v. Skipping.", entry[1], entry[1])
+				logger.Warn("Timestamp is not a recognized type (primitive.DateTime or time.Time), skipping",
+					zap.String("type", fmt.Sprintf("%T", entry[1])), zap.Any("timestamp", entry[1]))
 				continue
 			}
 		}
 
 		entryTime := timestamp.Time() // Convert primitive.DateTime to time.Time
-		if entryTime.After(cutoffTime) {
-			counts[domain]++
+		if entryTime.After(opts.From) && (opts.To.IsZero() || !entryTime.After(opts.To)) {
+			count(domain, entryTime)
+		}
+	}
+}
+
+// withLegacyDropped returns the dropped queries followed by the legacy ones
+// that are not among them, as documents written while resolvers moved to the
+// dropped field may hold a query in both.
+func withLegacyDropped(dropped, legacy [][]interface{}) [][]interface{} {
+	if len(legacy) == 0 {
+		return dropped
+	}
+	seen := make(map[droppedQuery]bool, len(dropped))
+	for _, entry := range dropped {
+		if query, ok := queryOf(entry); ok {
+			seen[query] = true
 		}
 	}
+	merged := slices.Clip(dropped)
+	for _, entry := range legacy {
+		if query, ok := queryOf(entry); ok && seen[query] {
+			continue
+		}
+		merged = append(merged, entry)
+	}
+	return merged
+}
+
+// droppedQuery identifies a [domain, timestamp] entry.
+type droppedQuery struct {
+	domain string
+	at     primitive.DateTime
+}
+
+// queryOf returns the query of a well-formed entry; processDomainList reports the others.
+func queryOf(entry []interface{}) (droppedQuery, bool) {
+	if len(entry) != 2 {
+		return droppedQuery{}, false
+	}
+	domain, ok := entry[0].(string)
+	switch at := entry[1].(type) {
+	case primitive.DateTime:
+		return droppedQuery{domain, at}, ok
+	case time.Time:
+		return droppedQuery{domain, primitive.NewDateTimeFromTime(at)}, ok
+	}
+	return droppedQuery{}, false
 }
 
-// StartETLRoutine runs the ETL process periodically.
-func StartETLRoutine(interval time.Duration) {
-	log.Printf("Starting ETL routine to run every %s", interval)
-	// Run once immediately
-	go RunAnalyticsETL()
+// StartETLRoutine runs the ETL process immediately and then every cfg.Interval until ctx is cancelled.
+// The returned channel is closed once the routine has stopped, after any run in progress has finished.
+func StartETLRoutine(ctx context.Context, cfg config.ETL, db database.Stores) <-chan struct{} {
+	logger := logging.FromContext(ctx)
+	logger.Info("Starting ETL routine", zap.Duration("interval", cfg.Interval))
+	done := make(chan struct{})
 
-	// Then run on a ticker
-	ticker := time.NewTicker(interval)
+	routineStarted(cfg.Interval)
 	go func() {
-		for range ticker.C {
-			RunAnalyticsETL()
+		defer close(done)
+		defer routineStopped()
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		RunAnalyticsETL(ctx, cfg, db)
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Info("ETL routine stopped")
+				return
+			case <-ticker.C:
+				RunAnalyticsETL(ctx, cfg, db)
+			}
 		}
 	}()
 
-	// Note: This function returns immediately. The ticker runs in a separate goroutine.
-	// Ensure the main application keeps running. Consider adding a stop channel for graceful shutdown.
+	return done
 }
@@ -0,0 +1,69 @@
+package etl
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/database/memstore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// messages serves fixed DNS messages, as MongoDB returns documents that the
+// memory store cannot write, such as those of older resolvers.
+type messages struct {
+	*memstore.Store
+	docs []database.DNSMessage
+}
+
+func (m messages) FetchAllDNSMessages(context.Context) ([]database.DNSMessage, error) {
+	return m.docs, nil
+}
+
+func TestLegacyDroppedCountedOnce(t *testing.T) {
+	ctx := context.Background()
+	ip := netip.MustParseAddr("192.0.2.1")
+	at := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	entry := func(domain string, at time.Time) []interface{} {
+		return []interface{}{domain, primitive.NewDateTimeFromTime(at)}
+	}
+
+	store := memstore.New()
+	store.LinkIP(netip.PrefixFrom(ip, 32), "alice", at.Add(-time.Hour))
+	db := store.Stores()
+	db.Analytics = messages{store, []database.DNSMessage{{
+		IP: database.IP{Addr: ip},
+		// Written while resolvers moved to the dropped field: one query is in both
+		Dropped:       [][]interface{}{entry("ads.example", at), entry("ads.example", at.Add(time.Second))},
+		LegacyDropped: [][]interface{}{{"ads.example", at}, entry("tracker.example", at)},
+	}}}
+
+	for _, tc := range []struct {
+		readLegacy bool
+		want       map[string]int
+	}{
+		{true, map[string]int{"ads.example": 2, "tracker.example": 1}},
+		{false, map[string]int{"ads.example": 2}},
+	} {
+		cfg := config.Default().ETL
+		cfg.ReadLegacyDropped = tc.readLegacy
+		if run := runETL(ctx, "etl.test", cfg, db, Options{From: at.Add(-time.Hour)}); run.Result != "success" {
+			t.Fatalf("run = %+v", run)
+		}
+		analytics, err := store.FindUserAnalytics(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(analytics.DroppedCounts) != len(tc.want) {
+			t.Errorf("readLegacyDropped %v: dropped counts = %v, want %v", tc.readLegacy, analytics.DroppedCounts, tc.want)
+		}
+		for domain, count := range tc.want {
+			if analytics.DroppedCounts[domain] != count {
+				t.Errorf("readLegacyDropped %v: dropped counts = %v, want %v", tc.readLegacy, analytics.DroppedCounts, tc.want)
+			}
+		}
+	}
+}
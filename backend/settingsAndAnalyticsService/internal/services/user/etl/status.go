@@ -0,0 +1,84 @@
+package etl
+
+import (
+	"sync"
+	"time"
+)
+
+// Status describes the ETL routine for health reporting.
+type Status struct {
+	Running     bool          // StartETLRoutine has been called and has not stopped
+	Started     time.Time     // When the routine was started
+	Interval    time.Duration // Time between runs
+	LastRun     time.Time     // Start of the most recent run, zero if none
+	LastSuccess time.Time     // Start of the most recent successful run, zero if none
+	Heartbeat   time.Time     // When the routine last started or finished a run
+}
+
+var (
+	statusMu sync.Mutex
+	status   Status
+)
+
+// CurrentStatus returns a snapshot of the ETL routine's status.
+func CurrentStatus() Status {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	return status
+}
+
+// StaleAfter is how long the routine may go without a successful run before
+// it is considered stuck. One missed run is tolerated.
+func (s Status) StaleAfter() time.Duration {
+	return 2 * s.Interval
+}
+
+// Stale reports whether the last successful run (or the routine start, if no
+// run has succeeded yet) is older than StaleAfter.
+func (s Status) Stale(now time.Time) bool {
+	if !s.Running {
+		return true
+	}
+	since := s.LastSuccess
+	if since.IsZero() {
+		since = s.Started
+	}
+	return now.Sub(since) > s.StaleAfter()
+}
+
+// Hung reports whether the routine has stopped or has neither started nor
+// finished a run within StaleAfter, whether or not its runs succeed.
+func (s Status) Hung(now time.Time) bool {
+	return !s.Running || now.Sub(s.Heartbeat) > s.StaleAfter()
+}
+
+func routineStarted(interval time.Duration) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status.Running = true
+	status.Started = time.Now()
+	status.Interval = interval
+	status.Heartbeat = status.Started
+}
+
+func routineStopped() {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status.Running = false
+}
+
+func runStarting(start time.Time) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status.Heartbeat = start
+}
+
+func runFinished(start time.Time, success bool) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status.LastRun = start
+	status.Heartbeat = time.Now()
+	if success {
+		status.LastSuccess = start
+	}
+}
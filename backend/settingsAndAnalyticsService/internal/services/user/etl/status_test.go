@@ -0,0 +1,27 @@
+package etl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatusHungAndStale(t *testing.T) {
+	now := time.Now()
+	for name, tc := range map[string]struct {
+		status      Status
+		hung, stale bool
+	}{
+		"stopped":        {Status{Interval: time.Minute, Heartbeat: now, LastSuccess: now}, true, true},
+		"healthy":        {Status{Running: true, Interval: time.Minute, Heartbeat: now, LastSuccess: now}, false, false},
+		"failing runs":   {Status{Running: true, Interval: time.Minute, Heartbeat: now, Started: now.Add(-time.Hour)}, false, true},
+		"run stuck":      {Status{Running: true, Interval: time.Minute, Heartbeat: now.Add(-3 * time.Minute), LastSuccess: now.Add(-3 * time.Minute)}, true, true},
+		"first run slow": {Status{Running: true, Interval: time.Minute, Heartbeat: now.Add(-time.Minute), Started: now.Add(-time.Minute)}, false, false},
+	} {
+		if got := tc.status.Hung(now); got != tc.hung {
+			t.Errorf("%s: Hung = %v, want %v", name, got, tc.hung)
+		}
+		if got := tc.status.Stale(now); got != tc.stale {
+			t.Errorf("%s: Stale = %v, want %v", name, got, tc.stale)
+		}
+	}
+}
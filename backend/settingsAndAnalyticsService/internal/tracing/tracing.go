@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/stats"
+)
+
+// instrumentationName identifies the spans started by this service's own code.
+const instrumentationName = "github.com/BrachiGH/firedns-dashboard"
+
+// untraced are the operational endpoints left out of traces: they are polled
+// constantly and would drown the spans of real requests.
+var untraced = map[string]bool{"/healthz": true, "/readyz": true}
+
+// Setup installs the global tracer provider described by cfg and the W3C trace
+// context propagator. The returned function flushes buffered spans and must be
+// called before the process exits. With the none exporter nothing is recorded,
+// but incoming trace context is still propagated.
+func Setup(ctx context.Context, cfg config.Tracing) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case config.ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case config.ExporterStdout:
+		// Stderr, so that commands writing their output to stdout stay usable
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint())
+	case config.ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		zap.L().Warn("OpenTelemetry error", zap.Error(err))
+	}))
+
+	zap.L().Info("Tracing enabled", zap.String("exporter", cfg.Exporter), zap.Float64("sample_ratio", cfg.SampleRatio))
+	return provider.Shutdown, nil
+}
+
+// Start starts a span, as a child of the span in ctx if there is one.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End marks span as failed if err is not nil, then ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a server span for every request, continuing the trace of
+// the caller if it sent one. It must be the outermost middleware: handlers
+// further in see the span through the request context. Spans are named after
+// the method until NameByRoute, which wraps the mux, knows the route.
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method }),
+		otelhttp.WithFilter(func(r *http.Request) bool { return !untraced[r.URL.Path] }),
+	)
+}
+
+// NameByRoute renames the server span after the route pattern matched by the
+// http.ServeMux it wraps, e.g. "GET /v1/users/{userID}/analytics", so that all
+// requests of a route are grouped together.
+func NameByRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		if r.Pattern == "" {
+			return
+		}
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Pattern)
+		if _, path, found := strings.Cut(r.Pattern, " "); found {
+			span.SetAttributes(semconv.HTTPRoute(path))
+		}
+	})
+}
+
+// MongoMonitor returns a command monitor that records a span per MongoDB
+// command. Command bodies are not recorded, they can hold user data.
+func MongoMonitor() *event.CommandMonitor {
+	return otelmongo.NewMonitor()
+}
+
+// GRPCHandler returns a stats handler that records a server span per gRPC
+// call, continuing the trace of the resolver node if it sent one.
+func GRPCHandler() stats.Handler {
+	return otelgrpc.NewServerHandler()
+}
@@ -0,0 +1,47 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+)
+
+// Limits of RFC 1035 on names in their presentation form.
+const (
+	maxDomainLength = 253
+	maxLabelLength  = 63
+)
+
+// Domain normalizes a domain name to lower case without a trailing dot and
+// checks its syntax. Internationalized names must be sent in their ASCII
+// (punycode) form. Underscores are allowed, as in service names.
+func Domain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	switch {
+	case domain == "":
+		return "", errors.New("must not be empty")
+	case len(domain) > maxDomainLength:
+		return "", errors.New("must be at most 253 characters long")
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", errors.New("must have at least two labels, e.g. example.com")
+	}
+	for _, label := range labels {
+		if label == "" {
+			return "", errors.New("must not contain empty labels")
+		}
+		if len(label) > maxLabelLength {
+			return "", errors.New("labels must be at most 63 characters long")
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return "", errors.New("labels must not start or end with a hyphen")
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return "", errors.New("may only contain letters, digits, hyphens and underscores; use punycode for other characters")
+			}
+		}
+	}
+	return domain, nil
+}
@@ -0,0 +1,167 @@
+// Package validate decodes request bodies strictly and collects every invalid
+// field, so that handlers can answer with one 422 listing all of them.
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"go.uber.org/zap"
+)
+
+// maxBodyBytes bounds request bodies, replaced by Configure before the server starts.
+var maxBodyBytes = int64(config.Default().API.MaxBodyBytes)
+
+// Configure applies the request limits.
+func Configure(cfg config.API) {
+	maxBodyBytes = int64(cfg.MaxBodyBytes)
+}
+
+// Errors collects the invalid fields of a request body.
+type Errors []problem.FieldError
+
+// Add records that field is invalid.
+func (e *Errors) Add(field, format string, args ...any) {
+	*e = append(*e, problem.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Required records every name missing from present, the members sent in the body.
+func (e *Errors) Required(present Members, names ...string) {
+	for _, name := range names {
+		if !present[name] {
+			e.Add(name, "is required")
+		}
+	}
+}
+
+// Write sends a 422 listing the errors and returns true, or returns false if there are none.
+func (e Errors) Write(w http.ResponseWriter, r *http.Request) bool {
+	if len(e) == 0 {
+		return false
+	}
+	logging.FromContext(r.Context()).Info("Rejected invalid request body", zap.Any("errors", e))
+	problem.WriteInvalid(w, r, e)
+	return true
+}
+
+// Members are the names of the top-level members of a JSON object. Members
+// sent as null map to false, as if they were missing.
+type Members map[string]bool
+
+// Decode reads a JSON object from the request body into dst, a pointer to a
+// struct. Bodies larger than the limit get 413, malformed JSON gets 400, and
+// members dst has no field for or of the wrong type get 422. On failure the
+// response is written and ok is false. present tells a missing member apart
+// from one sent with its zero value.
+func Decode(w http.ResponseWriter, r *http.Request, dst any) (present Members, ok bool) {
+	logger := logging.FromContext(r.Context())
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		logger.Warn("Rejected oversized request body", zap.Int64("limit", tooLarge.Limit))
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge,
+			fmt.Sprintf("Request body is larger than %d bytes", tooLarge.Limit))
+		return nil, false
+	}
+	if err != nil {
+		logger.Warn("Error reading request body", zap.Error(err))
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Invalid request body")
+		return nil, false
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		logger.Warn("Error decoding request body", zap.Error(err))
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Request body must be a JSON object")
+		return nil, false
+	}
+
+	// Report every unknown top-level member, not only the first one the decoder meets
+	var errs Errors
+	known := fieldNames(reflect.TypeOf(dst))
+	present = make(Members, len(members))
+	for _, name := range slices.Sorted(maps.Keys(members)) {
+		present[name] = string(members[name]) != "null"
+		if !known[name] {
+			errs.Add(name, "is not a known field")
+		}
+	}
+	if errs.Write(w, r) {
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &typeErr):
+			errs.Add(typeErr.Field, "must be a %s", jsonType(typeErr.Type))
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			// A member of a nested object; the decoder does not say which object
+			errs.Add(strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`), "is not a known field")
+		default:
+			logger.Warn("Error decoding request body", zap.Error(err))
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "Invalid request body")
+			return nil, false
+		}
+		errs.Write(w, r)
+		return nil, false
+	}
+	return present, true
+}
+
+// fieldNames returns the JSON member names of the struct typ points to.
+func fieldNames(typ reflect.Type) map[string]bool {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	names := make(map[string]bool)
+	if typ.Kind() != reflect.Struct {
+		return names
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-" || !f.IsExported():
+		case name == "":
+			names[f.Name] = true
+		default:
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// jsonType names the JSON type a Go type is decoded from.
+func jsonType(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,303 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/database/memstore"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/analytics"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/apikeys"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/health"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/settings"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"github.com/BrachiGH/firedns-dashboard/internal/ratelimit"
+	"github.com/BrachiGH/firedns-dashboard/internal/validate"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testSecret = "test-secret"
+	testUser   = "alice"
+)
+
+// testAPI serves the API from an in-memory store, without rate limits.
+type testAPI struct {
+	handler http.Handler
+	store   *memstore.Store
+	token   string // Session token of testUser
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	store := memstore.New()
+	configureHandlers(store.Stores())
+
+	authenticator, err := auth.NewAuthenticator(testSecret, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAPI{
+		handler: newRouter(authenticator, ratelimit.New(config.RateLimit{})),
+		store:   store,
+		token:   sessionToken(t, testUser),
+	}
+}
+
+// configureHandlers points every handler package at db, as NewApiServer does.
+func configureHandlers(db database.Stores) {
+	cfg := config.Default().API
+	settings.Configure(cfg, db)
+	analytics.Configure(cfg, db)
+	apikeys.Configure(cfg, db)
+	health.Configure(db)
+	validate.Configure(cfg)
+}
+
+// sessionToken signs a dashboard session token for userID.
+func sessionToken(t *testing.T, userID string) string {
+	t.Helper()
+	claims := auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   userID,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// apiKey stores an API key of testUser holding scopes and returns its secret.
+func (a *testAPI) apiKey(t *testing.T, scopes ...auth.Scope) string {
+	t.Helper()
+	key, keyHash, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	if _, err := a.store.CreateAPIKey(context.Background(), testUser, "test", prefix, keyHash, names); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// do sends a request to path, relative to the prefix of testUser, with the
+// bearer credential if not empty and header given as name, value pairs.
+func (a *testAPI) do(method, path, credential, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/v1/users/"+testUser+path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if credential != "" {
+		req.Header.Set("Authorization", "Bearer "+credential)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// wantStatus fails the test unless the response has status.
+func wantStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, status, rec.Body)
+	}
+}
+
+// wantProblem fails the test unless the response is a problem with status and code.
+func wantProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) problem.Problem {
+	t.Helper()
+	wantStatus(t, rec, status)
+	if ct := rec.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("Content-Type = %q, want %q", ct, problem.ContentType)
+	}
+	var p problem.Problem
+	decode(t, rec, &p)
+	if p.Code != code {
+		t.Fatalf("code = %q, want %q; detail: %s", p.Code, code, p.Detail)
+	}
+	return p
+}
+
+// wantFields fails the test unless a 422 problem lists exactly fields, in order.
+func wantFields(t *testing.T, rec *httptest.ResponseRecorder, fields ...string) {
+	t.Helper()
+	p := wantProblem(t, rec, http.StatusUnprocessableEntity, problem.CodeValidationFailed)
+	got := make([]string, len(p.Errors))
+	for i, e := range p.Errors {
+		got[i] = e.Field
+	}
+	if strings.Join(got, ",") != strings.Join(fields, ",") {
+		t.Fatalf("invalid fields = %v, want %v", got, fields)
+	}
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", rec.Body, err)
+	}
+}
+
+// Valid bodies of the test requests.
+const (
+	generalBody = `{"threatIntelligence": true, "googleSafeBrowsing": true, "homographProtection": false,
+		"typosquattingProtection": false, "blockNewDomains": true, "blockDynamicDNS": false, "blockCSAM": true}`
+	privacyBody = `{"adGuardMobileAdsFilter": true, "adAway": false, "hageziMultiPro": true,
+		"goodbyeAds": false, "hostsVN": false, "nextDNSAdsTrackers": true}`
+	parentalBody = `{"blockedApps": {"TikTok": true},
+		"recreationSchedule": {"Monday": {"start": "1:00 PM", "end": "5:00 PM"}}}`
+	allSettingsBody = `{"general": ` + generalBody + `, "privacy": ` + privacyBody + `, "parental": ` + parentalBody + `,
+		"denylist": ["Ads.Example.com."], "allowlist": ["example.org"]}`
+	domainBody = `{"domain": "ads.example.com"}`
+)
+
+// testRequests holds a valid body for every route, "" for none, keyed by method and path.
+var testRequests = map[string]string{
+	"GET /settings":              "",
+	"PUT /settings":              allSettingsBody,
+	"GET /settings/general":      "",
+	"PATCH /settings/general":    generalBody,
+	"GET /settings/privacy":      "",
+	"PATCH /settings/privacy":    privacyBody,
+	"GET /settings/parental":     "",
+	"PATCH /settings/parental":   parentalBody,
+	"GET /settings/denylist":     "",
+	"POST /settings/denylist":    domainBody,
+	"DELETE /settings/denylist":  domainBody,
+	"GET /settings/allowlist":    "",
+	"POST /settings/allowlist":   domainBody,
+	"DELETE /settings/allowlist": domainBody,
+	"GET /analytics":             "",
+	"GET /logs":                  "",
+	"GET /apikeys":               "",
+	"POST /apikeys":              `{"name": "ci", "scopes": ["settings:read"]}`,
+	"DELETE /apikeys":            `{"id": "1"}`,
+}
+
+// extraScopes are the scopes checked by handlers on top of the one of their route.
+var extraScopes = map[string]auth.Scope{
+	"GET /settings": auth.ScopeListsRead,
+	"PUT /settings": auth.ScopeListsWrite,
+}
+
+// forEachRoute runs fn for every route with its valid test body.
+func forEachRoute(t *testing.T, fn func(t *testing.T, rt route, body string)) {
+	for _, rt := range routes {
+		key := rt.method + " " + rt.path
+		t.Run(key, func(t *testing.T) {
+			body, ok := testRequests[key]
+			if !ok {
+				t.Fatalf("no test request for %s", key)
+			}
+			fn(t, rt, body)
+		})
+	}
+}
+
+func TestRoutesRequireCredentials(t *testing.T) {
+	api := newTestAPI(t)
+	forEachRoute(t, func(t *testing.T, rt route, body string) {
+		rec := api.do(rt.method, rt.path, "", body)
+		wantProblem(t, rec, http.StatusUnauthorized, problem.CodeUnauthorized)
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Error("401 without a WWW-Authenticate challenge")
+		}
+
+		wantProblem(t, api.do(rt.method, rt.path, "not-a-token", body), http.StatusUnauthorized, problem.CodeUnauthorized)
+		wantProblem(t, api.do(rt.method, rt.path, "fdns_unknown", body), http.StatusUnauthorized, problem.CodeUnauthorized)
+		wantProblem(t, api.do(rt.method, rt.path, sessionToken(t, "mallory"), body), http.StatusForbidden, problem.CodeForbidden)
+	})
+}
+
+func TestRoutesCheckAPIKeyScopes(t *testing.T) {
+	api := newTestAPI(t)
+	forEachRoute(t, func(t *testing.T, rt route, body string) {
+		// Every scope but the one the route needs
+		var others []auth.Scope
+		for _, scope := range auth.AllScopes {
+			if scope != rt.scope && scope != extraScopes[rt.method+" "+rt.path] {
+				others = append(others, scope)
+			}
+		}
+		wantProblem(t, api.do(rt.method, rt.path, api.apiKey(t, others...), body), http.StatusForbidden, problem.CodeInsufficientScope)
+		if rt.scope == "" {
+			return // Session-only, no key is enough
+		}
+
+		required := []auth.Scope{rt.scope}
+		if extra, ok := extraScopes[rt.method+" "+rt.path]; ok {
+			// The route's scope alone is not enough
+			wantProblem(t, api.do(rt.method, rt.path, api.apiKey(t, rt.scope), body), http.StatusForbidden, problem.CodeInsufficientScope)
+			required = append(required, extra)
+		}
+
+		rec := api.do(rt.method, rt.path, api.apiKey(t, required...), body)
+		if rec.Code == http.StatusUnauthorized || rec.Code == http.StatusForbidden {
+			t.Fatalf("key with the required scopes got %d: %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestRoutesReportStoreFailures(t *testing.T) {
+	api := newTestAPI(t)
+	api.store.Fail(errors.New("connection refused"))
+	forEachRoute(t, func(t *testing.T, rt route, body string) {
+		wantProblem(t, api.do(rt.method, rt.path, api.token, body), http.StatusInternalServerError, problem.CodeDatabaseError)
+	})
+}
+
+func TestRoutesWithoutStores(t *testing.T) {
+	api := newTestAPI(t)
+	configureHandlers(database.Stores{})
+	forEachRoute(t, func(t *testing.T, rt route, body string) {
+		wantProblem(t, api.do(rt.method, rt.path, api.token, body), http.StatusInternalServerError, problem.CodeDatabaseUnavailable)
+	})
+}
+
+func TestRoutesRejectInvalidBodies(t *testing.T) {
+	api := newTestAPI(t)
+	forEachRoute(t, func(t *testing.T, rt route, body string) {
+		if body == "" {
+			return // No body to get wrong
+		}
+		wantProblem(t, api.do(rt.method, rt.path, api.token, `{"domain":`), http.StatusBadRequest, problem.CodeInvalidBody)
+		wantProblem(t, api.do(rt.method, rt.path, api.token, `["not", "an", "object"]`), http.StatusBadRequest, problem.CodeInvalidBody)
+		wantFields(t, api.do(rt.method, rt.path, api.token, `{"unexpected": 1}`), "unexpected")
+
+		large := `{"domain": "` + strings.Repeat("a", config.Default().API.MaxBodyBytes) + `"}`
+		wantProblem(t, api.do(rt.method, rt.path, api.token, large), http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge)
+	})
+}
+
+func TestMetricsOnlyOnAdminListener(t *testing.T) {
+	api := newTestAPI(t)
+	rec := httptest.NewRecorder()
+	api.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	wantProblem(t, rec, http.StatusNotFound, problem.CodeNotFound)
+
+	cfg := config.Default()
+	rec = httptest.NewRecorder()
+	NewMetricsServer(&cfg).Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	wantStatus(t, rec, http.StatusOK)
+
+	cfg.Server.MetricsAddr = ""
+	if srv := NewMetricsServer(&cfg); srv != nil {
+		t.Errorf("NewMetricsServer without an address = %v, want nil", srv.Addr)
+	}
+}
@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	resolverv1 "github.com/BrachiGH/firedns-dashboard/internal/gen/firedns/resolver/v1"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/resolver"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// NewGRPCServer builds the gRPC server exposing the resolver API. It uses the
+// TLS settings of the HTTP server, client certificates included. The caller
+// starts it with StartGRPCServer and stops it with GracefulStop.
+func NewGRPCServer(cfg *config.Config, db database.Stores) (*grpc.Server, error) {
+	tlsConfig, err := newTLSConfig(cfg.Server.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(tracing.GRPCHandler()),
+		grpc.ChainUnaryInterceptor(unaryLogging, unaryAuth(cfg.GRPC.Token)),
+		grpc.ChainStreamInterceptor(streamLogging, streamAuth(cfg.GRPC.Token)),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	resolverv1.RegisterResolverServiceServer(srv, resolver.NewService(cfg.API, db))
+	return srv, nil
+}
+
+// StartGRPCServer serves srv on addr until it is stopped. It only returns an
+// error if the server stopped for another reason than GracefulStop or Stop.
+func StartGRPCServer(srv *grpc.Server, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("grpc server failed: %w", err)
+	}
+
+	zap.L().Info("Starting gRPC server", zap.String("addr", addr))
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return fmt.Errorf("grpc server failed: %w", err)
+	}
+	return nil
+}
+
+// authorize checks the bearer token sent by a resolver node. Without a
+// configured token, callers are authenticated by their client certificate.
+func authorize(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		sent, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+func unaryAuth(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authorize(ctx, token); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamAuth(token string) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(stream.Context(), token); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// callLogger returns the context of a call with a logger carrying its method,
+// request ID and trace ID, as the HTTP logging middleware does for requests.
+func callLogger(ctx context.Context, method string) (context.Context, *zap.Logger) {
+	requestID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(logging.RequestIDHeader); len(ids) > 0 {
+			requestID = ids[0]
+		}
+	}
+
+	logger := zap.L().With(zap.String("grpc_method", method))
+	if requestID != "" {
+		logger = logger.With(zap.String("request_id", requestID))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		logger = logger.With(zap.String("trace_id", span.TraceID().String()))
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		logger = logger.With(zap.Stringer("remote_addr", p.Addr))
+	}
+	return logging.NewContext(ctx, logger), logger
+}
+
+// logCall writes one entry per finished call. Server-side failures are errors.
+func logCall(logger *zap.Logger, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []zap.Field{zap.Stringer("code", code), zap.Duration("latency", time.Since(start))}
+	switch code {
+	case codes.OK, codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.Unauthenticated:
+		logger.Info("Call completed", fields...)
+	default:
+		logger.Error("Call failed", append(fields, zap.Error(err))...)
+	}
+}
+
+func unaryLogging(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx, logger := callLogger(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	logCall(logger, start, err)
+	return resp, err
+}
+
+func streamLogging(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, logger := callLogger(stream.Context(), info.FullMethod)
+	err := handler(srv, &loggedStream{ServerStream: stream, ctx: ctx})
+	logCall(logger, start, err)
+	return err
+}
+
+// loggedStream hands the call logger to stream handlers through Context.
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,375 @@
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	resolverv1 "github.com/BrachiGH/firedns-dashboard/internal/gen/firedns/resolver/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const testGRPCToken = "resolver-token"
+
+// serveGRPC serves the resolver API of cfg from db over an in-memory listener
+// and returns a client of it, connected with creds.
+func serveGRPC(t *testing.T, cfg *config.Config, db database.Stores, creds credentials.TransportCredentials) resolverv1.ResolverServiceClient {
+	t.Helper()
+	srv, err := NewGRPCServer(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := bufconn.Listen(1 << 20)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///resolver",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return resolverv1.NewResolverServiceClient(conn)
+}
+
+// tokenConfig serves the resolver API in plaintext, authenticated by testGRPCToken.
+func tokenConfig() *config.Config {
+	cfg := config.Default()
+	cfg.GRPC = config.GRPC{Addr: ":9090", Token: testGRPCToken, Insecure: true}
+	return &cfg
+}
+
+// withToken returns a context sending token as a resolver node does.
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func wantCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Fatalf("error = %v, want code %s", err, code)
+	}
+}
+
+func TestGRPCGetSettings(t *testing.T) {
+	api := newTestAPI(t)
+	wantStatus(t, api.do(http.MethodPatch, "/settings/general", api.token, generalBody), http.StatusOK)
+	api.store.LinkIP(netip.MustParsePrefix("2001:db8:1::/48"), testUser, time.Now().Add(-time.Hour))
+	client := serveGRPC(t, tokenConfig(), api.store.Stores(), insecure.NewCredentials())
+	ctx := withToken(testGRPCToken)
+
+	for name, req := range map[string]*resolverv1.GetSettingsRequest{
+		"by user_id": {User: &resolverv1.GetSettingsRequest_UserId{UserId: testUser}},
+		"by ip":      {User: &resolverv1.GetSettingsRequest_Ip{Ip: "2001:db8:1::53"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := client.GetSettings(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := resp.GetSettings()
+			if s.GetUserId() != testUser || !s.GetGeneral().GetBlockCsam() || s.GetGeneral().GetHomographProtection() {
+				t.Errorf("settings = %v, want those of %s saved through the HTTP API", s, testUser)
+			}
+		})
+	}
+
+	_, err := client.GetSettings(ctx, &resolverv1.GetSettingsRequest{User: &resolverv1.GetSettingsRequest_Ip{Ip: "192.0.2.1"}})
+	wantCode(t, err, codes.NotFound)
+	_, err = client.GetSettings(ctx, &resolverv1.GetSettingsRequest{User: &resolverv1.GetSettingsRequest_Ip{Ip: "not an address"}})
+	wantCode(t, err, codes.InvalidArgument)
+	_, err = client.GetSettings(ctx, &resolverv1.GetSettingsRequest{})
+	wantCode(t, err, codes.InvalidArgument)
+}
+
+func TestGRPCWatchSettings(t *testing.T) {
+	api := newTestAPI(t)
+	client := serveGRPC(t, tokenConfig(), api.store.Stores(), insecure.NewCredentials())
+	ctx, cancel := context.WithTimeout(withToken(testGRPCToken), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchSettings(ctx, &resolverv1.WatchSettingsRequest{UserIds: []string{testUser}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.GetSettings().GetUserId() != testUser || first.GetSettings().GetGeneral().GetBlockCsam() {
+		t.Fatalf("first settings = %v, want the defaults of %s", first.GetSettings(), testUser)
+	}
+
+	// A change saved through the HTTP API is resent
+	wantStatus(t, api.do(http.MethodPatch, "/settings/general", api.token, generalBody), http.StatusOK)
+	changed, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed.GetSettings().GetGeneral().GetBlockCsam() {
+		t.Errorf("settings after the change = %v, want blockCsam", changed.GetSettings())
+	}
+
+	empty, err := client.WatchSettings(ctx, &resolverv1.WatchSettingsRequest{})
+	if err == nil {
+		_, err = empty.Recv()
+	}
+	wantCode(t, err, codes.InvalidArgument)
+}
+
+// recordedBatches counts the events of every RecordQueryEvents call.
+type recordedBatches struct {
+	database.AnalyticsStore
+
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (r *recordedBatches) RecordQueryEvents(ctx context.Context, events []database.QueryEvent) error {
+	r.mu.Lock()
+	r.sizes = append(r.sizes, len(events))
+	r.mu.Unlock()
+	return r.AnalyticsStore.RecordQueryEvents(ctx, events)
+}
+
+func TestGRPCReportQueryEvents(t *testing.T) {
+	api := newTestAPI(t)
+	db := api.store.Stores()
+	recorder := &recordedBatches{AnalyticsStore: db.Analytics}
+	db.Analytics = recorder
+	client := serveGRPC(t, tokenConfig(), db, insecure.NewCredentials())
+
+	stream, err := client.ReportQueryEvents(withToken(testGRPCToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1201 valid events over requests of 100, and one invalid event per request
+	at := timestamppb.New(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	for sent := 0; sent < 1201; {
+		req := &resolverv1.ReportQueryEventsRequest{Events: []*resolverv1.QueryEvent{{ClientIp: "bad", Domain: "example.com"}}}
+		for ; sent < 1201 && len(req.Events) <= 100; sent++ {
+			action := resolverv1.QueryEvent_ACTION_PASSED
+			if sent%2 == 0 {
+				action = resolverv1.QueryEvent_ACTION_DROPPED
+			}
+			req.Events = append(req.Events, &resolverv1.QueryEvent{ClientIp: "192.0.2.1", Domain: "example.com", Action: action, Time: at})
+		}
+		if err := stream.Send(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetAccepted() != 1201 || resp.GetRejected() != 13 {
+		t.Errorf("accepted %d, rejected %d; want 1201 and 13", resp.GetAccepted(), resp.GetRejected())
+	}
+	if len(recorder.sizes) != 3 || recorder.sizes[0] != 500 || recorder.sizes[1] != 500 || recorder.sizes[2] != 201 {
+		t.Errorf("batches = %v, want [500 500 201]", recorder.sizes)
+	}
+
+	messages, err := api.store.FetchAllDNSMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || len(messages[0].Passed) != 600 || len(messages[0].Dropped) != 601 {
+		t.Errorf("stored %d messages, want one with 600 passed and 601 dropped queries", len(messages))
+	}
+
+	// A failed write ends the call
+	api.store.Fail(errors.New("connection refused"))
+	stream, err = client.ReportQueryEvents(withToken(testGRPCToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(&resolverv1.ReportQueryEventsRequest{Events: []*resolverv1.QueryEvent{
+		{ClientIp: "192.0.2.1", Domain: "example.com", Action: resolverv1.QueryEvent_ACTION_PASSED},
+	}})
+	_, err = stream.CloseAndRecv()
+	wantCode(t, err, codes.Unavailable)
+}
+
+func TestGRPCTokenAuth(t *testing.T) {
+	api := newTestAPI(t)
+	client := serveGRPC(t, tokenConfig(), api.store.Stores(), insecure.NewCredentials())
+	req := &resolverv1.GetSettingsRequest{User: &resolverv1.GetSettingsRequest_UserId{UserId: testUser}}
+
+	for name, ctx := range map[string]context.Context{
+		"no token":    context.Background(),
+		"wrong token": withToken("other-token"),
+		"not bearer":  metadata.AppendToOutgoingContext(context.Background(), "authorization", testGRPCToken),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := client.GetSettings(ctx, req)
+			wantCode(t, err, codes.Unauthenticated)
+
+			// Streams are checked by their own interceptor
+			stream, err := client.WatchSettings(ctx, &resolverv1.WatchSettingsRequest{UserIds: []string{testUser}})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			wantCode(t, err, codes.Unauthenticated)
+		})
+	}
+
+	if _, err := client.GetSettings(withToken(testGRPCToken), req); err != nil {
+		t.Errorf("GetSettings with the token = %v", err)
+	}
+}
+
+func TestGRPCClientCertificates(t *testing.T) {
+	pki := newTestPKI(t)
+	cfg := config.Default()
+	cfg.Server.TLS = config.TLS{CertFile: pki.serverCert, KeyFile: pki.serverKey, ClientCAFile: pki.clientCA}
+	cfg.GRPC = config.GRPC{Addr: ":9090"} // No token, clients authenticate by certificate
+	api := newTestAPI(t)
+	req := &resolverv1.GetSettingsRequest{User: &resolverv1.GetSettingsRequest_UserId{UserId: testUser}}
+
+	for name, tc := range map[string]struct {
+		certs []tls.Certificate
+		ok    bool
+	}{
+		"trusted client":   {[]tls.Certificate{pki.trusted}, true},
+		"untrusted client": {[]tls.Certificate{pki.untrusted}, false},
+		"no certificate":   {nil, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			creds := credentials.NewTLS(&tls.Config{ServerName: "localhost", RootCAs: pki.roots, Certificates: tc.certs})
+			client := serveGRPC(t, &cfg, api.store.Stores(), creds)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			_, err := client.GetSettings(ctx, req)
+			if tc.ok && err != nil {
+				t.Errorf("GetSettings = %v, want the client accepted", err)
+			}
+			if !tc.ok {
+				wantCode(t, err, codes.Unavailable) // The handshake fails, the call never reaches the service
+			}
+		})
+	}
+}
+
+// testPKI holds the key material of a server requiring client certificates.
+type testPKI struct {
+	serverCert, serverKey, clientCA string // Files
+	roots                           *x509.CertPool
+	trusted, untrusted              tls.Certificate
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	serverCA, serverCAKey := testCA(t)
+	clientCA, clientCAKey := testCA(t)
+	otherCA, otherCAKey := testCA(t)
+
+	pki := testPKI{
+		serverCert: filepath.Join(dir, "server.crt"),
+		serverKey:  filepath.Join(dir, "server.key"),
+		clientCA:   filepath.Join(dir, "client-ca.crt"),
+		roots:      x509.NewCertPool(),
+	}
+	pki.roots.AddCert(serverCA)
+	certPEM, keyPEM := testLeaf(t, serverCA, serverCAKey, x509.ExtKeyUsageServerAuth)
+	for file, data := range map[string][]byte{
+		pki.serverCert: certPEM,
+		pki.serverKey:  keyPEM,
+		pki.clientCA:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCA.Raw}),
+	} {
+		if err := os.WriteFile(file, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var err error
+	if pki.trusted, err = tls.X509KeyPair(testLeaf(t, clientCA, clientCAKey, x509.ExtKeyUsageClientAuth)); err != nil {
+		t.Fatal(err)
+	}
+	if pki.untrusted, err = tls.X509KeyPair(testLeaf(t, otherCA, otherCAKey, x509.ExtKeyUsageClientAuth)); err != nil {
+		t.Fatal(err)
+	}
+	return pki
+}
+
+func testCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	return testSign(t, template, nil, nil)
+}
+
+// testLeaf issues a certificate for localhost and returns it and its key in PEM.
+func testLeaf(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	cert, key := testSign(t, template, ca, caKey)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// testSign signs template with parent, or self-signs it when parent is nil.
+func testSign(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
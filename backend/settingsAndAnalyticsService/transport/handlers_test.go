@@ -0,0 +1,367 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/analytics"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/apikeys"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/settings"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+)
+
+// wantETag fails the test unless the response carries tag as its ETag.
+func wantETag(t *testing.T, rec *httptest.ResponseRecorder, tag string) {
+	t.Helper()
+	if got := rec.Header().Get("ETag"); got != tag {
+		t.Fatalf("ETag = %s, want %s", got, tag)
+	}
+}
+
+func TestGeneralSettings(t *testing.T) {
+	api := newTestAPI(t)
+	const path = "/settings/general"
+
+	rec := api.do(http.MethodGet, path, api.token, "")
+	wantStatus(t, rec, http.StatusOK)
+	wantETag(t, rec, `"0"`)
+	var got settings.GeneralSettings
+	decode(t, rec, &got)
+	if got.UserID != testUser || got.ThreatIntelligence {
+		t.Fatalf("defaults = %+v", got)
+	}
+
+	rec = api.do(http.MethodPatch, path, api.token, generalBody)
+	wantStatus(t, rec, http.StatusOK)
+	wantETag(t, rec, `"1"`)
+	decode(t, rec, &got)
+	if !got.ThreatIntelligence || !got.BlockCSAM || got.HomographProtection {
+		t.Fatalf("saved = %+v", got)
+	}
+
+	rec = api.do(http.MethodGet, path, api.token, "")
+	wantETag(t, rec, `"1"`)
+	decode(t, rec, &got)
+	if !got.ThreatIntelligence {
+		t.Fatalf("read back = %+v", got)
+	}
+	wantStatus(t, api.do(http.MethodGet, path, api.token, "", "If-None-Match", `"1"`), http.StatusNotModified)
+	wantStatus(t, api.do(http.MethodGet, path, api.token, "", "If-None-Match", `"0"`), http.StatusOK)
+
+	// Conditional updates
+	wantProblem(t, api.do(http.MethodPatch, path, api.token, generalBody, "If-Match", `"0"`), http.StatusPreconditionFailed, problem.CodePreconditionFailed)
+	wantProblem(t, api.do(http.MethodPatch, path, api.token, generalBody, "If-Match", `W/"1"`), http.StatusPreconditionFailed, problem.CodePreconditionFailed)
+	wantETag(t, api.do(http.MethodPatch, path, api.token, generalBody, "If-Match", `"0", "1"`), `"2"`)
+	wantETag(t, api.do(http.MethodPatch, path, api.token, generalBody, "If-Match", "*"), `"3"`)
+
+	// Every setting is required, and the body may not name another user
+	wantFields(t, api.do(http.MethodPatch, path, api.token, `{"threatIntelligence": true, "blockCSAM": null}`),
+		"blockCSAM", "blockDynamicDNS", "blockNewDomains", "googleSafeBrowsing", "homographProtection", "typosquattingProtection")
+	body := strings.Replace(generalBody, "{", `{"userId": "mallory",`, 1)
+	wantFields(t, api.do(http.MethodPatch, path, api.token, body), "userId")
+	body = strings.Replace(generalBody, `"blockCSAM": true`, `"blockCSAM": "yes"`, 1)
+	wantFields(t, api.do(http.MethodPatch, path, api.token, body), "blockCSAM")
+}
+
+func TestPrivacySettings(t *testing.T) {
+	api := newTestAPI(t)
+	const path = "/settings/privacy"
+
+	rec := api.do(http.MethodGet, path, api.token, "")
+	wantStatus(t, rec, http.StatusOK)
+	wantETag(t, rec, `"0"`)
+
+	rec = api.do(http.MethodPatch, path, api.token, privacyBody, "If-Match", `"0"`)
+	wantStatus(t, rec, http.StatusOK)
+	wantETag(t, rec, `"1"`)
+	var got settings.PrivacySettings
+	decode(t, rec, &got)
+	if !got.AdGuardMobileAdsFilter || !got.NextDNSAdsTrackers || got.AdAway {
+		t.Fatalf("saved = %+v", got)
+	}
+
+	decode(t, api.do(http.MethodGet, path, api.token, ""), &got)
+	if !got.HageziMultiPro {
+		t.Fatalf("read back = %+v", got)
+	}
+
+	wantFields(t, api.do(http.MethodPatch, path, api.token, `{"adAway": true}`),
+		"adGuardMobileAdsFilter", "goodbyeAds", "hageziMultiPro", "hostsVN", "nextDNSAdsTrackers")
+}
+
+func TestParentalControlSettings(t *testing.T) {
+	api := newTestAPI(t)
+	const path = "/settings/parental"
+
+	rec := api.do(http.MethodGet, path, api.token, "")
+	wantStatus(t, rec, http.StatusOK)
+	wantETag(t, rec, `"0"`)
+	var got settings.ParentalControlSettings
+	decode(t, rec, &got)
+	if blocked, ok := got.BlockedApps["TikTok"]; !ok || blocked || len(got.RecreationSchedule) != 7 {
+		t.Fatalf("defaults = %+v", got)
+	}
+
+	rec = api.do(http.MethodPatch, path, api.token, parentalBody)
+	wantStatus(t, rec, http.StatusOK)
+	wantETag(t, rec, `"1"`)
+	decode(t, rec, &got)
+	if !got.BlockedApps["TikTok"] || got.RecreationSchedule["Monday"].Start != "1:00 PM" {
+		t.Fatalf("saved = %+v", got)
+	}
+	// Apps and days not sent keep their defaults
+	if _, ok := got.BlockedApps["Discord"]; !ok || got.RecreationSchedule["Sunday"].End != "9:30 PM" {
+		t.Fatalf("defaults were not merged: %+v", got)
+	}
+
+	wantProblem(t, api.do(http.MethodPatch, path, api.token, parentalBody, "If-Match", `"0"`), http.StatusPreconditionFailed, problem.CodePreconditionFailed)
+
+	// An empty update saves nothing and answers with the current settings
+	rec = api.do(http.MethodPatch, path, api.token, `{}`, "If-Match", `"1"`)
+	wantStatus(t, rec, http.StatusOK)
+	wantETag(t, rec, `"1"`)
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", rec.Header().Get("Content-Type"))
+	}
+	decode(t, rec, &got)
+	if !got.BlockedApps["TikTok"] {
+		t.Fatalf("current = %+v", got)
+	}
+	wantProblem(t, api.do(http.MethodPatch, path, api.token, `{}`, "If-Match", `"0"`), http.StatusPreconditionFailed, problem.CodePreconditionFailed)
+
+	body := `{"blockedApps": {"Myspace": true}, "recreationSchedule": {
+		"Funday": {"start": "1:00 PM", "end": "2:00 PM"},
+		"Monday": {"start": "6:00 PM", "end": "1:00 PM"},
+		"Tuesday": {"start": "noon", "end": "1:00 PM"}}}`
+	wantFields(t, api.do(http.MethodPatch, path, api.token, body),
+		"blockedApps.Myspace", "recreationSchedule.Funday", "recreationSchedule.Monday", "recreationSchedule.Tuesday.start")
+}
+
+func TestDomainLists(t *testing.T) {
+	for _, tc := range []struct{ path, other string }{
+		{"/settings/denylist", "/settings/allowlist"},
+		{"/settings/allowlist", "/settings/denylist"},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			api := newTestAPI(t)
+			domains := func(path string) []string {
+				t.Helper()
+				rec := api.do(http.MethodGet, path, api.token, "")
+				wantStatus(t, rec, http.StatusOK)
+				var list settings.DenyListResponse
+				decode(t, rec, &list)
+				if list.UserID != testUser || list.Domains == nil {
+					t.Fatalf("list = %+v", list)
+				}
+				return list.Domains
+			}
+
+			if got := domains(tc.path); len(got) != 0 {
+				t.Fatalf("new list = %v", got)
+			}
+			// Removing from lists that do not exist
+			wantProblem(t, api.do(http.MethodDelete, tc.path, api.token, domainBody), http.StatusNotFound, problem.CodeNotFound)
+
+			// Domains are normalized, and added once
+			wantStatus(t, api.do(http.MethodPost, tc.path, api.token, `{"domain": " Ads.Example.COM. "}`), http.StatusNoContent)
+			wantStatus(t, api.do(http.MethodPost, tc.path, api.token, domainBody), http.StatusNoContent)
+			wantStatus(t, api.do(http.MethodPost, tc.path, api.token, `{"domain": "tracker.example.net"}`), http.StatusNoContent)
+			if got := domains(tc.path); strings.Join(got, ",") != "ads.example.com,tracker.example.net" {
+				t.Fatalf("list = %v", got)
+			}
+			if got := domains(tc.other); len(got) != 0 {
+				t.Fatalf("other list = %v", got)
+			}
+
+			wantFields(t, api.do(http.MethodPost, tc.path, api.token, `{}`), "domain")
+			wantFields(t, api.do(http.MethodPost, tc.path, api.token, `{"domain": "not a domain"}`), "domain")
+			wantFields(t, api.do(http.MethodPost, tc.path, api.token, `{"domain": "localhost"}`), "domain")
+
+			// Removing is idempotent
+			wantStatus(t, api.do(http.MethodDelete, tc.path, api.token, domainBody), http.StatusNoContent)
+			wantStatus(t, api.do(http.MethodDelete, tc.path, api.token, domainBody), http.StatusNoContent)
+			if got := domains(tc.path); strings.Join(got, ",") != "tracker.example.net" {
+				t.Fatalf("list after removal = %v", got)
+			}
+			wantFields(t, api.do(http.MethodDelete, tc.path, api.token, `{"domain": "  "}`), "domain")
+		})
+	}
+}
+
+func TestAllSettings(t *testing.T) {
+	api := newTestAPI(t)
+	const path = "/settings"
+
+	rec := api.do(http.MethodGet, path, api.token, "")
+	wantStatus(t, rec, http.StatusOK)
+	var got settings.AllSettings
+	decode(t, rec, &got)
+	if got.UserID != testUser || got.General == nil || got.Parental == nil || got.DenyList == nil || got.AllowList == nil {
+		t.Fatalf("defaults = %+v", got)
+	}
+
+	rec = api.do(http.MethodPut, path, api.token, allSettingsBody)
+	wantStatus(t, rec, http.StatusOK)
+	decode(t, rec, &got)
+	if !got.General.ThreatIntelligence || !got.Privacy.HageziMultiPro || !got.Parental.BlockedApps["TikTok"] {
+		t.Fatalf("saved = %+v", got)
+	}
+	if strings.Join(got.DenyList, ",") != "ads.example.com" || strings.Join(got.AllowList, ",") != "example.org" {
+		t.Fatalf("saved lists = %v, %v", got.DenyList, got.AllowList)
+	}
+
+	// The categories are the same documents as those of their own routes
+	wantETag(t, api.do(http.MethodGet, "/settings/general", api.token, ""), `"1"`)
+	wantETag(t, api.do(http.MethodGet, "/settings/parental", api.token, ""), `"1"`)
+	var list settings.DenyListResponse
+	decode(t, api.do(http.MethodGet, "/settings/denylist", api.token, ""), &list)
+	if strings.Join(list.Domains, ",") != "ads.example.com" {
+		t.Fatalf("deny list = %v", list.Domains)
+	}
+
+	// Empty lists replace the stored ones
+	body := strings.Replace(allSettingsBody, `["Ads.Example.com."]`, `[]`, 1)
+	decode(t, api.do(http.MethodPut, path, api.token, body), &got)
+	if len(got.DenyList) != 0 {
+		t.Fatalf("deny list = %v", got.DenyList)
+	}
+
+	wantFields(t, api.do(http.MethodPut, path, api.token, `{"general": null, "denylist": []}`),
+		"general", "privacy", "parental", "allowlist")
+	body = strings.Replace(allSettingsBody, `["example.org"]`, `["ads.example.com", "-bad-.example"]`, 1)
+	wantFields(t, api.do(http.MethodPut, path, api.token, body), "allowlist[1]", "allowlist")
+	body = strings.Replace(allSettingsBody, `"general": {`, `"general": {"userId": "mallory",`, 1)
+	wantFields(t, api.do(http.MethodPut, path, api.token, body), "general.userId")
+}
+
+func TestAnalytics(t *testing.T) {
+	api := newTestAPI(t)
+
+	rec := api.do(http.MethodGet, "/analytics", api.token, "")
+	wantStatus(t, rec, http.StatusOK)
+	var got analytics.AnalyticsResponse
+	decode(t, rec, &got)
+	if got.TotalQueries != 0 || got.ResolvedDomains == nil || got.BlockedDomains == nil {
+		t.Fatalf("empty analytics = %+v", got)
+	}
+
+	// Queries of the previous 3-hour bucket of the chart
+	queried := time.Now().Truncate(3 * time.Hour).Add(-time.Hour)
+	err := api.store.UpsertUserAnalytics(context.Background(), database.UserAnalytics{
+		UserID:         testUser,
+		LastUpdated:    time.Now(),
+		PassedCounts:   map[string]int{"example.com": 3, "example.org": 1},
+		DroppedCounts:  map[string]int{"ads.example.com": 4},
+		PassedDomains:  []database.DomainEntry{{Domain: "example.com", Timestamp: queried}},
+		DroppedDomains: []database.DomainEntry{{Domain: "ads.example.com", Timestamp: queried.Add(-time.Minute)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decode(t, api.do(http.MethodGet, "/analytics", api.token, ""), &got)
+	if got.TotalQueries != 8 || got.BlockedQueries != 4 || got.BlockedPercent != 50 {
+		t.Fatalf("totals = %d, %d, %v", got.TotalQueries, got.BlockedQueries, got.BlockedPercent)
+	}
+	if len(got.ResolvedDomains) != 2 || got.ResolvedDomains[0] != (analytics.AnalyticsDomainCount{Domain: "example.com", Count: 3}) {
+		t.Fatalf("resolved domains = %+v", got.ResolvedDomains)
+	}
+	if len(got.QueryChartData) != 8 {
+		t.Fatalf("chart = %+v", got.QueryChartData)
+	}
+	var total, blocked int64
+	for _, point := range got.QueryChartData {
+		total += point.Total
+		blocked += point.Blocked
+	}
+	if total != 2 || blocked != 1 {
+		t.Fatalf("chart totals = %d, %d", total, blocked)
+	}
+}
+
+func TestLogs(t *testing.T) {
+	api := newTestAPI(t)
+
+	rec := api.do(http.MethodGet, "/logs", api.token, "")
+	wantStatus(t, rec, http.StatusOK)
+	if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+		t.Fatalf("empty logs = %s", body)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	err := api.store.UpsertUserAnalytics(context.Background(), database.UserAnalytics{
+		UserID:         testUser,
+		PassedDomains:  []database.DomainEntry{{Domain: "old.example.com", Timestamp: now.Add(-time.Hour)}, {Domain: "new.example.com", Timestamp: now}},
+		DroppedDomains: []database.DomainEntry{{Domain: "ads.example.com", Timestamp: now.Add(-time.Minute)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []analytics.LogEntryResponse
+	decode(t, api.do(http.MethodGet, "/logs", api.token, ""), &got)
+	want := []analytics.LogEntryResponse{
+		{Domain: "new.example.com", Timestamp: now, Status: "allowed"},
+		{Domain: "ads.example.com", Timestamp: now.Add(-time.Minute), Status: "blocked"},
+		{Domain: "old.example.com", Timestamp: now.Add(-time.Hour), Status: "allowed"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("logs = %+v", got)
+	}
+	for i := range want {
+		if got[i].Domain != want[i].Domain || !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].Status != want[i].Status {
+			t.Errorf("logs[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	api := newTestAPI(t)
+	const path = "/apikeys"
+
+	rec := api.do(http.MethodGet, path, api.token, "")
+	wantStatus(t, rec, http.StatusOK)
+	var list apikeys.APIKeysResponse
+	decode(t, rec, &list)
+	if list.UserID != testUser || list.Keys == nil || len(list.Keys) != 0 {
+		t.Fatalf("no keys = %+v", list)
+	}
+
+	rec = api.do(http.MethodPost, path, api.token, `{"name": " ci ", "scopes": ["settings:read"]}`)
+	wantStatus(t, rec, http.StatusCreated)
+	var created apikeys.CreateAPIKeyResponse
+	decode(t, rec, &created)
+	if created.Name != "ci" || !strings.HasPrefix(created.Key, created.Prefix) || created.ID == "" {
+		t.Fatalf("created = %+v", created)
+	}
+
+	// The key grants its scopes, and nothing else
+	wantStatus(t, api.do(http.MethodGet, "/settings/general", created.Key, ""), http.StatusOK)
+	wantProblem(t, api.do(http.MethodPatch, "/settings/general", created.Key, generalBody), http.StatusForbidden, problem.CodeInsufficientScope)
+
+	decode(t, api.do(http.MethodGet, path, api.token, ""), &list)
+	if len(list.Keys) != 1 || list.Keys[0].ID != created.ID || list.Keys[0].LastUsedAt == nil {
+		t.Fatalf("keys = %+v", list.Keys)
+	}
+
+	wantFields(t, api.do(http.MethodPost, path, api.token, `{"name": "", "scopes": ["everything"]}`), "name", "scopes")
+	wantFields(t, api.do(http.MethodPost, path, api.token, `{"name": "ci", "scopes": []}`), "scopes")
+
+	wantStatus(t, api.do(http.MethodDelete, path, api.token, `{"id": "`+created.ID+`"}`), http.StatusNoContent)
+	wantProblem(t, api.do(http.MethodGet, "/settings/general", created.Key, ""), http.StatusUnauthorized, problem.CodeUnauthorized)
+	wantProblem(t, api.do(http.MethodDelete, path, api.token, `{"id": "`+created.ID+`"}`), http.StatusNotFound, problem.CodeNotFound)
+	wantFields(t, api.do(http.MethodDelete, path, api.token, `{"id": " "}`), "id")
+
+	// Another user's key cannot be revoked
+	otherKey, err := api.store.CreateAPIKey(context.Background(), "mallory", "other", "fdns_other", "hash", []string{string(auth.ScopeSettingsRead)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantProblem(t, api.do(http.MethodDelete, path, api.token, `{"id": "`+otherKey.ID+`"}`), http.StatusNotFound, problem.CodeNotFound)
+}
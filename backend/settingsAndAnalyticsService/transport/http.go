@@ -1,33 +1,96 @@
 package transport
 
 import (
-	"log"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
 
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/certs"
+	"github.com/BrachiGH/firedns-dashboard/internal/config"
+	"github.com/BrachiGH/firedns-dashboard/internal/database"
 	"github.com/BrachiGH/firedns-dashboard/internal/handlers/analytics"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/apikeys"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/health"
 	"github.com/BrachiGH/firedns-dashboard/internal/handlers/settings"
+	"github.com/BrachiGH/firedns-dashboard/internal/metrics"
+	"github.com/BrachiGH/firedns-dashboard/internal/ratelimit"
+	"github.com/BrachiGH/firedns-dashboard/internal/validate"
+	"go.uber.org/zap"
 )
 
-func StartApiServer() {
-	http.HandleFunc("/settings/general/", settings.GeneralSettingsHandler)
-	http.HandleFunc("/settings/privacy/", settings.PrivacySettingsHandler)
-	http.HandleFunc("/settings/parental/", settings.ParentalControlHandler)
-	http.HandleFunc("/settings/denylist/", settings.DenyListHandler)
-	http.HandleFunc("/settings/allowlist/", settings.AllowListHandler)
-	http.HandleFunc("/analytics/", analytics.AnalyticsHandler)
-	http.HandleFunc("/logs/", analytics.LogsHandler)
+// NewApiServer builds the HTTP server exposing the settings and analytics API,
+// backed by db. The caller starts it with StartApiServer and stops it with Shutdown.
+func NewApiServer(cfg *config.Config, db database.Stores) (*http.Server, error) {
+	authenticator, err := auth.NewAuthenticator(cfg.Auth.Secret, db.APIKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.Server.TLS)
+	if err != nil {
+		return nil, err
+	}
 
-	port := ":8080"
+	settings.Configure(cfg.API, db)
+	analytics.Configure(cfg.API, db)
+	apikeys.Configure(cfg.API, db)
+	health.Configure(db)
+	validate.Configure(cfg.API)
 
-	// Start the HTTP server
-	log.Printf("Starting server on %s", port)
-	err := http.ListenAndServe(port, nil)
+	return &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           newRouter(authenticator, ratelimit.New(cfg.RateLimit)),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+	}, nil
+}
+
+// NewMetricsServer builds the admin HTTP server exposing /metrics on
+// cfg.Server.MetricsAddr, apart from the API so that scrapers need not reach
+// the public listener and API clients cannot read the metrics. It returns nil
+// when the admin listener is disabled. It is started with StartApiServer.
+func NewMetricsServer(cfg *config.Config) *http.Server {
+	if cfg.Server.MetricsAddr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	return &http.Server{
+		Addr:              cfg.Server.MetricsAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+	}
+}
+
+// newTLSConfig enables HTTPS when a certificate and key are configured
+// (e.g. Keys/server.crt and Keys/server.key). It returns nil when TLS is not configured.
+func newTLSConfig(cfg config.TLS) (*tls.Config, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	reloader, err := certs.NewReloader(cfg.CertFile, cfg.KeyFile, cfg.ClientCAFile)
 	if err != nil {
-		if _, ok := err.(*os.PathError); ok {
-			log.Fatalf("Server failed to start: Error: %v", err)
-		} else {
-			log.Fatalf("Server failed to start: %v", err)
-		}
+		return nil, err
+	}
+	return reloader.TLSConfig(), nil
+}
+
+// StartApiServer serves srv until it is shut down. It only returns an error
+// if the server stopped for another reason than Shutdown being called.
+func StartApiServer(srv *http.Server) error {
+	var err error
+	if srv.TLSConfig != nil {
+		zap.L().Info("Starting HTTPS server", zap.String("addr", srv.Addr))
+		err = srv.ListenAndServeTLS("", "") // Key material comes from TLSConfig
+	} else {
+		zap.L().Info("Starting server", zap.String("addr", srv.Addr))
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server failed: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/auth"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/analytics"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/apikeys"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/health"
+	"github.com/BrachiGH/firedns-dashboard/internal/handlers/settings"
+	"github.com/BrachiGH/firedns-dashboard/internal/logging"
+	"github.com/BrachiGH/firedns-dashboard/internal/metrics"
+	"github.com/BrachiGH/firedns-dashboard/internal/openapi"
+	"github.com/BrachiGH/firedns-dashboard/internal/problem"
+	"github.com/BrachiGH/firedns-dashboard/internal/ratelimit"
+	"github.com/BrachiGH/firedns-dashboard/internal/tracing"
+	"go.uber.org/zap"
+)
+
+// userPrefix is the root of every per-user route of the current API version.
+const userPrefix = "/v1/users/{userID}"
+
+// route describes one endpoint of the API.
+type route struct {
+	method  string
+	path    string // Relative to userPrefix
+	legacy  string // Pre-v1 path still served as a deprecated alias, if any
+	scope   auth.Scope
+	handler http.HandlerFunc
+}
+
+var routes = []route{
+	// Every category at once; the handlers also require the matching lists scope
+	{http.MethodGet, "/settings", "", auth.ScopeSettingsRead, settings.GetAllSettings},
+	{http.MethodPut, "/settings", "", auth.ScopeSettingsWrite, settings.ReplaceAllSettings},
+
+	{http.MethodGet, "/settings/general", "/settings/general/{userID}", auth.ScopeSettingsRead, settings.GetGeneralSettings},
+	{http.MethodPatch, "/settings/general", "/settings/general/{userID}", auth.ScopeSettingsWrite, settings.UpdateGeneralSettings},
+	{http.MethodGet, "/settings/privacy", "/settings/privacy/{userID}", auth.ScopeSettingsRead, settings.GetPrivacySettings},
+	{http.MethodPatch, "/settings/privacy", "/settings/privacy/{userID}", auth.ScopeSettingsWrite, settings.UpdatePrivacySettings},
+	{http.MethodGet, "/settings/parental", "/settings/parental/{userID}", auth.ScopeSettingsRead, settings.GetParentalControlSettings},
+	{http.MethodPatch, "/settings/parental", "/settings/parental/{userID}", auth.ScopeSettingsWrite, settings.UpdateParentalControlSettings},
+
+	{http.MethodGet, "/settings/denylist", "/settings/denylist/{userID}", auth.ScopeListsRead, settings.GetDenyList},
+	{http.MethodPost, "/settings/denylist", "/settings/denylist/{userID}", auth.ScopeListsWrite, settings.AddDenyDomain},
+	{http.MethodDelete, "/settings/denylist", "/settings/denylist/{userID}", auth.ScopeListsWrite, settings.RemoveDenyDomain},
+	{http.MethodGet, "/settings/allowlist", "/settings/allowlist/{userID}", auth.ScopeListsRead, settings.GetAllowList},
+	{http.MethodPost, "/settings/allowlist", "/settings/allowlist/{userID}", auth.ScopeListsWrite, settings.AddAllowDomain},
+	{http.MethodDelete, "/settings/allowlist", "/settings/allowlist/{userID}", auth.ScopeListsWrite, settings.RemoveAllowDomain},
+
+	{http.MethodGet, "/analytics", "/analytics/{userID}", auth.ScopeAnalyticsRead, analytics.GetAnalytics},
+	{http.MethodGet, "/logs", "/logs/{userID}", auth.ScopeAnalyticsRead, analytics.GetLogs},
+
+	// Keys can only be managed with a dashboard session, never with another API key
+	{http.MethodGet, "/apikeys", "/apikeys/{userID}", "", apikeys.ListAPIKeys},
+	{http.MethodPost, "/apikeys", "/apikeys/{userID}", "", apikeys.CreateAPIKey},
+	{http.MethodDelete, "/apikeys", "/apikeys/{userID}", "", apikeys.RevokeAPIKey},
+}
+
+// newRouter registers every route, and its legacy alias, behind the authentication
+// and rate limiting middleware.
+func newRouter(authenticator *auth.Authenticator, limiter *ratelimit.Limiter) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.json", openapi.Handler)
+	mux.HandleFunc("GET /healthz", health.Healthz)
+	mux.HandleFunc("GET /readyz", health.Readyz)
+
+	for _, rt := range routes {
+		class := ratelimit.ClassOf(rt.method)
+		handler := limiter.ByIP(class, authenticator.RequireUser(rt.scope, limiter.ByUser(class, rt.handler)))
+		path := userPrefix + rt.path
+
+		mux.HandleFunc(rt.method+" "+path, handler)
+		if rt.legacy != "" {
+			mux.HandleFunc(rt.method+" "+rt.legacy, deprecated(path, handler))
+		}
+	}
+	return tracing.Middleware(logging.Middleware(metrics.InstrumentHTTP(tracing.NameByRoute(problemMux{mux: mux}))))
+}
+
+// deprecated marks responses of a legacy alias and points clients to the v1 route.
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		location := strings.Replace(successor, "{userID}", r.PathValue("userID"), 1)
+		logging.FromContext(r.Context()).Info("Deprecated route used", zap.String("successor", location))
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+location+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
+
+// problemMux replaces the plain-text 404 and 405 responses of http.ServeMux
+// with problem+json so that every response of the API uses the same error format.
+type problemMux struct {
+	mux *http.ServeMux
+}
+
+func (m problemMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, pattern := m.mux.Handler(r)
+	if pattern != "" {
+		m.mux.ServeHTTP(w, r) // ServeHTTP, not handler, so that path values are populated
+		return
+	}
+
+	// No route matched: find out whether the path exists for another method.
+	capture := &captureWriter{header: http.Header{}}
+	handler.ServeHTTP(capture, r)
+
+	if capture.status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", capture.header.Get("Allow"))
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "No route matches "+r.URL.Path)
+}
+
+// captureWriter records the status and headers written by the mux's fallback handlers.
+type captureWriter struct {
+	header http.Header
+	status int
+}
+
+func (c *captureWriter) Header() http.Header { return c.header }
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/BrachiGH/firedns-dashboard/internal/openapi"
+)
+
+type operation struct {
+	Description string `json:"description"`
+}
+
+func loadPaths(t *testing.T) map[string]map[string]json.RawMessage {
+	t.Helper()
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Document(), &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return doc.Paths
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	paths := loadPaths(t)
+	for _, rt := range routes {
+		path := userPrefix + rt.path
+		raw, ok := paths[path][strings.ToLower(rt.method)]
+		if !ok {
+			t.Errorf("%s %s is not documented in openapi.json", rt.method, path)
+			continue
+		}
+
+		var op operation
+		if err := json.Unmarshal(raw, &op); err != nil {
+			t.Fatalf("%s %s: invalid operation: %v", rt.method, path, err)
+		}
+		if rt.scope != "" && !strings.Contains(op.Description, "`"+string(rt.scope)+"`") {
+			t.Errorf("%s %s: description should name the %s scope", rt.method, path, rt.scope)
+		}
+	}
+}
+
+// unversioned paths are registered outside the routes table.
+var unversioned = map[string]bool{"/openapi.json": true, "/healthz": true, "/readyz": true}
+
+func TestEveryDocumentedOperationIsRouted(t *testing.T) {
+	routed := make(map[string]bool)
+	for _, rt := range routes {
+		routed[rt.method+" "+userPrefix+rt.path] = true
+	}
+
+	for path, item := range loadPaths(t) {
+		if unversioned[path] {
+			continue
+		}
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			if key := strings.ToUpper(method) + " " + path; !routed[key] {
+				t.Errorf("%s is documented but not routed", key)
+			}
+		}
+	}
+}